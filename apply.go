@@ -0,0 +1,151 @@
+package wgctrl
+
+import (
+	"sync"
+
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// An ApplyResult reports the changes made to a device by
+// ConfigureDeviceReport.
+type ApplyResult struct {
+	// Before and After are the device before and after the configuration was
+	// applied.
+	Before, After *wgtypes.Device
+
+	// Changes describes the differences between Before and After, including
+	// allowed IPs taken by one peer from another.
+	Changes *Changes
+
+	// Messages is the number of messages sent to the device's backend to
+	// apply the configuration. Backends which do not report operations to an
+	// Observer, such as OpenBSD, report 0.
+	Messages int
+}
+
+// ConfigureDeviceReport configures a WireGuard device by its interface name,
+// as with ConfigureDevice, and reports the changes which were made.
+//
+// The device is retrieved before and after cfg is applied, so the report
+// includes any changes made by other processes in the meantime. Endpoints
+// may also change as peers roam. Messages sent by concurrent calls which
+// configure the same device using this Client are included in Messages.
+//
+// If the device cannot be retrieved before cfg is applied, the device is not
+// configured and no ApplyResult is returned. If configuring the device fails,
+// or the device cannot be retrieved afterward, the error is returned along
+// with an ApplyResult which reports the changes known to have been made: a
+// failed configuration may have been partially applied.
+//
+// If locking is enabled by Options.Lock, the device is locked until it has
+// been retrieved once more.
+func (c *Client) ConfigureDeviceReport(name string, cfg wgtypes.Config) (*ApplyResult, error) {
+	var res *ApplyResult
+	err := c.withLock(name, func() error {
+		var err error
+		res, err = c.report(name, cfg)
+		return err
+	})
+
+	return res, err
+}
+
+// report implements ConfigureDeviceReport without locking the device.
+func (c *Client) report(name string, cfg wgtypes.Config) (*ApplyResult, error) {
+	before, err := c.Device(name)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ApplyResult{Before: before}
+
+	var cerr error
+	res.Messages = c.messages.count(name, func() {
+		cerr = c.configureDevice(name, cfg)
+	})
+
+	after, err := c.Device(name)
+	if err != nil {
+		if cerr != nil {
+			return res, cerr
+		}
+
+		return res, err
+	}
+
+	res.After = after
+	res.Changes = CompareDevices(before, after)
+	return res, cerr
+}
+
+// A messageCounter is a wginternal.Observer which counts the messages sent to
+// configure devices, and forwards all operations to an optional Observer.
+type messageCounter struct {
+	o Observer
+
+	mu   sync.Mutex
+	taps map[*messageTap]struct{}
+}
+
+// A messageTap accumulates the messages sent to configure a single device.
+type messageTap struct {
+	device   string
+	messages int
+}
+
+// newMessageCounter creates a messageCounter which forwards operations to o,
+// if o is not nil.
+func newMessageCounter(o Observer) *messageCounter {
+	return &messageCounter{
+		o:    o,
+		taps: make(map[*messageTap]struct{}),
+	}
+}
+
+// count calls fn and returns the number of messages sent to configure device
+// while it ran. m may be nil, in which case 0 is returned.
+func (m *messageCounter) count(device string, fn func()) int {
+	if m == nil {
+		fn()
+		return 0
+	}
+
+	t := &messageTap{device: device}
+
+	m.mu.Lock()
+	m.taps[t] = struct{}{}
+	m.mu.Unlock()
+
+	fn()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.taps, t)
+
+	return t.messages
+}
+
+// Start implements wginternal.Observer.
+func (m *messageCounter) Start(op *wginternal.Op) {
+	if m.o != nil {
+		m.o.OperationStart((*Operation)(op))
+	}
+}
+
+// End implements wginternal.Observer.
+func (m *messageCounter) End(op *wginternal.Op) {
+	if op.Operation == wginternal.OpSet {
+		m.mu.Lock()
+		for t := range m.taps {
+			if t.device == op.Device {
+				t.messages += op.Messages
+			}
+		}
+		m.mu.Unlock()
+	}
+
+	if m.o != nil {
+		m.o.OperationEnd((*Operation)(op))
+	}
+}
@@ -0,0 +1,70 @@
+package wgctrl_test
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestClientConfigureDeviceReport(t *testing.T) {
+	c, err := wgctrl.NewWithOptions(&wgctrl.Options{EmbeddedOnly: true})
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer c.Close()
+
+	const name = "wgreporttest0"
+	ed, err := c.CreateEmbeddedDevice(name, nil)
+	if err != nil {
+		t.Fatalf("failed to create embedded device: %v", err)
+	}
+	defer ed.Close()
+
+	var (
+		keyA = wgtest.MustPublicKey()
+		keyB = wgtest.MustPublicKey()
+		ip   = wgtest.MustCIDR("10.0.0.5/32")
+	)
+
+	if err := c.ConfigureDevice(name, wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey:  keyA,
+			AllowedIPs: []net.IPNet{ip},
+		}},
+	}); err != nil {
+		t.Fatalf("failed to configure device: %v", err)
+	}
+
+	res, err := c.ConfigureDeviceReport(name, wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey:  keyB,
+			Endpoint:   wgtest.MustUDPAddr("192.0.2.1:51820"),
+			AllowedIPs: []net.IPNet{ip},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("failed to configure device: %v", err)
+	}
+
+	want := []string{
+		fmt.Sprintf("peer %s: added", keyB),
+		fmt.Sprintf("peer %s: endpoint: (none) -> 192.0.2.1:51820", keyB),
+		fmt.Sprintf("peer %s: allowed-ips: (none) -> 10.0.0.5/32", keyB),
+		fmt.Sprintf("peer %s: allowed-ips: 10.0.0.5/32 -> (none)", keyA),
+		fmt.Sprintf("allowed IP 10.0.0.5/32: moved from peer %s to peer %s", keyA, keyB),
+	}
+
+	if diff := cmp.Diff(want, res.Changes.Lines()); diff != "" {
+		t.Fatalf("unexpected changes (-want +got):\n%s", diff)
+	}
+
+	// Userspace devices are configured using a single message.
+	if diff := cmp.Diff(1, res.Messages); diff != "" {
+		t.Fatalf("unexpected number of messages (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,271 @@
+package wgctrl
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// An AuditSink receives an AuditRecord for each attempt by a Client to
+// configure a device. Audit is called synchronously after the attempt
+// completes, and an error it returns is returned to the caller. An AuditSink
+// must be safe for concurrent use.
+type AuditSink interface {
+	Audit(r AuditRecord) error
+}
+
+// An AuditRecord describes an attempt to configure a device.
+type AuditRecord struct {
+	// Time is when the attempt completed.
+	Time time.Time `json:"time"`
+
+	// Actor is the caller-supplied identity of the user or component which
+	// configured the device: Options.Actor, or the actor passed to
+	// ConfigureDeviceAs.
+	Actor string `json:"actor"`
+
+	// Device is the name of the device.
+	Device string `json:"device"`
+
+	// Changes describes the changes made to the device by the attempt, as
+	// found by comparing the device before and after it, with keys redacted.
+	// A failed configuration may have been partially applied. Changes is
+	// empty if the device could not be retrieved.
+	Changes []AuditChange `json:"changes,omitempty"`
+
+	// Result is "ok" if the configuration was applied, or "error" if it
+	// failed, in which case Error is the text of the error.
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// An AuditChange is a change to a field of a device or one of its peers, as
+// described by FieldChange. A private key is reported using its public key,
+// and preshared keys are never revealed.
+//
+// A peer which was added or removed is reported as a change of its "peer"
+// field from "(none)" to "(present)", or vice versa. The fields of an added
+// peer are reported as changes from their zero values. An allowed IP taken by
+// one peer from another is reported as a change of the allowed IPs of both.
+type AuditChange struct {
+	// Peer is the public key of the peer, or empty for a field of the device
+	// itself.
+	Peer string `json:"peer,omitempty"`
+
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// newAuditRecord produces the AuditRecord for an attempt to configure device
+// name, which returned err. before and after are the states of the device
+// before and after the attempt, and either may be nil if the device could not
+// be retrieved.
+func newAuditRecord(actor, name string, before, after *wgtypes.Device, err error) AuditRecord {
+	r := AuditRecord{
+		Time:   time.Now().UTC(),
+		Actor:  actor,
+		Device: name,
+		Result: "ok",
+	}
+	if err != nil {
+		r.Result = "error"
+		r.Error = err.Error()
+	}
+
+	if before != nil && after != nil {
+		r.Changes = auditChanges(CompareDevices(before, after))
+	}
+
+	return r
+}
+
+// auditChanges flattens cs into AuditChanges.
+func auditChanges(cs *Changes) []AuditChange {
+	var out []AuditChange
+	add := func(peer string, fs []FieldChange) {
+		for _, f := range fs {
+			out = append(out, AuditChange{
+				Peer:   peer,
+				Field:  f.Field,
+				Before: f.Before,
+				After:  f.After,
+			})
+		}
+	}
+
+	add("", cs.Fields)
+
+	for _, p := range cs.Removed {
+		add(p.PublicKey.String(), []FieldChange{{Field: "peer", Before: "(present)", After: "(none)"}})
+	}
+
+	for i, p := range cs.Added {
+		add(p.PublicKey.String(), append(
+			[]FieldChange{{Field: "peer", Before: "(none)", After: "(present)"}},
+			comparePeers(&wgtypes.Peer{}, &cs.Added[i])...,
+		))
+	}
+
+	for _, p := range cs.Updated {
+		add(p.PublicKey.String(), p.Fields)
+	}
+
+	return out
+}
+
+// ErrAuditChain indicates that an audit log written by an AuditFile has been
+// modified: an entry was edited, inserted, reordered, or removed. Use
+// errors.Is to check for this error.
+var ErrAuditChain = errors.New("wgctrl: audit log hash chain is broken")
+
+// An auditEntry is a line of an audit log written by an AuditFile.
+type auditEntry struct {
+	// Record is the JSON encoding of an AuditRecord, which is hashed in the
+	// exact form in which it was written.
+	Record json.RawMessage `json:"record"`
+
+	// Prev is the Hash of the previous entry, or empty for the first entry.
+	// Hash is the hexadecimal SHA-256 hash of Prev followed by Record.
+	Prev string `json:"prev"`
+	Hash string `json:"hash"`
+}
+
+// auditHash computes the hash of an entry with the previous hash prev.
+func auditHash(prev string, record []byte) string {
+	h := sha256.New()
+	h.Write([]byte(prev))
+	h.Write(record)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// An AuditFile is an AuditSink which appends each AuditRecord to a file as a
+// line of JSON. Each line includes a hash of its record and of the previous
+// line, so that an edit or removal of any line, other than the removal of
+// the most recent lines, can be detected using VerifyAuditFile. To detect the
+// removal of the most recent lines, store the hash returned by Head
+// elsewhere, and compare it with the hash returned by VerifyAuditFile.
+type AuditFile struct {
+	mu   sync.Mutex
+	f    *os.File
+	head string
+}
+
+var _ AuditSink = &AuditFile{}
+
+// OpenAuditFile opens the audit log at path for appending, creating it with
+// permissions 0600 if it does not exist. An existing log is verified before
+// new records are appended to it.
+func OpenAuditFile(path string) (*AuditFile, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := VerifyAuditFile(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return &AuditFile{f: f, head: head}, nil
+}
+
+// Audit implements AuditSink by appending r to the log and syncing the file.
+func (a *AuditFile) Audit(r AuditRecord) error {
+	record, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.f == nil {
+		return os.ErrClosed
+	}
+
+	e := auditEntry{
+		Record: record,
+		Prev:   a.head,
+		Hash:   auditHash(a.head, record),
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if _, err := a.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := a.f.Sync(); err != nil {
+		return err
+	}
+
+	a.head = e.Hash
+	return nil
+}
+
+// Head returns the hash of the most recent entry in the log, or the empty
+// string if the log is empty.
+func (a *AuditFile) Head() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.head
+}
+
+// Close closes the log.
+func (a *AuditFile) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.f == nil {
+		return nil
+	}
+
+	err := a.f.Close()
+	a.f = nil
+	return err
+}
+
+// VerifyAuditFile reads an audit log written by an AuditFile from r, verifies
+// its hash chain, and returns the hash of its most recent entry. If the log
+// has been modified, an error is returned which can be checked using
+// errors.Is and ErrAuditChain.
+func VerifyAuditFile(r io.Reader) (string, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 16*1024*1024)
+
+	var head string
+	for n := 1; s.Scan(); n++ {
+		line := bytes.TrimSpace(s.Bytes())
+
+		var e auditEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return "", fmt.Errorf("wgctrl: audit log line %d: %v: %w", n, err, ErrAuditChain)
+		}
+
+		if e.Prev != head || e.Hash != auditHash(e.Prev, e.Record) {
+			return "", fmt.Errorf("wgctrl: audit log line %d: %w", n, ErrAuditChain)
+		}
+
+		head = e.Hash
+	}
+
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+
+	return head, nil
+}
@@ -0,0 +1,189 @@
+package wgctrl
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestClientAudit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wgctrl-audit")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	af, err := OpenAuditFile(path)
+	if err != nil {
+		t.Fatalf("failed to open audit file: %v", err)
+	}
+	defer af.Close()
+
+	var (
+		priv = wgtest.MustPrivateKey()
+		psk  = wgtest.MustPresharedKey()
+		pub  = wgtest.MustPublicKey()
+		port = 51820
+	)
+
+	var records []AuditRecord
+	c := &Client{
+		cs: []wginternal.Client{wgtest.NewMemClient(&wgtypes.Device{Name: "wg0"})},
+		audit: auditFunc(func(r AuditRecord) error {
+			records = append(records, r)
+			return af.Audit(r)
+		}),
+		actor: "agent",
+	}
+
+	if err := c.ConfigureDevice("wg0", wgtypes.Config{
+		PrivateKey: &priv,
+		ListenPort: &port,
+	}); err != nil {
+		t.Fatalf("failed to configure device: %v", err)
+	}
+
+	if err := c.ConfigureDeviceAs("alice", "wg0", wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey:    pub,
+			PresharedKey: &psk,
+			AllowedIPs:   []net.IPNet{wgtest.MustCIDR("10.0.0.1/32")},
+		}},
+	}); err != nil {
+		t.Fatalf("failed to configure device: %v", err)
+	}
+
+	if err := c.ConfigureDevice("wg1", wgtypes.Config{}); !os.IsNotExist(err) {
+		t.Fatalf("expected is not exist, but got: %v", err)
+	}
+
+	// A configuration refused by ConfigureDeviceIf is also recorded.
+	if err := c.ConfigureDeviceIf("wg0", Fingerprint{}, wgtypes.Config{}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected conflict, but got: %v", err)
+	}
+
+	want := []AuditRecord{
+		{
+			Actor:  "agent",
+			Device: "wg0",
+			Changes: []AuditChange{
+				{Field: "public-key", Before: "(none)", After: priv.PublicKey().String()},
+				{Field: "listen-port", Before: "0", After: "51820"},
+			},
+			Result: "ok",
+		},
+		{
+			Actor:  "alice",
+			Device: "wg0",
+			Changes: []AuditChange{
+				{Peer: pub.String(), Field: "peer", Before: "(none)", After: "(present)"},
+				{Peer: pub.String(), Field: "preshared-key", Before: "(none)", After: "(hidden)"},
+				{Peer: pub.String(), Field: "allowed-ips", Before: "(none)", After: "10.0.0.1/32"},
+			},
+			Result: "ok",
+		},
+		{
+			Actor:  "agent",
+			Device: "wg1",
+			Result: "error",
+			Error:  os.ErrNotExist.Error(),
+		},
+		{
+			Actor:  "agent",
+			Device: "wg0",
+			Result: "error",
+			Error:  ErrConflict.Error(),
+		},
+	}
+
+	for i := range records {
+		if records[i].Time.IsZero() {
+			t.Fatalf("record %d has no time", i)
+		}
+		records[i].Time = want[i].Time
+	}
+
+	if diff := cmp.Diff(want, records); diff != "" {
+		t.Fatalf("unexpected audit records (-want +got):\n%s", diff)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read audit file: %v", err)
+	}
+
+	for _, k := range []wgtypes.Key{priv, psk} {
+		if bytes.Contains(b, []byte(k.String())) {
+			t.Fatal("audit file contains a secret key")
+		}
+	}
+
+	head, err := VerifyAuditFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("failed to verify audit file: %v", err)
+	}
+	if diff := cmp.Diff(af.Head(), head); diff != "" {
+		t.Fatalf("unexpected head (-want +got):\n%s", diff)
+	}
+
+	// Reopening the log continues its chain.
+	_ = af.Close()
+	af, err = OpenAuditFile(path)
+	if err != nil {
+		t.Fatalf("failed to reopen audit file: %v", err)
+	}
+	if err := af.Audit(AuditRecord{Actor: "agent", Device: "wg0", Result: "ok"}); err != nil {
+		t.Fatalf("failed to append record: %v", err)
+	}
+
+	b, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read audit file: %v", err)
+	}
+	if _, err := VerifyAuditFile(bytes.NewReader(b)); err != nil {
+		t.Fatalf("failed to verify audit file: %v", err)
+	}
+
+	lines := bytes.SplitAfter(b, []byte("\n"))
+
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{
+			name: "edited",
+			b:    bytes.Replace(b, []byte(`"actor":"alice"`), []byte(`"actor":"bob"`), 1),
+		},
+		{
+			name: "removed",
+			b:    bytes.Join([][]byte{lines[0], lines[2], lines[3]}, nil),
+		},
+		{
+			name: "reordered",
+			b:    bytes.Join([][]byte{lines[1], lines[0], lines[2], lines[3]}, nil),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := VerifyAuditFile(bytes.NewReader(tt.b)); !errors.Is(err, ErrAuditChain) {
+				t.Fatalf("expected broken chain, but got: %v", err)
+			}
+		})
+	}
+}
+
+// An auditFunc adapts a function to an AuditSink.
+type auditFunc func(r AuditRecord) error
+
+func (fn auditFunc) Audit(r AuditRecord) error { return fn(r) }
@@ -0,0 +1,253 @@
+package wgctrl
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgstate"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Changes describes the differences between the configurations of two states
+// of a device, as produced by CompareDevices.
+type Changes struct {
+	// Fields are the changes to fields of the device itself.
+	Fields []FieldChange
+
+	// Added and Removed are the peers which were added to and removed from
+	// the device.
+	Added   []wgtypes.Peer
+	Removed []wgtypes.Peer
+
+	// Updated are the peers which exist in both states, but changed.
+	Updated []PeerChange
+
+	// Moved are the allowed IPs which were taken by one peer from another.
+	Moved []AllowedIPMove
+}
+
+// A FieldChange describes a change to a single field of a device or peer.
+type FieldChange struct {
+	// Field is the name of the field, as used by wg(8): "public-key",
+	// "listen-port", or "fwmark" for a device, and "preshared-key",
+	// "endpoint", "persistent-keepalive", or "allowed-ips" for a peer.
+	//
+	// A change of a device's private key is reported using its public key.
+	// Preshared keys are never revealed, and are reported as "(hidden)" or
+	// "(none)".
+	Field string
+
+	// Before and After are the formatted values of the field.
+	Before, After string
+}
+
+// A PeerChange describes the changes to an existing peer.
+type PeerChange struct {
+	PublicKey wgtypes.Key
+	Fields    []FieldChange
+}
+
+// An AllowedIPMove describes an allowed IP which was taken by one peer from
+// another.
+type AllowedIPMove struct {
+	Prefix   net.IPNet
+	From, To wgtypes.Key
+}
+
+// CompareDevices reports the differences between the configurations of two
+// states of a device. Statistics and handshakes are ignored.
+func CompareDevices(before, after *wgtypes.Device) *Changes {
+	var c Changes
+
+	c.Fields = appendChange(c.Fields, "public-key", keyValue(before.PublicKey), keyValue(after.PublicKey))
+	c.Fields = appendChange(c.Fields, "listen-port", strconv.Itoa(before.ListenPort), strconv.Itoa(after.ListenPort))
+	c.Fields = appendChange(c.Fields, "fwmark", fwmarkValue(before.FirewallMark), fwmarkValue(after.FirewallMark))
+
+	peers := make(map[wgtypes.Key]*wgtypes.Peer, len(after.Peers))
+	for i := range after.Peers {
+		peers[after.Peers[i].PublicKey] = &after.Peers[i]
+	}
+
+	// Note which peer owned each allowed IP beforehand, to find moves.
+	owners := make(map[string]wgtypes.Key)
+	old := make(map[wgtypes.Key]*wgtypes.Peer, len(before.Peers))
+	for i, p := range before.Peers {
+		old[p.PublicKey] = &before.Peers[i]
+		for _, ipn := range p.AllowedIPs {
+			pfx := wgstate.Prefix(ipn)
+			owners[pfx.String()] = p.PublicKey
+		}
+
+		if _, ok := peers[p.PublicKey]; !ok {
+			c.Removed = append(c.Removed, p)
+		}
+	}
+
+	for _, p := range after.Peers {
+		for _, ipn := range wgstate.SortedPrefixes(p.AllowedIPs) {
+			from, ok := owners[ipn.String()]
+			if ok && from != p.PublicKey {
+				c.Moved = append(c.Moved, AllowedIPMove{
+					Prefix: ipn,
+					From:   from,
+					To:     p.PublicKey,
+				})
+			}
+		}
+
+		op, ok := old[p.PublicKey]
+		if !ok {
+			c.Added = append(c.Added, p)
+			continue
+		}
+
+		if fields := comparePeers(op, &p); len(fields) > 0 {
+			c.Updated = append(c.Updated, PeerChange{
+				PublicKey: p.PublicKey,
+				Fields:    fields,
+			})
+		}
+	}
+
+	sort.SliceStable(c.Moved, func(i, j int) bool {
+		return c.Moved[i].Prefix.String() < c.Moved[j].Prefix.String()
+	})
+
+	return &c
+}
+
+// Empty reports whether no changes occurred.
+func (c *Changes) Empty() bool {
+	return len(c.Fields) == 0 && len(c.Added) == 0 && len(c.Removed) == 0 &&
+		len(c.Updated) == 0 && len(c.Moved) == 0
+}
+
+// Lines describes each change in a human-readable line, such as
+// "peer <key>: endpoint: 192.0.2.1:51820 -> 192.0.2.2:51820".
+func (c *Changes) Lines() []string {
+	var lines []string
+	for _, f := range c.Fields {
+		lines = append(lines, f.String())
+	}
+
+	for _, p := range c.Removed {
+		lines = append(lines, fmt.Sprintf("peer %s: removed", p.PublicKey))
+	}
+
+	for _, p := range c.Added {
+		lines = append(lines, fmt.Sprintf("peer %s: added", p.PublicKey))
+		for _, f := range comparePeers(&wgtypes.Peer{}, &p) {
+			lines = append(lines, fmt.Sprintf("peer %s: %s", p.PublicKey, f))
+		}
+	}
+
+	for _, p := range c.Updated {
+		for _, f := range p.Fields {
+			lines = append(lines, fmt.Sprintf("peer %s: %s", p.PublicKey, f))
+		}
+	}
+
+	for _, m := range c.Moved {
+		lines = append(lines, fmt.Sprintf("allowed IP %s: moved from peer %s to peer %s", &m.Prefix, m.From, m.To))
+	}
+
+	return lines
+}
+
+// String returns a human-readable description of a FieldChange.
+func (f FieldChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", f.Field, f.Before, f.After)
+}
+
+// comparePeers reports the changes to the fields of peer before.
+func comparePeers(before, after *wgtypes.Peer) []FieldChange {
+	var fs []FieldChange
+	fs = appendChange(fs, "preshared-key", secretValue(before), secretValue(after))
+
+	// Hidden preshared keys look the same, so note a change between two keys
+	// explicitly, unless either was redacted and cannot be compared.
+	redacted := before.PresharedKeyRedacted || after.PresharedKeyRedacted
+	if !redacted && before.PresharedKey != after.PresharedKey && len(fs) == 0 {
+		fs = append(fs, FieldChange{Field: "preshared-key", Before: "(hidden)", After: "(hidden, changed)"})
+	}
+
+	if !wgstate.SameEndpoint(before.Endpoint, after.Endpoint) {
+		fs = append(fs, FieldChange{
+			Field:  "endpoint",
+			Before: endpointValue(before.Endpoint),
+			After:  endpointValue(after.Endpoint),
+		})
+	}
+
+	fs = appendChange(fs, "persistent-keepalive",
+		keepaliveValue(before.PersistentKeepaliveInterval.Seconds()),
+		keepaliveValue(after.PersistentKeepaliveInterval.Seconds()))
+	fs = appendChange(fs, "allowed-ips", allowedIPsValue(before.AllowedIPs), allowedIPsValue(after.AllowedIPs))
+
+	return fs
+}
+
+// appendChange appends a FieldChange to fs if before and after differ.
+func appendChange(fs []FieldChange, field, before, after string) []FieldChange {
+	if before == after {
+		return fs
+	}
+
+	return append(fs, FieldChange{Field: field, Before: before, After: after})
+}
+
+func keyValue(k wgtypes.Key) string {
+	if k == (wgtypes.Key{}) {
+		return "(none)"
+	}
+
+	return k.String()
+}
+
+func secretValue(p *wgtypes.Peer) string {
+	if !wgstate.HasPresharedKey(p) {
+		return "(none)"
+	}
+
+	return "(hidden)"
+}
+
+func fwmarkValue(mark int) string {
+	if mark == 0 {
+		return "off"
+	}
+
+	return fmt.Sprintf("0x%x", mark)
+}
+
+func endpointValue(addr *net.UDPAddr) string {
+	if addr == nil {
+		return "(none)"
+	}
+
+	return addr.String()
+}
+
+func keepaliveValue(secs float64) string {
+	if secs == 0 {
+		return "off"
+	}
+
+	return strconv.Itoa(int(secs))
+}
+
+func allowedIPsValue(ipns []net.IPNet) string {
+	if len(ipns) == 0 {
+		return "(none)"
+	}
+
+	ss := make([]string, 0, len(ipns))
+	for _, ipn := range wgstate.SortedPrefixes(ipns) {
+		ss = append(ss, ipn.String())
+	}
+
+	return strings.Join(ss, ", ")
+}
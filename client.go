@@ -1,34 +1,213 @@
 package wgctrl
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"runtime"
+	"sync"
 
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgembed"
 	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wguser"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 // Expose an identical interface to the underlying packages.
 var _ wginternal.Client = &Client{}
 
-// A Client provides access to WireGuard device information.
+// A Client provides access to WireGuard device information. A Client is safe
+// for concurrent use by multiple goroutines.
 type Client struct {
 	// Seamlessly use different wginternal.Client implementations to provide an
 	// interface similar to wg(8).
 	cs []wginternal.Client
+
+	// embed manages WireGuard devices within this process. It is also present
+	// in cs so its devices are controlled like any others.
+	embed *wgembed.Client
+
+	// messages counts the messages sent to configure devices.
+	messages *messageCounter
+
+	// lock, if not nil, enables locking of devices while they are configured.
+	lock *LockOptions
+
+	// held counts the locks acquired by Lock which have not been released,
+	// by device name. Locks taken implicitly while configuring a device are
+	// not counted.
+	heldMu sync.Mutex
+	held   map[string]int
+
+	// implicit serializes the locks taken implicitly on each device by this
+	// Client, so that they wait for each other in-process rather than by
+	// polling the lock file.
+	implicitMu sync.Mutex
+	implicit   map[string]chan struct{}
+
+	// audit, if not nil, records each configuration on behalf of actor.
+	audit AuditSink
+	actor string
+}
+
+// Options specify optional configuration for a Client.
+type Options struct {
+	// SocketPolicy, if not nil, specifies which userspace device sockets the
+	// Client trusts. Sockets which do not satisfy the policy are refused with
+	// an error which can be checked using errors.Is and ErrUntrustedSocket,
+	// and are omitted from the output of Devices.
+	SocketPolicy *SocketPolicy
+
+	// Trace, if not nil, is called with the raw exchange between the Client
+	// and a device after each operation which communicates with a device.
+	// Private and preshared keys are redacted. Trace must be safe for
+	// concurrent use; a Recorder can be used to collect exchanges.
+	Trace func(ex WireExchange)
+
+	// Observer, if not nil, is notified as each operation against a device
+	// starts and ends.
+	Observer Observer
+
+	// EmbeddedOnly specifies that the Client only controls embedded devices
+	// created using CreateEmbeddedDevice, ignoring any devices owned by the
+	// operating system or other processes.
+	EmbeddedOnly bool
+
+	// Concurrency specifies the maximum number of devices which each backend
+	// retrieves at once in Devices. On Linux, each concurrent request to the
+	// kernel uses its own netlink socket. If zero, runtime.NumCPU is used. If
+	// 1, devices are retrieved one at a time.
+	Concurrency int
+
+	// Lock, if not nil, enables advisory locking of devices: each method
+	// which configures a device holds a lock on the device until it
+	// completes, including any reads of the device it performs. Other Clients
+	// which lock devices, including those in other processes, are excluded
+	// from configuring the device until the lock is released.
+	//
+	// Locking is advisory, and does not prevent tools such as wg(8) from
+	// configuring a device.
+	Lock *LockOptions
+
+	// Audit, if not nil, receives an AuditRecord after each attempt to
+	// configure a device by any method of the Client, including failed
+	// attempts. Actor identifies the user or component on whose behalf the
+	// Client configures devices, unless ConfigureDeviceAs is used.
+	Audit AuditSink
+	Actor string
+
+	// Remotes specifies remote hosts whose devices are controlled by the
+	// Client in addition to local devices, even if EmbeddedOnly is set. The
+	// devices of remote hosts are checked after local devices.
+	Remotes []RemoteOptions
+
+	// messages observes operations for each backend, set by NewWithOptions.
+	messages *messageCounter
+}
+
+// concurrency returns the concurrency limit for each backend.
+func (o *Options) concurrency() int {
+	if o.Concurrency == 0 {
+		return runtime.NumCPU()
+	}
+
+	return o.Concurrency
+}
+
+// tracer produces a wginternal.Tracer from o.Trace.
+func (o *Options) tracer() wginternal.Tracer {
+	if o.Trace == nil {
+		return nil
+	}
+
+	return func(ex wginternal.Exchange) {
+		o.Trace(WireExchange(ex))
+	}
+}
+
+// observer produces the wginternal.Observer for each backend, which also
+// notifies o.Observer.
+func (o *Options) observer() wginternal.Observer {
+	return o.messages
+}
+
+// userConfig produces the configuration for the userspace backend.
+func (o *Options) userConfig() *wguser.Config {
+	cfg := wguser.Config{
+		Trace:       o.tracer(),
+		Observer:    o.observer(),
+		Concurrency: o.concurrency(),
+	}
+	if p := o.SocketPolicy; p != nil {
+		cfg.Policy = &wguser.Policy{
+			UIDs:          p.UIDs,
+			GIDs:          p.GIDs,
+			ForbiddenMode: p.ForbiddenMode,
+			VerifyPeer:    p.VerifyPeer,
+		}
+	}
+
+	return &cfg
 }
 
 // New creates a new Client.
 func New() (*Client, error) {
-	cs, err := newClients()
+	return NewWithOptions(nil)
+}
+
+// NewWithOptions creates a new Client with optional configuration. If opts is
+// nil, a default configuration is used.
+func NewWithOptions(opts *Options) (*Client, error) {
+	// Copy opts so the caller's Options are not modified.
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	o.messages = newMessageCounter(o.Observer)
+	opts = &o
+
+	var cs []wginternal.Client
+	if !opts.EmbeddedOnly {
+		var err error
+		cs, err = newClients(opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Embedded devices are available on all platforms, and are checked after
+	// any devices owned by the operating system or other processes.
+	ec, err := wgembed.New(opts.tracer(), opts.observer())
+	if err != nil {
+		closeClients(cs)
+		return nil, err
+	}
+	cs = append(cs, ec)
+
+	rcs, err := remoteClients(opts)
 	if err != nil {
+		closeClients(cs)
 		return nil, err
 	}
 
 	return &Client{
-		cs: cs,
+		cs:       append(cs, rcs...),
+		embed:    ec,
+		messages: opts.messages,
+		lock:     opts.Lock,
+		audit:    opts.Audit,
+		actor:    opts.Actor,
 	}, nil
 }
 
+// closeClients closes each of cs after a failure to create a Client.
+func closeClients(cs []wginternal.Client) {
+	for _, c := range cs {
+		_ = c.Close()
+	}
+}
+
 // Close releases resources used by a Client.
 func (c *Client) Close() error {
 	for _, wgc := range c.cs {
@@ -40,16 +219,38 @@ func (c *Client) Close() error {
 	return nil
 }
 
-// Devices retrieves all WireGuard devices on this system.
+// Devices retrieves all WireGuard devices on this system. Each backend, and
+// up to Options.Concurrency devices within each backend, are queried at
+// once, but devices are always returned in the same order.
+//
+// If a device cannot be retrieved, an error is returned which can be inspected
+// using errors.As and OpError.
 func (c *Client) Devices() ([]*wgtypes.Device, error) {
+	type result struct {
+		devs []*wgtypes.Device
+		err  error
+	}
+
+	results := make([]result, len(c.cs))
+
+	var wg sync.WaitGroup
+	wg.Add(len(c.cs))
+	for i, wgc := range c.cs {
+		go func(i int, wgc wginternal.Client) {
+			defer wg.Done()
+			devs, err := wgc.Devices()
+			results[i] = result{devs: devs, err: err}
+		}(i, wgc)
+	}
+	wg.Wait()
+
 	var out []*wgtypes.Device
-	for _, wgc := range c.cs {
-		devs, err := wgc.Devices()
-		if err != nil {
-			return nil, err
+	for _, r := range results {
+		if r.err != nil {
+			return nil, wrapError(r.err)
 		}
 
-		out = append(out, devs...)
+		out = append(out, r.devs...)
 	}
 
 	return out, nil
@@ -58,7 +259,8 @@ func (c *Client) Devices() ([]*wgtypes.Device, error) {
 // Device retrieves a WireGuard device by its interface name.
 //
 // If the device specified by name does not exist or is not a WireGuard device,
-// an error is returned which can be checked using os.IsNotExist.
+// an error is returned which can be checked using os.IsNotExist. Other
+// failures return an error which can be inspected using errors.As and OpError.
 func (c *Client) Device(name string) (*wgtypes.Device, error) {
 	for _, wgc := range c.cs {
 		d, err := wgc.Device(name)
@@ -68,7 +270,7 @@ func (c *Client) Device(name string) (*wgtypes.Device, error) {
 		case os.IsNotExist(err):
 			continue
 		default:
-			return nil, err
+			return nil, wrapError(err)
 		}
 	}
 
@@ -82,8 +284,74 @@ func (c *Client) Device(name string) (*wgtypes.Device, error) {
 // configuring a device.
 //
 // If the device specified by name does not exist or is not a WireGuard device,
-// an error is returned which can be checked using os.IsNotExist.
+// an error is returned which can be checked using os.IsNotExist. If the
+// device's driver is read-only, an error is returned which can be checked
+// using errors.Is and ErrReadOnly. Other failures return an error which can be
+// inspected using errors.As and OpError.
+//
+// If locking is enabled by Options.Lock, the device is locked while it is
+// configured; see Lock for the errors which can result. If an audit sink is
+// set by Options.Audit, the configuration is recorded with Options.Actor as
+// its actor.
 func (c *Client) ConfigureDevice(name string, cfg wgtypes.Config) error {
+	return c.withLock(name, func() error {
+		return c.configureDevice(name, cfg)
+	})
+}
+
+// ConfigureDeviceAs configures a WireGuard device by its interface name, as
+// with ConfigureDevice, but records actor, rather than Options.Actor, as the
+// actor responsible for the configuration with the audit sink set by
+// Options.Audit.
+func (c *Client) ConfigureDeviceAs(actor, name string, cfg wgtypes.Config) error {
+	return c.withLock(name, func() error {
+		return c.configureAs(actor, name, cfg)
+	})
+}
+
+// configureDevice implements ConfigureDevice without locking the device.
+func (c *Client) configureDevice(name string, cfg wgtypes.Config) error {
+	return c.configureAs(c.actor, name, cfg)
+}
+
+// configureAs configures a device on behalf of actor, and records the result
+// with the audit sink, if any.
+func (c *Client) configureAs(actor, name string, cfg wgtypes.Config) error {
+	if c.audit == nil {
+		return c.configure(name, cfg)
+	}
+
+	// Retrieve the device before and after so the record describes what
+	// changed, rather than what was requested.
+	before, _ := c.Device(name)
+	err := c.configure(name, cfg)
+
+	var after *wgtypes.Device
+	if before != nil {
+		after, _ = c.Device(name)
+	}
+
+	return c.record(actor, name, before, after, err)
+}
+
+// record sends the AuditRecord for an attempt to configure a device to the
+// audit sink, if any, and returns err, the result of the attempt. If err is
+// nil but the record fails, an error is returned.
+func (c *Client) record(actor, name string, before, after *wgtypes.Device, err error) error {
+	if c.audit == nil {
+		return err
+	}
+
+	if aerr := c.audit.Audit(newAuditRecord(actor, name, before, after, err)); aerr != nil && err == nil {
+		return fmt.Errorf("wgctrl: device %q was configured, but the audit record failed: %w", name, aerr)
+	}
+
+	return err
+}
+
+// configure applies cfg to the device specified by name using the first
+// backend which has the device.
+func (c *Client) configure(name string, cfg wgtypes.Config) error {
 	for _, wgc := range c.cs {
 		err := wgc.ConfigureDevice(name, cfg)
 		switch {
@@ -92,9 +360,126 @@ func (c *Client) ConfigureDevice(name string, cfg wgtypes.Config) error {
 		case os.IsNotExist(err):
 			continue
 		default:
-			return err
+			return wrapError(err)
 		}
 	}
 
 	return os.ErrNotExist
 }
+
+// Capabilities reports the optional operations supported by a WireGuard
+// device, such as whether it can be configured, so that callers can choose
+// how to manage a device before attempting to do so.
+//
+// If the device specified by name does not exist or is not a WireGuard device,
+// an error is returned which can be checked using os.IsNotExist.
+func (c *Client) Capabilities(name string) (*wgtypes.Capabilities, error) {
+	for _, wgc := range c.cs {
+		caps, err := wgc.Capabilities(name)
+		switch {
+		case err == nil:
+			return caps, nil
+		case os.IsNotExist(err):
+			continue
+		default:
+			return nil, wrapError(err)
+		}
+	}
+
+	return nil, os.ErrNotExist
+}
+
+// A DeviceEventOp is the kind of change reported by a DeviceEvent.
+type DeviceEventOp int
+
+// Possible DeviceEventOp values.
+const (
+	_ DeviceEventOp = iota
+	DeviceAppeared
+	DeviceDisappeared
+)
+
+// String returns the string representation of a DeviceEventOp.
+func (op DeviceEventOp) String() string {
+	switch op {
+	case DeviceAppeared:
+		return "appeared"
+	case DeviceDisappeared:
+		return "disappeared"
+	default:
+		return "unknown"
+	}
+}
+
+// A DeviceEvent reports that a WireGuard device has appeared or disappeared.
+type DeviceEvent struct {
+	// Name is the name of the device.
+	Name string
+
+	// Type specifies the underlying implementation of the device.
+	Type wgtypes.DeviceType
+
+	// Op specifies whether the device appeared or disappeared.
+	Op DeviceEventOp
+}
+
+// WatchDevices returns a channel which receives a DeviceEvent each time a
+// WireGuard device appears or disappears. The channel is closed when ctx is
+// canceled or the Client is closed. Callers must receive events promptly, as
+// a slow receiver delays events for all callers.
+//
+// Currently, only userspace devices on Linux can be watched. If no devices on
+// this system can be watched, an error is returned which can be checked using
+// errors.Is and ErrNotSupported.
+func (c *Client) WatchDevices(ctx context.Context) (<-chan DeviceEvent, error) {
+	// Stop any partially started watches if an error occurs.
+	ctx, cancel := context.WithCancel(ctx)
+
+	var chs []<-chan wginternal.Event
+	for _, wgc := range c.cs {
+		w, ok := wgc.(wginternal.Watcher)
+		if !ok {
+			continue
+		}
+
+		ch, err := w.Watch(ctx)
+		switch {
+		case err == nil:
+			chs = append(chs, ch)
+		case errors.Is(err, wginternal.ErrNotSupported):
+			continue
+		default:
+			cancel()
+			return nil, err
+		}
+	}
+
+	if len(chs) == 0 {
+		cancel()
+		return nil, ErrNotSupported
+	}
+
+	// Merge events from each backend into a single channel.
+	out := make(chan DeviceEvent)
+	var wg sync.WaitGroup
+	wg.Add(len(chs))
+	for _, ch := range chs {
+		go func(ch <-chan wginternal.Event) {
+			defer wg.Done()
+			for ev := range ch {
+				select {
+				case out <- DeviceEvent{Name: ev.Name, Type: ev.Type, Op: DeviceEventOp(ev.Op)}:
+				case <-ctx.Done():
+				}
+			}
+		}(ch)
+	}
+
+	go func() {
+		defer cancel()
+		wg.Wait()
+		close(out)
+	}()
+
+	return out, nil
+}
@@ -1,6 +1,7 @@
 package wgctrl_test
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -11,8 +12,8 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/mikioh/ipaddr"
 	"golang.zx2c4.com/wireguard/wgctrl"
-	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
 	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgharness"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
@@ -28,6 +29,31 @@ func TestIntegrationClient(t *testing.T) {
 		t.Skipf("skipping, failed to get devices: %v", err)
 	}
 
+	testIntegrationDevices(t, c, devices)
+}
+
+func TestIntegrationClientHarness(t *testing.T) {
+	// The harness runs devices within this process and requires no
+	// privileges, so it is safe to run without confirmation.
+	nw, err := wgharness.New(1, nil)
+	if err != nil {
+		t.Fatalf("failed to create harness network: %v", err)
+	}
+	defer nw.Close()
+
+	n := nw.Nodes[0]
+	d, err := n.Device()
+	if err != nil {
+		t.Fatalf("failed to get harness device: %v", err)
+	}
+
+	testIntegrationDevices(t, n.Client, []*wgtypes.Device{d})
+}
+
+// testIntegrationDevices runs the integration tests against each of devices.
+func testIntegrationDevices(t *testing.T, c *wgctrl.Client, devices []*wgtypes.Device) {
+	t.Helper()
+
 	tests := []struct {
 		name string
 		fn   func(t *testing.T, c *wgctrl.Client, d *wgtypes.Device)
@@ -393,7 +419,7 @@ func tryConfigure(t *testing.T, c *wgctrl.Client, device string, cfg wgtypes.Con
 	t.Helper()
 
 	if err := c.ConfigureDevice(device, cfg); err != nil {
-		if err == wginternal.ErrReadOnly {
+		if errors.Is(err, wgctrl.ErrReadOnly) {
 			t.Skipf("skipping, device %q implementation is read-only", device)
 		}
 
@@ -1,6 +1,7 @@
 package wgctrl
 
 import (
+	"context"
 	"errors"
 	"os"
 	"testing"
@@ -224,11 +225,156 @@ func TestClientConfigureDevice(t *testing.T) {
 	}
 }
 
+func TestClientCapabilities(t *testing.T) {
+	want := &wgtypes.Capabilities{
+		Backend:   "wguser",
+		Type:      wgtypes.Userspace,
+		Supported: wgtypes.CapabilityConfigure | wgtypes.CapabilityWatch,
+	}
+
+	c := &Client{
+		cs: []wginternal.Client{
+			&testClient{
+				CapabilitiesFunc: func(_ string) (*wgtypes.Capabilities, error) {
+					return nil, os.ErrNotExist
+				},
+			},
+			&testClient{
+				CapabilitiesFunc: func(name string) (*wgtypes.Capabilities, error) {
+					if name != "wg0" {
+						return nil, os.ErrNotExist
+					}
+
+					return want, nil
+				},
+			},
+		},
+	}
+
+	caps, err := c.Capabilities("wg0")
+	if err != nil {
+		t.Fatalf("failed to get capabilities: %v", err)
+	}
+
+	if diff := cmp.Diff(want, caps); diff != "" {
+		t.Fatalf("unexpected capabilities (-want +got):\n%s", diff)
+	}
+
+	if !caps.Has(wgtypes.CapabilityConfigure) || caps.Has(wgtypes.CapabilityConfigure|wgtypes.CapabilityCreate) {
+		t.Fatalf("unexpected result from Has for capabilities: %s", caps.Supported)
+	}
+
+	if _, err := c.Capabilities("wg1"); !os.IsNotExist(err) {
+		t.Fatalf("expected is not exist error, but got: %v", err)
+	}
+}
+
+func TestClientOpError(t *testing.T) {
+	c := &Client{
+		cs: []wginternal.Client{&testClient{
+			ConfigureDeviceFunc: func(name string, _ wgtypes.Config) error {
+				return wginternal.WrapError("wgtest", wginternal.OpSet, name, ErrReadOnly)
+			},
+		}},
+	}
+
+	err := c.ConfigureDevice("wg0", wgtypes.Config{})
+	if !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected read-only error, but got: %v", err)
+	}
+
+	var oerr *OpError
+	if !errors.As(err, &oerr) {
+		t.Fatalf("expected OpError, but got: %T", err)
+	}
+
+	want := OpError{
+		Backend: "wgtest",
+		Op:      "set",
+		Device:  "wg0",
+		Err:     ErrReadOnly,
+	}
+
+	if diff := cmp.Diff(want, *oerr, cmpErrors); diff != "" {
+		t.Fatalf("unexpected OpError (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff("wgtest: set wg0: driver is read-only", err.Error()); diff != "" {
+		t.Fatalf("unexpected error string (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientWatchDevices(t *testing.T) {
+	ev := wginternal.Event{
+		Name: "wg0",
+		Type: wgtypes.Userspace,
+		Op:   wginternal.EventAppeared,
+	}
+
+	c := &Client{
+		cs: []wginternal.Client{
+			// Clients which cannot watch devices are skipped.
+			&testClient{},
+			&testWatcher{
+				WatchFunc: func(_ context.Context) (<-chan wginternal.Event, error) {
+					return nil, wginternal.ErrNotSupported
+				},
+			},
+			&testWatcher{
+				WatchFunc: func(ctx context.Context) (<-chan wginternal.Event, error) {
+					ch := make(chan wginternal.Event, 1)
+					ch <- ev
+					go func() {
+						<-ctx.Done()
+						close(ch)
+					}()
+
+					return ch, nil
+				},
+			},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := c.WatchDevices(ctx)
+	if err != nil {
+		t.Fatalf("failed to watch devices: %v", err)
+	}
+
+	want := DeviceEvent{
+		Name: "wg0",
+		Type: wgtypes.Userspace,
+		Op:   DeviceAppeared,
+	}
+
+	if diff := cmp.Diff(want, <-events); diff != "" {
+		t.Fatalf("unexpected event (-want +got):\n%s", diff)
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Fatal("expected events channel to be closed")
+	}
+}
+
+func TestClientWatchDevicesNotSupported(t *testing.T) {
+	c := &Client{
+		cs: []wginternal.Client{&testClient{}},
+	}
+
+	if _, err := c.WatchDevices(context.Background()); !errors.Is(err, wginternal.ErrNotSupported) {
+		t.Fatalf("expected not supported error, but got: %v", err)
+	}
+}
+
 type testClient struct {
 	CloseFunc           func() error
 	DevicesFunc         func() ([]*wgtypes.Device, error)
 	DeviceFunc          func(name string) (*wgtypes.Device, error)
 	ConfigureDeviceFunc func(name string, cfg wgtypes.Config) error
+	CapabilitiesFunc    func(name string) (*wgtypes.Capabilities, error)
 }
 
 func (c *testClient) Close() error                        { return c.CloseFunc() }
@@ -239,3 +385,15 @@ func (c *testClient) Device(name string) (*wgtypes.Device, error) {
 func (c *testClient) ConfigureDevice(name string, cfg wgtypes.Config) error {
 	return c.ConfigureDeviceFunc(name, cfg)
 }
+func (c *testClient) Capabilities(name string) (*wgtypes.Capabilities, error) {
+	return c.CapabilitiesFunc(name)
+}
+
+type testWatcher struct {
+	testClient
+	WatchFunc func(ctx context.Context) (<-chan wginternal.Event, error)
+}
+
+func (c *testWatcher) Watch(ctx context.Context) (<-chan wginternal.Event, error) {
+	return c.WatchFunc(ctx)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// cmdSetconf implements "wgctrl setconf".
+func cmdSetconf(c *wgctrl.Client, args []string) error {
+	return configureFromFile(c, args, func(_ *wgtypes.Device, cfg *wgtypes.Config) {
+		resetConfig(cfg)
+		cfg.ReplacePeers = true
+	})
+}
+
+// cmdAddconf implements "wgctrl addconf".
+func cmdAddconf(c *wgctrl.Client, args []string) error {
+	return configureFromFile(c, args, nil)
+}
+
+// cmdSyncconf implements "wgctrl syncconf".
+func cmdSyncconf(c *wgctrl.Client, args []string) error {
+	return configureFromFile(c, args, syncConfig)
+}
+
+// configureFromFile reads the configuration file named by args and applies it
+// to the device named by args, after an optional adjustment by fn.
+func configureFromFile(c *wgctrl.Client, args []string, fn func(d *wgtypes.Device, cfg *wgtypes.Config)) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	device, file := args[0], args[1]
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cfg, err := parseConfig(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+
+	if fn != nil {
+		d, err := c.Device(device)
+		if err != nil {
+			return fmt.Errorf("failed to get device %q: %v", device, err)
+		}
+
+		fn(d, cfg)
+	}
+
+	if err := c.ConfigureDevice(device, *cfg); err != nil {
+		return fmt.Errorf("failed to configure device %q: %v", device, err)
+	}
+
+	return nil
+}
+
+// resetConfig sets the interface options which are absent from a
+// configuration file to their zero values, as wg(8) does for setconf and
+// syncconf: a missing private key is removed, and a missing listen port or
+// firewall mark is reset.
+func resetConfig(cfg *wgtypes.Config) {
+	if cfg.PrivateKey == nil {
+		cfg.PrivateKey = new(wgtypes.Key)
+	}
+	if cfg.ListenPort == nil {
+		cfg.ListenPort = new(int)
+	}
+	if cfg.FirewallMark == nil {
+		cfg.FirewallMark = new(int)
+	}
+}
+
+// syncConfig adjusts cfg so that applying it to d makes d match cfg exactly,
+// without disturbing the sessions of peers which remain in place.
+func syncConfig(d *wgtypes.Device, cfg *wgtypes.Config) {
+	resetConfig(cfg)
+
+	keep := make(map[wgtypes.Key]struct{}, len(cfg.Peers))
+	for i := range cfg.Peers {
+		p := &cfg.Peers[i]
+		keep[p.PublicKey] = struct{}{}
+
+		// Options which are absent from the file are cleared, rather than
+		// left as they are.
+		if p.PresharedKey == nil {
+			p.PresharedKey = new(wgtypes.Key)
+		}
+		if p.PersistentKeepaliveInterval == nil {
+			p.PersistentKeepaliveInterval = new(time.Duration)
+		}
+	}
+
+	for _, p := range d.Peers {
+		if _, ok := keep[p.PublicKey]; ok {
+			continue
+		}
+
+		cfg.Peers = append(cfg.Peers, wgtypes.PeerConfig{
+			PublicKey: p.PublicKey,
+			Remove:    true,
+		})
+	}
+}
+
+// parseConfig parses a wg(8) configuration file. As with wg(8), the allowed
+// IPs of each peer in the file replace those of the existing peer.
+func parseConfig(r io.Reader) (*wgtypes.Config, error) {
+	var (
+		cfg     wgtypes.Config
+		section string
+		peer    *wgtypes.PeerConfig
+	)
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i != -1 {
+			line = line[:i]
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			switch section {
+			case "interface":
+			case "peer":
+				cfg.Peers = append(cfg.Peers, wgtypes.PeerConfig{ReplaceAllowedIPs: true})
+				peer = &cfg.Peers[len(cfg.Peers)-1]
+			default:
+				return nil, fmt.Errorf("line %d: unknown section %q", n, line)
+			}
+
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("line %d: expected key = value, but got %q", n, line)
+		}
+
+		key, value := strings.ToLower(strings.TrimSpace(kv[0])), strings.TrimSpace(kv[1])
+
+		var err error
+		switch section {
+		case "interface":
+			err = parseInterfaceOption(&cfg, key, value)
+		case "peer":
+			err = parsePeerOption(peer, key, value)
+		default:
+			err = fmt.Errorf("option %q outside of a section", kv[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+
+		// Peers with the same public key would be merged by the device, so
+		// reject them in the same way as a missing public key.
+		if section == "peer" && key == "publickey" {
+			for _, p := range cfg.Peers[:len(cfg.Peers)-1] {
+				if p.PublicKey == peer.PublicKey {
+					return nil, fmt.Errorf("line %d: duplicate peer %s", n, peer.PublicKey)
+				}
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, p := range cfg.Peers {
+		if p.PublicKey == (wgtypes.Key{}) {
+			return nil, fmt.Errorf("peer %d: missing public key", i+1)
+		}
+	}
+
+	return &cfg, nil
+}
+
+// parseInterfaceOption parses an option in an [Interface] section.
+func parseInterfaceOption(cfg *wgtypes.Config, key, value string) error {
+	switch key {
+	case "privatekey":
+		k, err := parseKey(value)
+		if err != nil {
+			return err
+		}
+		cfg.PrivateKey = &k
+	case "listenport":
+		port, err := parsePort(value)
+		if err != nil {
+			return err
+		}
+		cfg.ListenPort = &port
+	case "fwmark":
+		mark, err := parseFwmark(value)
+		if err != nil {
+			return err
+		}
+		cfg.FirewallMark = &mark
+	default:
+		return fmt.Errorf("unknown interface option %q", key)
+	}
+
+	return nil
+}
+
+// parsePeerOption parses an option in a [Peer] section.
+func parsePeerOption(p *wgtypes.PeerConfig, key, value string) error {
+	switch key {
+	case "publickey":
+		k, err := parseKey(value)
+		if err != nil {
+			return err
+		}
+		p.PublicKey = k
+	case "presharedkey":
+		k, err := parseKey(value)
+		if err != nil {
+			return err
+		}
+		p.PresharedKey = &k
+	case "allowedips":
+		ips, err := parseAllowedIPs(value)
+		if err != nil {
+			return err
+		}
+		p.AllowedIPs = append(p.AllowedIPs, ips...)
+	case "endpoint":
+		addr, err := parseEndpoint(value)
+		if err != nil {
+			return err
+		}
+		p.Endpoint = addr
+	case "persistentkeepalive":
+		d, err := parseKeepalive(value)
+		if err != nil {
+			return err
+		}
+		p.PersistentKeepaliveInterval = &d
+	default:
+		return fmt.Errorf("unknown peer option %q", key)
+	}
+
+	return nil
+}
+
+// writeConfig writes the configuration of d in the wg(8) configuration file
+// format.
+func writeConfig(w io.Writer, d *wgtypes.Device) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "[Interface]")
+	if d.ListenPort != 0 {
+		fmt.Fprintf(bw, "ListenPort = %d\n", d.ListenPort)
+	}
+	if d.FirewallMark != 0 {
+		fmt.Fprintf(bw, "FwMark = 0x%x\n", d.FirewallMark)
+	}
+	if d.PrivateKey != (wgtypes.Key{}) {
+		fmt.Fprintf(bw, "PrivateKey = %s\n", d.PrivateKey)
+	}
+
+	for _, p := range d.Peers {
+		fmt.Fprintln(bw)
+		fmt.Fprintln(bw, "[Peer]")
+		fmt.Fprintf(bw, "PublicKey = %s\n", p.PublicKey)
+		if p.PresharedKey != (wgtypes.Key{}) {
+			fmt.Fprintf(bw, "PresharedKey = %s\n", p.PresharedKey)
+		}
+		if len(p.AllowedIPs) > 0 {
+			fmt.Fprintf(bw, "AllowedIPs = %s\n", ipsString(p.AllowedIPs))
+		}
+		if p.Endpoint != nil {
+			fmt.Fprintf(bw, "Endpoint = %s\n", p.Endpoint)
+		}
+		if p.PersistentKeepaliveInterval != 0 {
+			fmt.Fprintf(bw, "PersistentKeepalive = %d\n", int(p.PersistentKeepaliveInterval.Seconds()))
+		}
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestParseConfig(t *testing.T) {
+	var (
+		priv = wgtest.MustPrivateKey()
+		pub  = wgtest.MustPublicKey()
+		psk  = wgtest.MustPresharedKey()
+
+		port  = 51820
+		mark  = 0x10
+		keep  = 25 * time.Second
+		noips []net.IPNet
+	)
+
+	tests := []struct {
+		name string
+		in   string
+		cfg  *wgtypes.Config
+		ok   bool
+	}{
+		{
+			name: "option outside section",
+			in:   "ListenPort = 1",
+		},
+		{
+			name: "unknown section",
+			in:   "[Foo]",
+		},
+		{
+			name: "unknown option",
+			in:   "[Interface]\nAddress = 192.0.2.1/24",
+		},
+		{
+			name: "no public key",
+			in:   "[Peer]\nAllowedIPs = 192.0.2.0/24",
+		},
+		{
+			name: "duplicate peer",
+			in:   "[Peer]\nPublicKey = " + pub.String() + "\n[Peer]\nPublicKey = " + pub.String(),
+		},
+		{
+			name: "bad port",
+			in:   "[Interface]\nListenPort = 65536",
+		},
+		{
+			name: "empty",
+			cfg:  &wgtypes.Config{},
+			ok:   true,
+		},
+		{
+			name: "OK",
+			in: `
+# A comment.
+[Interface]
+PrivateKey = ` + priv.String() + `
+listenport=51820 # Keys are case-insensitive.
+FwMark = 0x10
+
+[Peer]
+PublicKey = ` + pub.String() + `
+PresharedKey = ` + psk.String() + `
+AllowedIPs = 192.0.2.0/24, 2001:db8::1
+AllowedIPs = 198.51.100.1
+Endpoint = [2001:db8::2]:51820
+PersistentKeepalive = 25
+
+[Peer]
+PublicKey = ` + priv.PublicKey().String() + `
+`,
+			cfg: &wgtypes.Config{
+				PrivateKey:   &priv,
+				ListenPort:   &port,
+				FirewallMark: &mark,
+				Peers: []wgtypes.PeerConfig{
+					{
+						PublicKey:    pub,
+						PresharedKey: &psk,
+						Endpoint: &net.UDPAddr{
+							IP:   net.ParseIP("2001:db8::2"),
+							Port: 51820,
+						},
+						PersistentKeepaliveInterval: &keep,
+						ReplaceAllowedIPs:           true,
+						AllowedIPs: []net.IPNet{
+							wgtest.MustCIDR("192.0.2.0/24"),
+							wgtest.MustCIDR("2001:db8::1/128"),
+							wgtest.MustCIDR("198.51.100.1/32"),
+						},
+					},
+					{
+						PublicKey:         priv.PublicKey(),
+						ReplaceAllowedIPs: true,
+						AllowedIPs:        noips,
+					},
+				},
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfig(strings.NewReader(tt.in))
+			if tt.ok && err != nil {
+				t.Fatalf("failed to parse config: %v", err)
+			}
+			if !tt.ok {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+
+				return
+			}
+
+			if diff := cmp.Diff(tt.cfg, cfg); diff != "" {
+				t.Fatalf("unexpected Config (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteConfigRoundTrip(t *testing.T) {
+	var (
+		priv = wgtest.MustPrivateKey()
+		pub  = wgtest.MustPublicKey()
+		psk  = wgtest.MustPresharedKey()
+	)
+
+	d := &wgtypes.Device{
+		PrivateKey:   priv,
+		ListenPort:   51820,
+		FirewallMark: 0x10,
+		Peers: []wgtypes.Peer{{
+			PublicKey:    pub,
+			PresharedKey: psk,
+			Endpoint: &net.UDPAddr{
+				IP:   net.IPv4(192, 0, 2, 1).To4(),
+				Port: 51820,
+			},
+			PersistentKeepaliveInterval: 25 * time.Second,
+			AllowedIPs: []net.IPNet{
+				wgtest.MustCIDR("192.0.2.0/24"),
+				wgtest.MustCIDR("2001:db8::/32"),
+			},
+		}},
+	}
+
+	var b bytes.Buffer
+	if err := writeConfig(&b, d); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cfg, err := parseConfig(&b)
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+
+	var (
+		port = d.ListenPort
+		mark = d.FirewallMark
+		keep = d.Peers[0].PersistentKeepaliveInterval
+	)
+
+	want := &wgtypes.Config{
+		PrivateKey:   &priv,
+		ListenPort:   &port,
+		FirewallMark: &mark,
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey:                   pub,
+			PresharedKey:                &psk,
+			Endpoint:                    d.Peers[0].Endpoint,
+			PersistentKeepaliveInterval: &keep,
+			ReplaceAllowedIPs:           true,
+			AllowedIPs:                  d.Peers[0].AllowedIPs,
+		}},
+	}
+
+	if diff := cmp.Diff(want, cfg); diff != "" {
+		t.Fatalf("unexpected Config (-want +got):\n%s", diff)
+	}
+}
+
+func Test_syncConfig(t *testing.T) {
+	var (
+		keep    = wgtest.MustPublicKey()
+		drop    = wgtest.MustPublicKey()
+		zeroKey wgtypes.Key
+		zeroDur time.Duration
+		zeroInt int
+		port    = 51820
+	)
+
+	d := &wgtypes.Device{
+		Peers: []wgtypes.Peer{
+			{PublicKey: keep},
+			{PublicKey: drop},
+		},
+	}
+
+	// Interface options absent from the file are reset, as with wg(8).
+	cfg := &wgtypes.Config{
+		ListenPort: &port,
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey:         keep,
+			ReplaceAllowedIPs: true,
+		}},
+	}
+
+	syncConfig(d, cfg)
+
+	want := &wgtypes.Config{
+		PrivateKey:   &zeroKey,
+		ListenPort:   &port,
+		FirewallMark: &zeroInt,
+		Peers: []wgtypes.PeerConfig{
+			{
+				PublicKey:                   keep,
+				PresharedKey:                &zeroKey,
+				PersistentKeepaliveInterval: &zeroDur,
+				ReplaceAllowedIPs:           true,
+			},
+			{
+				PublicKey: drop,
+				Remove:    true,
+			},
+		},
+	}
+
+	if diff := cmp.Diff(want, cfg); diff != "" {
+		t.Fatalf("unexpected Config (-want +got):\n%s", diff)
+	}
+}
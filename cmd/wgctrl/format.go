@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// A printer writes devices to w for "wgctrl show". all reports whether the
+// user asked for all devices, rather than a single named device.
+type printer func(w io.Writer, devices []*wgtypes.Device, all bool) error
+
+// parseFormat produces a printer for the --format flag. resolve specifies
+// whether the pretty format uses reverse DNS to name endpoints.
+func parseFormat(format string, resolve bool) (printer, error) {
+	switch format {
+	case "pretty":
+		pp := newPretty()
+		if resolve {
+			pp.lookup = newResolver().lookup
+		}
+
+		return pp.print, nil
+	case "json":
+		return printJSON, nil
+	case "dump":
+		return fieldPrinter(fieldDump), nil
+	}
+
+	const prefix = "template="
+	if !strings.HasPrefix(format, prefix) {
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+
+	tmpl, err := template.New("show").Parse(strings.TrimPrefix(format, prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	return func(w io.Writer, devices []*wgtypes.Device, _ bool) error {
+		for _, d := range devices {
+			if err := tmpl.Execute(w, d); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, nil
+}
+
+// hideKeys reports whether private and preshared keys should be hidden from
+// human and JSON output. As with wg(8), keys are hidden unless WG_HIDE_KEYS
+// is set to "never".
+func hideKeys() bool {
+	return os.Getenv("WG_HIDE_KEYS") != "never"
+}
+
+// JSON representations of wgtypes.Device and wgtypes.Peer.
+type (
+	jsonDevice struct {
+		Name         string     `json:"name"`
+		Type         string     `json:"type"`
+		PublicKey    string     `json:"public_key"`
+		PrivateKey   string     `json:"private_key,omitempty"`
+		ListenPort   int        `json:"listen_port"`
+		FirewallMark int        `json:"fwmark"`
+		Peers        []jsonPeer `json:"peers"`
+	}
+
+	jsonPeer struct {
+		PublicKey                   string     `json:"public_key"`
+		HasPresharedKey             bool       `json:"has_preshared_key"`
+		PresharedKey                string     `json:"preshared_key,omitempty"`
+		Endpoint                    string     `json:"endpoint,omitempty"`
+		AllowedIPs                  []string   `json:"allowed_ips"`
+		LastHandshakeTime           *time.Time `json:"latest_handshake"`
+		ReceiveBytes                int64      `json:"transfer_rx"`
+		TransmitBytes               int64      `json:"transfer_tx"`
+		PersistentKeepaliveInterval int        `json:"persistent_keepalive"`
+		ProtocolVersion             int        `json:"protocol_version"`
+	}
+)
+
+// printJSON prints a single device as a JSON object, or all devices as a JSON
+// array.
+func printJSON(w io.Writer, devices []*wgtypes.Device, all bool) error {
+	hide := hideKeys()
+
+	jds := make([]jsonDevice, 0, len(devices))
+	for _, d := range devices {
+		jds = append(jds, newJSONDevice(d, hide))
+	}
+
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+
+	if !all && len(jds) == 1 {
+		return e.Encode(jds[0])
+	}
+
+	return e.Encode(jds)
+}
+
+// newJSONDevice produces a jsonDevice from d, optionally hiding secret keys.
+func newJSONDevice(d *wgtypes.Device, hide bool) jsonDevice {
+	jd := jsonDevice{
+		Name:         d.Name,
+		Type:         d.Type.String(),
+		PublicKey:    d.PublicKey.String(),
+		ListenPort:   d.ListenPort,
+		FirewallMark: d.FirewallMark,
+		Peers:        make([]jsonPeer, 0, len(d.Peers)),
+	}
+
+	if !hide && d.PrivateKey != (wgtypes.Key{}) {
+		jd.PrivateKey = d.PrivateKey.String()
+	}
+
+	for _, p := range d.Peers {
+		jp := jsonPeer{
+			PublicKey:                   p.PublicKey.String(),
+			HasPresharedKey:             p.PresharedKey != (wgtypes.Key{}) || p.PresharedKeyRedacted,
+			AllowedIPs:                  make([]string, 0, len(p.AllowedIPs)),
+			ReceiveBytes:                p.ReceiveBytes,
+			TransmitBytes:               p.TransmitBytes,
+			PersistentKeepaliveInterval: int(p.PersistentKeepaliveInterval.Seconds()),
+			ProtocolVersion:             p.ProtocolVersion,
+		}
+
+		if !hide && p.PresharedKey != (wgtypes.Key{}) {
+			jp.PresharedKey = p.PresharedKey.String()
+		}
+		if p.Endpoint != nil {
+			jp.Endpoint = p.Endpoint.String()
+		}
+		for _, ipn := range p.AllowedIPs {
+			jp.AllowedIPs = append(jp.AllowedIPs, ipn.String())
+		}
+		if !p.LastHandshakeTime.IsZero() {
+			t := p.LastHandshakeTime.UTC()
+			jp.LastHandshakeTime = &t
+		}
+
+		jd.Peers = append(jd.Peers, jp)
+	}
+
+	return jd
+}
+
+// Fields which may be queried using "wgctrl show <interface> <field>".
+const (
+	fieldPublicKey           = "public-key"
+	fieldPrivateKey          = "private-key"
+	fieldListenPort          = "listen-port"
+	fieldFwmark              = "fwmark"
+	fieldPeers               = "peers"
+	fieldPresharedKeys       = "preshared-keys"
+	fieldEndpoints           = "endpoints"
+	fieldAllowedIPs          = "allowed-ips"
+	fieldLatestHandshakes    = "latest-handshakes"
+	fieldPersistentKeepalive = "persistent-keepalive"
+	fieldTransfer            = "transfer"
+	fieldDump                = "dump"
+)
+
+// fields are the device and peer values produced by each field, in the same
+// tab-separated form as wg(8).
+var fields = map[string]struct {
+	device func(d *wgtypes.Device) []string
+	peer   func(p *wgtypes.Peer) []string
+}{
+	fieldPublicKey: {
+		device: func(d *wgtypes.Device) []string { return []string{keyString(d.PublicKey)} },
+	},
+	fieldPrivateKey: {
+		device: func(d *wgtypes.Device) []string { return []string{privateKeyString(d)} },
+	},
+	fieldListenPort: {
+		device: func(d *wgtypes.Device) []string { return []string{strconv.Itoa(d.ListenPort)} },
+	},
+	fieldFwmark: {
+		device: func(d *wgtypes.Device) []string { return []string{fwmarkString(d.FirewallMark)} },
+	},
+	fieldPeers: {
+		peer: func(p *wgtypes.Peer) []string { return []string{p.PublicKey.String()} },
+	},
+	fieldPresharedKeys: {
+		peer: func(p *wgtypes.Peer) []string { return []string{p.PublicKey.String(), presharedKeyString(p)} },
+	},
+	fieldEndpoints: {
+		peer: func(p *wgtypes.Peer) []string { return []string{p.PublicKey.String(), endpointString(p.Endpoint)} },
+	},
+	fieldAllowedIPs: {
+		peer: func(p *wgtypes.Peer) []string { return []string{p.PublicKey.String(), allowedIPsString(p, " ")} },
+	},
+	fieldLatestHandshakes: {
+		peer: func(p *wgtypes.Peer) []string { return []string{p.PublicKey.String(), handshakeString(p)} },
+	},
+	fieldPersistentKeepalive: {
+		peer: func(p *wgtypes.Peer) []string { return []string{p.PublicKey.String(), keepaliveString(p)} },
+	},
+	fieldTransfer: {
+		peer: func(p *wgtypes.Peer) []string {
+			return []string{
+				p.PublicKey.String(),
+				strconv.FormatInt(p.ReceiveBytes, 10),
+				strconv.FormatInt(p.TransmitBytes, 10),
+			}
+		},
+	},
+	fieldDump: {
+		device: func(d *wgtypes.Device) []string {
+			return []string{
+				privateKeyString(d),
+				keyString(d.PublicKey),
+				strconv.Itoa(d.ListenPort),
+				fwmarkString(d.FirewallMark),
+			}
+		},
+		peer: func(p *wgtypes.Peer) []string {
+			return []string{
+				p.PublicKey.String(),
+				presharedKeyString(p),
+				endpointString(p.Endpoint),
+				allowedIPsString(p, ","),
+				handshakeString(p),
+				strconv.FormatInt(p.ReceiveBytes, 10),
+				strconv.FormatInt(p.TransmitBytes, 10),
+				keepaliveString(p),
+			}
+		},
+	},
+}
+
+// fieldPrinter produces a printer for a single field. When printing all
+// devices, each line is prefixed with the device name.
+func fieldPrinter(field string) printer {
+	f := fields[field]
+
+	return func(w io.Writer, devices []*wgtypes.Device, all bool) error {
+		for _, d := range devices {
+			var prefix []string
+			if all {
+				prefix = []string{d.Name}
+			}
+
+			if f.device != nil {
+				fmt.Fprintln(w, strings.Join(append(prefix, f.device(d)...), "\t"))
+			}
+
+			if f.peer == nil {
+				continue
+			}
+
+			for i := range d.Peers {
+				fmt.Fprintln(w, strings.Join(append(prefix, f.peer(&d.Peers[i])...), "\t"))
+			}
+		}
+
+		return nil
+	}
+}
+
+// keyString formats k, or "(none)" for a zero key.
+func keyString(k wgtypes.Key) string {
+	if k == (wgtypes.Key{}) {
+		return "(none)"
+	}
+
+	return k.String()
+}
+
+// privateKeyString formats the private key of d, or "(hidden)" if it was
+// redacted by the backend.
+func privateKeyString(d *wgtypes.Device) string {
+	if d.KeysRedacted && d.PrivateKey == (wgtypes.Key{}) && d.PublicKey != (wgtypes.Key{}) {
+		return "(hidden)"
+	}
+
+	return keyString(d.PrivateKey)
+}
+
+// presharedKeyString formats the preshared key of p, or "(hidden)" if it was
+// redacted by the backend.
+func presharedKeyString(p *wgtypes.Peer) string {
+	if p.PresharedKeyRedacted {
+		return "(hidden)"
+	}
+
+	return keyString(p.PresharedKey)
+}
+
+// fwmarkString formats a firewall mark, or "off" for no mark.
+func fwmarkString(mark int) string {
+	if mark == 0 {
+		return "off"
+	}
+
+	return fmt.Sprintf("0x%x", mark)
+}
+
+// endpointString formats addr, or "(none)" for no endpoint.
+func endpointString(addr *net.UDPAddr) string {
+	if addr == nil {
+		return "(none)"
+	}
+
+	return addr.String()
+}
+
+// allowedIPsString joins the allowed IPs of p with sep, or returns "(none)"
+// for no allowed IPs.
+func allowedIPsString(p *wgtypes.Peer, sep string) string {
+	if len(p.AllowedIPs) == 0 {
+		return "(none)"
+	}
+
+	ss := make([]string, 0, len(p.AllowedIPs))
+	for _, ipn := range p.AllowedIPs {
+		ss = append(ss, ipn.String())
+	}
+
+	return strings.Join(ss, sep)
+}
+
+// handshakeString formats the latest handshake of p as a UNIX timestamp, or
+// 0 for no handshake.
+func handshakeString(p *wgtypes.Peer) string {
+	if p.LastHandshakeTime.IsZero() {
+		return "0"
+	}
+
+	return strconv.FormatInt(p.LastHandshakeTime.Unix(), 10)
+}
+
+// keepaliveString formats the persistent keepalive interval of p in seconds,
+// or "off" if disabled.
+func keepaliveString(p *wgtypes.Peer) string {
+	if p.PersistentKeepaliveInterval == 0 {
+		return "off"
+	}
+
+	return strconv.Itoa(int(p.PersistentKeepaliveInterval.Seconds()))
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestPrinters(t *testing.T) {
+	var (
+		priv = wgtest.MustHexKey("e84b5a6d2717c1003a13b431570353dbaca9146cf150c5f8575680feba52027a")
+		pub  = wgtest.MustHexKey("b85996fecc9c7f1fc6d2572a76eda11d59bcd20be8e543b15ce4bd85a8e75a33")
+		psk  = wgtest.MustHexKey("188515093e952f5f22e865cef3012e72f8b5f0b598ac0309d5dacce3b70fcf52")
+	)
+
+	d := &wgtypes.Device{
+		Name:         "wg0",
+		Type:         wgtypes.Userspace,
+		PrivateKey:   priv,
+		PublicKey:    priv.PublicKey(),
+		ListenPort:   51820,
+		FirewallMark: 0x10,
+		Peers: []wgtypes.Peer{
+			{
+				PublicKey:                   pub,
+				PresharedKey:                psk,
+				Endpoint:                    wgtest.MustUDPAddr("192.0.2.1:51820"),
+				PersistentKeepaliveInterval: 25 * time.Second,
+				LastHandshakeTime:           time.Unix(1600000000, 0),
+				ReceiveBytes:                1024,
+				TransmitBytes:               2048,
+				AllowedIPs: []net.IPNet{
+					wgtest.MustCIDR("192.0.2.0/24"),
+					wgtest.MustCIDR("2001:db8::/32"),
+				},
+				ProtocolVersion: 1,
+			},
+			{
+				PublicKey: psk.PublicKey(),
+			},
+		},
+	}
+
+	var (
+		privS = priv.String()
+		pubS  = pub.String()
+		pskS  = psk.String()
+		peer2 = psk.PublicKey().String()
+	)
+
+	tests := []struct {
+		name   string
+		format string
+		field  string
+		all    bool
+		out    string
+	}{
+		{
+			name:   "dump",
+			format: "dump",
+			out: strings.Join([]string{
+				privS + "\t" + priv.PublicKey().String() + "\t51820\t0x10",
+				pubS + "\t" + pskS + "\t192.0.2.1:51820\t192.0.2.0/24,2001:db8::/32\t1600000000\t1024\t2048\t25",
+				peer2 + "\t(none)\t(none)\t(none)\t0\t0\t0\toff",
+				"",
+			}, "\n"),
+		},
+		{
+			name:  "endpoints all",
+			field: fieldEndpoints,
+			all:   true,
+			out: strings.Join([]string{
+				"wg0\t" + pubS + "\t192.0.2.1:51820",
+				"wg0\t" + peer2 + "\t(none)",
+				"",
+			}, "\n"),
+		},
+		{
+			name:  "allowed IPs",
+			field: fieldAllowedIPs,
+			out: strings.Join([]string{
+				pubS + "\t192.0.2.0/24 2001:db8::/32",
+				peer2 + "\t(none)",
+				"",
+			}, "\n"),
+		},
+		{
+			name:  "fwmark",
+			field: fieldFwmark,
+			out:   "0x10\n",
+		},
+		{
+			name:   "template",
+			format: `template={{.Name}} {{.ListenPort}}{{range .Peers}} {{.PublicKey}}{{end}}` + "\n",
+			out:    "wg0 51820 " + pubS + " " + peer2 + "\n",
+		},
+		{
+			name:   "JSON hidden keys",
+			format: "json",
+			out: `{
+	"name": "wg0",
+	"type": "userspace",
+	"public_key": "` + priv.PublicKey().String() + `",
+	"listen_port": 51820,
+	"fwmark": 16,
+	"peers": [
+		{
+			"public_key": "` + pubS + `",
+			"has_preshared_key": true,
+			"endpoint": "192.0.2.1:51820",
+			"allowed_ips": [
+				"192.0.2.0/24",
+				"2001:db8::/32"
+			],
+			"latest_handshake": "2020-09-13T12:26:40Z",
+			"transfer_rx": 1024,
+			"transfer_tx": 2048,
+			"persistent_keepalive": 25,
+			"protocol_version": 1
+		},
+		{
+			"public_key": "` + peer2 + `",
+			"has_preshared_key": false,
+			"allowed_ips": [],
+			"latest_handshake": null,
+			"transfer_rx": 0,
+			"transfer_tx": 0,
+			"persistent_keepalive": 0,
+			"protocol_version": 0
+		}
+	]
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := fieldPrinter(tt.field)
+			if tt.format != "" {
+				var err error
+				p, err = parseFormat(tt.format, false)
+				if err != nil {
+					t.Fatalf("failed to parse format: %v", err)
+				}
+			}
+
+			var b bytes.Buffer
+			if err := p(&b, []*wgtypes.Device{d}, tt.all); err != nil {
+				t.Fatalf("failed to print: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.out, b.String()); diff != "" {
+				t.Fatalf("unexpected output (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_printJSONShowKeys(t *testing.T) {
+	os.Setenv("WG_HIDE_KEYS", "never")
+	defer os.Unsetenv("WG_HIDE_KEYS")
+
+	var (
+		priv = wgtest.MustPrivateKey()
+		psk  = wgtest.MustPresharedKey()
+	)
+
+	d := &wgtypes.Device{
+		Name:       "wg0",
+		PrivateKey: priv,
+		PublicKey:  priv.PublicKey(),
+		Peers: []wgtypes.Peer{{
+			PublicKey:    wgtest.MustPublicKey(),
+			PresharedKey: psk,
+		}},
+	}
+
+	var b bytes.Buffer
+	if err := printJSON(&b, []*wgtypes.Device{d}, true); err != nil {
+		t.Fatalf("failed to print JSON: %v", err)
+	}
+
+	var jds []jsonDevice
+	if err := json.Unmarshal(b.Bytes(), &jds); err != nil {
+		t.Fatalf("failed to unmarshal JSON: %v", err)
+	}
+
+	if len(jds) != 1 || len(jds[0].Peers) != 1 {
+		t.Fatalf("unexpected number of devices or peers: %#v", jds)
+	}
+
+	if diff := cmp.Diff(priv.String(), jds[0].PrivateKey); diff != "" {
+		t.Fatalf("unexpected private key (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(psk.String(), jds[0].Peers[0].PresharedKey); diff != "" {
+		t.Fatalf("unexpected preshared key (-want +got):\n%s", diff)
+	}
+}
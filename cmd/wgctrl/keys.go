@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// cmdGenkey implements "wgctrl genkey".
+func cmdGenkey(_ *wgctrl.Client, args []string) error {
+	return printKey(args, wgtypes.GeneratePrivateKey)
+}
+
+// cmdGenpsk implements "wgctrl genpsk".
+func cmdGenpsk(_ *wgctrl.Client, args []string) error {
+	return printKey(args, wgtypes.GenerateKey)
+}
+
+// cmdPubkey implements "wgctrl pubkey".
+func cmdPubkey(_ *wgctrl.Client, args []string) error {
+	return printKey(args, func() (wgtypes.Key, error) {
+		b, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return wgtypes.Key{}, err
+		}
+
+		k, err := parseKey(strings.TrimSpace(string(b)))
+		if err != nil {
+			return wgtypes.Key{}, err
+		}
+
+		return k.PublicKey(), nil
+	})
+}
+
+// printKey prints the key produced by fn to stdout.
+func printKey(args []string, fn func() (wgtypes.Key, error)) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	k, err := fn()
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(stdout, k.String())
+	return err
+}
@@ -1,93 +1,189 @@
-// Command wgctrl is a testing utility for interacting with WireGuard via package
-// wgctrl.
+// Command wgctrl is a WireGuard configuration utility built on package wgctrl.
+// It accepts the same subcommands and argument grammar as wg(8), and can be
+// used in its place on systems where wireguard-tools is not available.
 package main
 
 import (
-	"flag"
+	"errors"
 	"fmt"
+	"io"
 	"log"
-	"net"
-	"strings"
+	"os"
 
 	"golang.zx2c4.com/wireguard/wgctrl"
-	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
+// Standard streams, swapped out in tests.
+var (
+	stdin  io.Reader = os.Stdin
+	stdout io.Writer = os.Stdout
+)
+
+// errUsage indicates that a command was invoked with invalid arguments.
+var errUsage = errors.New("invalid arguments")
+
+// A command is a wgctrl subcommand.
+type command struct {
+	name  string
+	args  string
+	help  string
+	local bool // does not require a wgctrl.Client
+	run   func(c *wgctrl.Client, args []string) error
+}
+
+// commands are the available subcommands, in the order they are displayed.
+var commands = []command{
+	{
+		name: "show",
+		args: "[--format <pretty | json | dump | template=<text>>] [--resolve] [<interface> | all | interfaces] " +
+			"[public-key | private-key | listen-port | fwmark | peers | preshared-keys | endpoints | " +
+			"allowed-ips | latest-handshakes | persistent-keepalive | transfer | dump]",
+		help: "Shows the current configuration and device information",
+		run:  cmdShow,
+	},
+	{
+		name: "showconf",
+		args: "<interface>",
+		help: "Shows the current configuration of a given WireGuard interface, for use with `setconf'",
+		run:  cmdShowconf,
+	},
+	{
+		name: "set",
+		args: "[--dry-run] <interface> [listen-port <port>] [fwmark <mark>] [private-key <file path>] " +
+			"[peer <base64 public key> [remove] [preshared-key <file path>] [endpoint <ip>:<port>] " +
+			"[persistent-keepalive <interval seconds>] [allowed-ips <ip1>/<cidr1>[,<ip2>/<cidr2>]...] ]...",
+		help: "Change the current configuration, add peers, remove peers, or change peers",
+		run:  cmdSet,
+	},
+	{
+		name: "setconf",
+		args: "<interface> <configuration filename>",
+		help: "Applies a configuration file to a WireGuard interface",
+		run:  cmdSetconf,
+	},
+	{
+		name: "addconf",
+		args: "<interface> <configuration filename>",
+		help: "Appends a configuration file to a WireGuard interface",
+		run:  cmdAddconf,
+	},
+	{
+		name: "syncconf",
+		args: "<interface> <configuration filename>",
+		help: "Synchronizes a configuration file to a WireGuard interface",
+		run:  cmdSyncconf,
+	},
+	{
+		name: "watch",
+		args: "[--interval <duration>] [--sort <device | key | handshake | rx | tx>] " +
+			"[--filter <public key prefix>] [<interface>]",
+		help: "Continuously shows the peers of one or all interfaces, with transfer rates",
+		run:  cmdWatch,
+	},
+	{
+		name: "metrics",
+		args: "[--listen <address>] [--peer-label <public-key | name | none>] [--names <file>]",
+		help: "Serves metrics for all interfaces in the Prometheus text format",
+		run:  cmdMetrics,
+	},
+	{
+		name: "serve",
+		args: "[--listen <address | unix:<path>>] [--token-file <file>] [--uids <uid1>[,<uid2>]...] " +
+			"[--devices <interface1>[,<interface2>]...] [--read-only] [--show-keys] " +
+			"[--tls-cert <file> --tls-key <file>]",
+		help: "Serves a JSON HTTP API for configuring interfaces",
+		run:  cmdServe,
+	},
+	{
+		name:  "genkey",
+		help:  "Generates a new private key and writes it to stdout",
+		local: true,
+		run:   cmdGenkey,
+	},
+	{
+		name:  "genpsk",
+		help:  "Generates a new preshared key and writes it to stdout",
+		local: true,
+		run:   cmdGenpsk,
+	},
+	{
+		name:  "pubkey",
+		help:  "Reads a private key from stdin and writes a public key to stdout",
+		local: true,
+		run:   cmdPubkey,
+	},
+}
+
 func main() {
-	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("wgctrl: ")
 
-	c, err := wgctrl.New()
-	if err != nil {
-		log.Fatalf("failed to open wgctrl: %v", err)
+	// As with wg(8), no arguments is equivalent to "show".
+	args := os.Args[1:]
+	if len(args) == 0 {
+		args = []string{"show"}
 	}
-	defer c.Close()
 
-	var devices []*wgtypes.Device
-	if device := flag.Arg(0); device != "" {
-		d, err := c.Device(device)
-		if err != nil {
-			log.Fatalf("failed to get device %q: %v", device, err)
-		}
+	switch args[0] {
+	case "help", "-h", "--help":
+		usage(os.Stdout)
+		return
+	}
 
-		devices = append(devices, d)
-	} else {
-		devices, err = c.Devices()
-		if err != nil {
-			log.Fatalf("failed to get devices: %v", err)
-		}
+	cmd, ok := lookup(args[0])
+	if !ok {
+		log.Printf("invalid subcommand: %q", args[0])
+		usage(os.Stderr)
+		os.Exit(1)
 	}
 
-	for _, d := range devices {
-		printDevice(d)
+	if len(args) > 1 && (args[1] == "-h" || args[1] == "--help") {
+		fmt.Printf("Usage: wgctrl %s %s\n", cmd.name, cmd.args)
+		return
+	}
 
-		for _, p := range d.Peers {
-			printPeer(p)
+	if err := cmd.exec(args[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "Usage: wgctrl %s %s\n", cmd.name, cmd.args)
+			os.Exit(1)
 		}
+
+		log.Fatalf("%s: %v", cmd.name, err)
 	}
 }
 
-func printDevice(d *wgtypes.Device) {
-	const f = `interface: %s (%s)
-  public key: %s
-  private key: (hidden)
-  listening port: %d
+// exec runs cmd with args, opening a wgctrl.Client if necessary.
+func (cmd command) exec(args []string) error {
+	if cmd.local {
+		return cmd.run(nil, args)
+	}
 
-`
+	c, err := wgctrl.New()
+	if err != nil {
+		return fmt.Errorf("failed to open wgctrl: %v", err)
+	}
+	defer c.Close()
 
-	fmt.Printf(
-		f,
-		d.Name,
-		d.Type.String(),
-		d.PublicKey.String(),
-		d.ListenPort)
+	return cmd.run(c, args)
 }
 
-func printPeer(p wgtypes.Peer) {
-	const f = `peer: %s
-  endpoint: %s
-  allowed ips: %s
-  latest handshake: %s
-  transfer: %d B received, %d B sent
-
-`
-
-	fmt.Printf(
-		f,
-		p.PublicKey.String(),
-		// TODO(mdlayher): get right endpoint with getnameinfo.
-		p.Endpoint.String(),
-		ipsString(p.AllowedIPs),
-		p.LastHandshakeTime.String(),
-		p.ReceiveBytes,
-		p.TransmitBytes,
-	)
+// lookup finds the command with the specified name.
+func lookup(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+
+	return command{}, false
 }
 
-func ipsString(ipns []net.IPNet) string {
-	ss := make([]string, 0, len(ipns))
-	for _, ipn := range ipns {
-		ss = append(ss, ipn.String())
+// usage prints the top-level usage text to w.
+func usage(w io.Writer) {
+	fmt.Fprint(w, "Usage: wgctrl <cmd> [<args>]\n\n")
+	fmt.Fprintln(w, "Available subcommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s: %s\n", cmd.name, cmd.help)
 	}
-
-	return strings.Join(ss, ", ")
+	fmt.Fprintln(w, "You may pass `--help' to any of these subcommands to view usage.")
 }
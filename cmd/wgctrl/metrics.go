@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgmetrics"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Peer label modes for "wgctrl metrics".
+var peerLabels = map[string]wgmetrics.PeerLabel{
+	"public-key": wgmetrics.PeerLabelPublicKey,
+	"name":       wgmetrics.PeerLabelName,
+	"none":       wgmetrics.PeerLabelNone,
+}
+
+// cmdMetrics implements "wgctrl metrics".
+func cmdMetrics(c *wgctrl.Client, args []string) error {
+	fs := flag.NewFlagSet("metrics", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	var (
+		listen = fs.String("listen", ":9586", "")
+		label  = fs.String("peer-label", "public-key", "")
+		names  = fs.String("names", "", "")
+	)
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+
+	pl, ok := peerLabels[*label]
+	if !ok {
+		return fmt.Errorf("unknown peer label %q", *label)
+	}
+
+	cfg := &wgmetrics.Config{PeerLabel: pl}
+	if *names != "" {
+		f, err := os.Open(*names)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		cfg.Names, err = parseNames(f)
+		if err != nil {
+			return fmt.Errorf("%s: %v", *names, err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", wgmetrics.New(c, cfg))
+
+	fmt.Fprintf(stdout, "serving metrics on %s/metrics\n", *listen)
+	return http.ListenAndServe(*listen, mux)
+}
+
+// parseNames parses a file of peer names. Each line holds a base64-encoded
+// public key, whitespace, and a name; '#' begins a comment.
+func parseNames(r io.Reader) (map[wgtypes.Key]string, error) {
+	names := make(map[wgtypes.Key]string)
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i != -1 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected public key and name", n)
+		}
+
+		k, err := parseKey(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+
+		names[k] = strings.Join(fields[1:], " ")
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
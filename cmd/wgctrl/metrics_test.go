@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func Test_parseNames(t *testing.T) {
+	var (
+		a = wgtest.MustPublicKey()
+		b = wgtest.MustPublicKey()
+	)
+
+	in := "# Peer names.\n" + a.String() + "  alice laptop\n\n" + b.String() + "\tbob # Phone.\n"
+
+	names, err := parseNames(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("failed to parse names: %v", err)
+	}
+
+	want := map[wgtypes.Key]string{
+		a: "alice laptop",
+		b: "bob",
+	}
+
+	if diff := cmp.Diff(want, names); diff != "" {
+		t.Fatalf("unexpected names (-want +got):\n%s", diff)
+	}
+
+	if _, err := parseNames(strings.NewReader(a.String())); err == nil {
+		t.Fatal("expected an error for a key without a name, but none occurred")
+	}
+}
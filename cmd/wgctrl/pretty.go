@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// ANSI terminal escape sequences.
+const (
+	termReset  = "\x1b[0m"
+	termBold   = "\x1b[1m"
+	termRed    = "\x1b[31m"
+	termGreen  = "\x1b[32m"
+	termYellow = "\x1b[33m"
+	termCyan   = "\x1b[36m"
+)
+
+// pretty prints devices for humans, in the same layout as wg(8).
+type pretty struct {
+	now    time.Time
+	color  bool
+	hide   bool
+	lookup func(ip net.IP) string
+}
+
+// newPretty creates a pretty which uses the current time, and colors its
+// output if WG_COLOR_MODE and stdout permit it.
+func newPretty() *pretty {
+	return &pretty{
+		now:   time.Now(),
+		color: useColor(),
+		hide:  hideKeys(),
+	}
+}
+
+// useColor reports whether output should be colored. As with wg(8),
+// WG_COLOR_MODE may be "always", "never", or "auto", which colors output
+// only when stdout is a terminal.
+func useColor() bool {
+	switch os.Getenv("WG_COLOR_MODE") {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+
+	f, ok := stdout.(*os.File)
+	if !ok {
+		return false
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// print implements printer.
+func (pp *pretty) print(w io.Writer, devices []*wgtypes.Device, _ bool) error {
+	for i, d := range devices {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+
+		pp.printDevice(w, d)
+	}
+
+	return nil
+}
+
+func (pp *pretty) printDevice(w io.Writer, d *wgtypes.Device) {
+	fmt.Fprintf(w, "%s: %s\n", pp.paint(termBold+termGreen, "interface"), pp.paint(termGreen, d.Name))
+	if d.PublicKey != (wgtypes.Key{}) {
+		pp.field(w, "public key", d.PublicKey.String())
+	}
+	if d.PrivateKey != (wgtypes.Key{}) {
+		pp.field(w, "private key", pp.secret(d.PrivateKey))
+	} else if d.KeysRedacted && d.PublicKey != (wgtypes.Key{}) {
+		pp.field(w, "private key", "(hidden)")
+	}
+	if d.ListenPort != 0 {
+		pp.field(w, "listening port", strconv.Itoa(d.ListenPort))
+	}
+	if d.FirewallMark != 0 {
+		pp.field(w, "fwmark", fmt.Sprintf("0x%x", d.FirewallMark))
+	}
+
+	for _, p := range sortPeers(d.Peers) {
+		fmt.Fprintln(w)
+		pp.printPeer(w, p)
+	}
+}
+
+func (pp *pretty) printPeer(w io.Writer, p *wgtypes.Peer) {
+	fmt.Fprintf(w, "%s: %s\n", pp.paint(termBold+termYellow, "peer"), pp.paint(termYellow, p.PublicKey.String()))
+	if p.PresharedKey != (wgtypes.Key{}) {
+		pp.field(w, "preshared key", pp.secret(p.PresharedKey))
+	} else if p.PresharedKeyRedacted {
+		pp.field(w, "preshared key", "(hidden)")
+	}
+	if p.Endpoint != nil {
+		pp.field(w, "endpoint", pp.endpoint(p.Endpoint))
+	}
+
+	ips := "(none)"
+	if len(p.AllowedIPs) > 0 {
+		ss := make([]string, 0, len(p.AllowedIPs))
+		for _, ipn := range p.AllowedIPs {
+			ones, _ := ipn.Mask.Size()
+			ss = append(ss, fmt.Sprintf("%s%s%d", ipn.IP, pp.paint(termCyan, "/"), ones))
+		}
+
+		ips = strings.Join(ss, ", ")
+	}
+	pp.field(w, "allowed ips", ips)
+
+	if !p.LastHandshakeTime.IsZero() {
+		pp.field(w, "latest handshake", pp.ago(p.LastHandshakeTime))
+	}
+	if p.ReceiveBytes != 0 || p.TransmitBytes != 0 {
+		pp.field(w, "transfer", fmt.Sprintf("%s received, %s sent",
+			pp.bytes(p.ReceiveBytes), pp.bytes(p.TransmitBytes)))
+	}
+	if p.PersistentKeepaliveInterval != 0 {
+		pp.field(w, "persistent keepalive", "every "+pp.duration(p.PersistentKeepaliveInterval))
+	}
+}
+
+// sortPeers returns pointers to peers, ordered by most recent handshake
+// first, with peers which have never completed a handshake last.
+func sortPeers(peers []wgtypes.Peer) []*wgtypes.Peer {
+	ps := make([]*wgtypes.Peer, 0, len(peers))
+	for i := range peers {
+		ps = append(ps, &peers[i])
+	}
+
+	sort.SliceStable(ps, func(i, j int) bool {
+		a, b := ps[i].LastHandshakeTime, ps[j].LastHandshakeTime
+		if a.IsZero() || b.IsZero() {
+			return !a.IsZero() && b.IsZero()
+		}
+
+		return a.After(b)
+	})
+
+	return ps
+}
+
+// field prints a single indented label and value.
+func (pp *pretty) field(w io.Writer, label, value string) {
+	fmt.Fprintf(w, "  %s: %s\n", pp.paint(termBold, label), value)
+}
+
+// paint wraps s in the terminal escape sequence esc, if color is enabled.
+func (pp *pretty) paint(esc, s string) string {
+	if !pp.color {
+		return s
+	}
+
+	return esc + s + termReset
+}
+
+// secret formats a private or preshared key, which is hidden by default.
+func (pp *pretty) secret(k wgtypes.Key) string {
+	if pp.hide {
+		return "(hidden)"
+	}
+
+	return k.String()
+}
+
+// endpoint formats addr, naming its host if reverse DNS is enabled.
+func (pp *pretty) endpoint(addr *net.UDPAddr) string {
+	host := addr.IP.String()
+	if pp.lookup != nil {
+		if name := pp.lookup(addr.IP); name != "" {
+			host = name
+		}
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(addr.Port))
+}
+
+// ago formats the time elapsed since t, such as "1 minute, 3 seconds ago".
+func (pp *pretty) ago(t time.Time) string {
+	d := pp.now.Sub(t).Truncate(time.Second)
+	switch {
+	case d == 0:
+		return "Now"
+	case d < 0:
+		return "(" + pp.paint(termRed, "System clock wound backward; connection problems may ensue.") + ")"
+	}
+
+	return pp.duration(d) + " ago"
+}
+
+// Units of time used by duration.
+var timeUnits = []struct {
+	name string
+	d    time.Duration
+}{
+	{name: "year", d: 365 * 24 * time.Hour},
+	{name: "day", d: 24 * time.Hour},
+	{name: "hour", d: time.Hour},
+	{name: "minute", d: time.Minute},
+	{name: "second", d: time.Second},
+}
+
+// duration formats d in years, days, hours, minutes, and seconds, omitting
+// any which are zero.
+func (pp *pretty) duration(d time.Duration) string {
+	var ss []string
+	for _, u := range timeUnits {
+		n := d / u.d
+		if n == 0 {
+			continue
+		}
+		d -= n * u.d
+
+		name := u.name
+		if n != 1 {
+			name += "s"
+		}
+
+		ss = append(ss, fmt.Sprintf("%d %s", n, pp.paint(termCyan, name)))
+	}
+
+	return strings.Join(ss, ", ")
+}
+
+// bytes formats n using binary units, such as "1.50 KiB".
+func (pp *pretty) bytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d %s", n, pp.paint(termCyan, "B"))
+	}
+
+	var (
+		f = float64(n) / unit
+		i int
+	)
+
+	for f >= unit && i < len("KMGTPE")-1 {
+		f /= unit
+		i++
+	}
+
+	return fmt.Sprintf("%.2f %s", f, pp.paint(termCyan, string("KMGTPE"[i])+"iB"))
+}
+
+// A resolver performs reverse DNS lookups of endpoint addresses, caching the
+// results for the lifetime of the process.
+type resolver struct {
+	mu    sync.Mutex
+	names map[string]string
+}
+
+// newResolver creates a resolver.
+func newResolver() *resolver {
+	return &resolver{names: make(map[string]string)}
+}
+
+// lookup returns the first name of ip, or the empty string if it has none or
+// the lookup fails.
+func (r *resolver) lookup(ip net.IP) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := ip.String()
+	if name, ok := r.names[key]; ok {
+		return name
+	}
+
+	// Don't let a slow DNS server hold up the entire output.
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var name string
+	if names, err := net.DefaultResolver.LookupAddr(ctx, key); err == nil && len(names) > 0 {
+		name = strings.TrimSuffix(names[0], ".")
+	}
+
+	r.names[key] = name
+	return name
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func Test_prettyPrint(t *testing.T) {
+	var (
+		now  = time.Unix(1600000000, 0)
+		priv = wgtest.MustPrivateKey()
+		psk  = wgtest.MustPresharedKey()
+
+		never  = wgtest.MustPublicKey()
+		old    = wgtest.MustPublicKey()
+		recent = wgtest.MustPublicKey()
+	)
+
+	d := &wgtypes.Device{
+		Name:         "wg0",
+		PrivateKey:   priv,
+		PublicKey:    priv.PublicKey(),
+		ListenPort:   51820,
+		FirewallMark: 0x10,
+		Peers: []wgtypes.Peer{
+			{
+				PublicKey: never,
+			},
+			{
+				PublicKey:         old,
+				PresharedKey:      psk,
+				Endpoint:          wgtest.MustUDPAddr("[2001:db8::1]:51820"),
+				LastHandshakeTime: now.Add(-(24*time.Hour + time.Minute + 3*time.Second)),
+				ReceiveBytes:      512,
+				TransmitBytes:     3 * 1024 * 1024 / 2,
+				AllowedIPs: []net.IPNet{
+					wgtest.MustCIDR("192.0.2.0/24"),
+					wgtest.MustCIDR("2001:db8::/32"),
+				},
+				PersistentKeepaliveInterval: 25 * time.Second,
+			},
+			{
+				PublicKey:         recent,
+				Endpoint:          wgtest.MustUDPAddr("192.0.2.1:51820"),
+				LastHandshakeTime: now.Add(-time.Minute),
+				ReceiveBytes:      1,
+			},
+		},
+	}
+
+	pp := &pretty{
+		now:  now,
+		hide: true,
+		lookup: func(ip net.IP) string {
+			if ip.Equal(net.IPv4(192, 0, 2, 1)) {
+				return "vpn.example.com"
+			}
+
+			return ""
+		},
+	}
+
+	var b bytes.Buffer
+	if err := pp.print(&b, []*wgtypes.Device{d}, false); err != nil {
+		t.Fatalf("failed to print: %v", err)
+	}
+
+	want := strings.Join([]string{
+		"interface: wg0",
+		"  public key: " + priv.PublicKey().String(),
+		"  private key: (hidden)",
+		"  listening port: 51820",
+		"  fwmark: 0x10",
+		"",
+		"peer: " + recent.String(),
+		"  endpoint: vpn.example.com:51820",
+		"  allowed ips: (none)",
+		"  latest handshake: 1 minute ago",
+		"  transfer: 1 B received, 0 B sent",
+		"",
+		"peer: " + old.String(),
+		"  preshared key: (hidden)",
+		"  endpoint: [2001:db8::1]:51820",
+		"  allowed ips: 192.0.2.0/24, 2001:db8::/32",
+		"  latest handshake: 1 day, 1 minute, 3 seconds ago",
+		"  transfer: 512 B received, 1.50 MiB sent",
+		"  persistent keepalive: every 25 seconds",
+		"",
+		"peer: " + never.String(),
+		"  allowed ips: (none)",
+		"",
+	}, "\n")
+
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Fatalf("unexpected output (-want +got):\n%s", diff)
+	}
+}
+
+func Test_prettyUnits(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	pp := &pretty{now: now}
+
+	tests := []struct {
+		name string
+		fn   func() string
+		want string
+	}{
+		{
+			name: "now",
+			fn:   func() string { return pp.ago(now.Add(-500 * time.Millisecond)) },
+			want: "Now",
+		},
+		{
+			name: "future",
+			fn:   func() string { return pp.ago(now.Add(time.Minute)) },
+			want: "(System clock wound backward; connection problems may ensue.)",
+		},
+		{
+			name: "years",
+			fn:   func() string { return pp.duration(2*365*24*time.Hour + time.Hour) },
+			want: "2 years, 1 hour",
+		},
+		{
+			name: "KiB",
+			fn:   func() string { return pp.bytes(1024) },
+			want: "1.00 KiB",
+		},
+		{
+			name: "GiB",
+			fn:   func() string { return pp.bytes(5 * 1024 * 1024 * 1024) },
+			want: "5.00 GiB",
+		},
+		{
+			name: "color",
+			fn: func() string {
+				return (&pretty{color: true}).bytes(1)
+			},
+			want: "1 \x1b[36mB\x1b[0m",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, tt.fn()); diff != "" {
+				t.Fatalf("unexpected output (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgserver"
+)
+
+// unixPrefix marks a --listen address as a UNIX socket path.
+const unixPrefix = "unix:"
+
+// cmdServe implements "wgctrl serve".
+func cmdServe(c *wgctrl.Client, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	var (
+		listen    = fs.String("listen", unixPrefix+"/run/wgctrl.sock", "")
+		tokenFile = fs.String("token-file", "", "")
+		uids      = fs.String("uids", "", "")
+		devices   = fs.String("devices", "", "")
+		readOnly  = fs.Bool("read-only", false, "")
+		showKeys  = fs.Bool("show-keys", false, "")
+		tlsCert   = fs.String("tls-cert", "", "")
+		tlsKey    = fs.String("tls-key", "", "")
+	)
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+
+	a := &wgserver.Access{
+		Name:     "wgctrl serve",
+		ReadOnly: *readOnly,
+		Keys:     *showKeys,
+	}
+	if *devices != "" {
+		a.Devices = strings.Split(*devices, ",")
+	}
+
+	cfg, err := serveConfig(a, *tokenFile, *uids)
+	if err != nil {
+		return err
+	}
+
+	cfg.Logf = log.Printf
+
+	l, err := serveListen(*listen, *tlsCert, *tlsKey)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigC := make(chan os.Signal, 1)
+	signal.Notify(sigC, os.Interrupt)
+	defer signal.Stop(sigC)
+	go func() {
+		<-sigC
+		cancel()
+	}()
+
+	fmt.Fprintf(stdout, "serving API on %s\n", *listen)
+	if err := wgserver.New(c, cfg).Serve(ctx, l); err != context.Canceled {
+		return err
+	}
+
+	return nil
+}
+
+// serveConfig produces the configuration for "wgctrl serve", granting a to
+// the bearer token in the file named by tokenFile and to the comma-separated
+// user IDs in uids.
+func serveConfig(a *wgserver.Access, tokenFile, uids string) (*wgserver.Config, error) {
+	var cfg wgserver.Config
+
+	if tokenFile != "" {
+		b, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tok := strings.TrimSpace(string(b))
+		if tok == "" {
+			return nil, fmt.Errorf("%s: empty token", tokenFile)
+		}
+
+		cfg.Tokens = map[string]*wgserver.Access{tok: a}
+	}
+
+	if uids != "" {
+		cfg.UIDs = make(map[int]*wgserver.Access)
+		for _, s := range strings.Split(uids, ",") {
+			uid, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid user ID %q", s)
+			}
+
+			cfg.UIDs[uid] = a
+		}
+	}
+
+	if len(cfg.Tokens) == 0 && len(cfg.UIDs) == 0 {
+		return nil, fmt.Errorf("either --token-file or --uids must be set to authorize callers")
+	}
+
+	return &cfg, nil
+}
+
+// serveListen listens on a TCP address, or on a UNIX socket path with a
+// "unix:" prefix, which only its owner and group may connect to. TCP
+// connections use TLS with the certificate and key in the files named by
+// certFile and keyFile. Without TLS, only loopback TCP addresses are
+// permitted, as tokens and private keys would otherwise cross the network
+// in cleartext.
+func serveListen(addr, certFile, keyFile string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, unixPrefix) {
+		return serveListenTCP(addr, certFile, keyFile)
+	}
+
+	if certFile != "" || keyFile != "" {
+		return nil, errors.New("--tls-cert and --tls-key cannot be used with a UNIX socket")
+	}
+
+	path := strings.TrimPrefix(addr, unixPrefix)
+
+	// Remove a socket left behind by a previous run, but nothing else.
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0660); err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// serveListenTCP implements serveListen for TCP addresses.
+func serveListenTCP(addr, certFile, keyFile string) (net.Listener, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("--tls-cert and --tls-key must be set together")
+	}
+
+	if certFile == "" {
+		if !isLoopback(addr) {
+			return nil, fmt.Errorf("--tls-cert and --tls-key are required to listen on non-loopback address %q", addr)
+		}
+
+		return net.Listen("tcp", addr)
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return tls.Listen("tcp", addr, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	})
+}
+
+// isLoopback reports whether the TCP address addr only accepts connections
+// from the local host.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl/wgserver"
+)
+
+func Test_serveConfig(t *testing.T) {
+	tmp, err := ioutil.TempDir(os.TempDir(), "wgctrl-serve")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	tokenFile := filepath.Join(tmp, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatalf("failed to write token file: %v", err)
+	}
+
+	a := &wgserver.Access{Name: "test"}
+
+	tests := []struct {
+		name            string
+		tokenFile, uids string
+		cfg             *wgserver.Config
+		ok              bool
+	}{
+		{
+			name: "no credentials",
+		},
+		{
+			name: "bad UID",
+			uids: "0,root",
+		},
+		{
+			name:      "missing token file",
+			tokenFile: filepath.Join(tmp, "nope"),
+		},
+		{
+			name:      "OK",
+			tokenFile: tokenFile,
+			uids:      "0,1000",
+			cfg: &wgserver.Config{
+				Tokens: map[string]*wgserver.Access{"secret": a},
+				UIDs:   map[int]*wgserver.Access{0: a, 1000: a},
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := serveConfig(a, tt.tokenFile, tt.uids)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to produce config: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			if diff := cmp.Diff(tt.cfg, cfg); diff != "" {
+				t.Fatalf("unexpected config (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_serveListen(t *testing.T) {
+	tmp, err := ioutil.TempDir(os.TempDir(), "wgctrl-serve")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	cert, key := writeCertificate(t, tmp)
+
+	tests := []struct {
+		name            string
+		addr, cert, key string
+		ok, tls         bool
+	}{
+		{
+			name: "loopback",
+			addr: "127.0.0.1:0",
+			ok:   true,
+		},
+		{
+			name: "all addresses without TLS",
+			addr: ":0",
+		},
+		{
+			name: "non-loopback without TLS",
+			addr: "0.0.0.0:0",
+		},
+		{
+			name: "TLS",
+			addr: "127.0.0.1:0",
+			cert: cert,
+			key:  key,
+			ok:   true,
+			tls:  true,
+		},
+		{
+			name: "certificate without key",
+			addr: "127.0.0.1:0",
+			cert: cert,
+		},
+		{
+			name: "UNIX socket with TLS",
+			addr: unixPrefix + filepath.Join(tmp, "wgctrl.sock"),
+			cert: cert,
+			key:  key,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := serveListen(tt.addr, tt.cert, tt.key)
+			if !tt.ok {
+				if err == nil {
+					_ = l.Close()
+					t.Fatal("expected an error, but none occurred")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			defer l.Close()
+
+			if !tt.tls {
+				return
+			}
+
+			// Complete a TLS handshake to verify the listener.
+			go func() {
+				c, err := l.Accept()
+				if err != nil {
+					return
+				}
+				defer c.Close()
+
+				_ = c.(*tls.Conn).Handshake()
+			}()
+
+			c, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+			if err != nil {
+				t.Fatalf("failed to complete TLS handshake: %v", err)
+			}
+			_ = c.Close()
+		})
+	}
+}
+
+// writeCertificate writes a self-signed certificate and its key to dir.
+func writeCertificate(t *testing.T, dir string) (cert, key string) {
+	t.Helper()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	kb, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	cert, key = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	for _, f := range []struct {
+		path, typ string
+		b         []byte
+	}{
+		{path: cert, typ: "CERTIFICATE", b: der},
+		{path: key, typ: "EC PRIVATE KEY", b: kb},
+	} {
+		pb := pem.EncodeToMemory(&pem.Block{Type: f.typ, Bytes: f.b})
+		if err := ioutil.WriteFile(f.path, pb, 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", f.path, err)
+		}
+	}
+
+	return cert, key
+}
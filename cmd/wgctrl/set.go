@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// cmdSet implements "wgctrl set".
+func cmdSet(c *wgctrl.Client, args []string) error {
+	// --dry-run must precede the interface, as the remaining arguments follow
+	// the grammar of wg(8).
+	dryRun := len(args) > 0 && args[0] == "--dry-run"
+	if dryRun {
+		args = args[1:]
+	}
+
+	device, cfg, err := parseSet(args)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		res, err := c.DryRun(device, *cfg)
+		if err != nil {
+			return fmt.Errorf("failed to get device %q: %v", device, err)
+		}
+
+		printChanges(stdout, res.Changes)
+		return nil
+	}
+
+	if err := c.ConfigureDevice(device, *cfg); err != nil {
+		return fmt.Errorf("failed to configure device %q: %v", device, err)
+	}
+
+	return nil
+}
+
+// printChanges prints the changes predicted by a dry run, one per line.
+func printChanges(w io.Writer, c *wgctrl.Changes) {
+	if c.Empty() {
+		fmt.Fprintln(w, "no changes")
+		return
+	}
+
+	for _, l := range c.Lines() {
+		fmt.Fprintln(w, l)
+	}
+}
+
+// parseSet parses the arguments to "wgctrl set" into a device name and
+// configuration.
+func parseSet(args []string) (string, *wgtypes.Config, error) {
+	if len(args) < 2 {
+		return "", nil, errUsage
+	}
+
+	device, args := args[0], args[1:]
+
+	// value consumes the value following the option at args[0].
+	value := func() (string, error) {
+		if len(args) < 2 {
+			return "", fmt.Errorf("option %q requires a value", args[0])
+		}
+
+		v := args[1]
+		args = args[1:]
+		return v, nil
+	}
+
+	var (
+		cfg  wgtypes.Config
+		peer *wgtypes.PeerConfig
+	)
+
+	for ; len(args) > 0; args = args[1:] {
+		opt := args[0]
+		if opt == "peer" {
+			v, err := value()
+			if err != nil {
+				return "", nil, err
+			}
+
+			k, err := parseKey(v)
+			if err != nil {
+				return "", nil, err
+			}
+
+			cfg.Peers = append(cfg.Peers, wgtypes.PeerConfig{PublicKey: k})
+			peer = &cfg.Peers[len(cfg.Peers)-1]
+			continue
+		}
+
+		// "remove" is the only option without a value.
+		if peer != nil && opt == "remove" {
+			peer.Remove = true
+			continue
+		}
+
+		v, err := value()
+		if err != nil {
+			return "", nil, err
+		}
+
+		if peer == nil {
+			err = setInterfaceOption(&cfg, opt, v)
+		} else {
+			err = setPeerOption(peer, opt, v)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	return device, &cfg, nil
+}
+
+// setInterfaceOption applies an interface option given to "wgctrl set".
+func setInterfaceOption(cfg *wgtypes.Config, opt, v string) error {
+	switch opt {
+	case "listen-port":
+		port, err := parsePort(v)
+		if err != nil {
+			return err
+		}
+		cfg.ListenPort = &port
+	case "fwmark":
+		mark, err := parseFwmark(v)
+		if err != nil {
+			return err
+		}
+		cfg.FirewallMark = &mark
+	case "private-key":
+		k, err := readKeyFile(v)
+		if err != nil {
+			return err
+		}
+		cfg.PrivateKey = &k
+	default:
+		return fmt.Errorf("invalid interface option %q", opt)
+	}
+
+	return nil
+}
+
+// setPeerOption applies a peer option given to "wgctrl set".
+func setPeerOption(p *wgtypes.PeerConfig, opt, v string) error {
+	switch opt {
+	case "preshared-key":
+		k, err := readKeyFile(v)
+		if err != nil {
+			return err
+		}
+		p.PresharedKey = &k
+	case "endpoint":
+		addr, err := parseEndpoint(v)
+		if err != nil {
+			return err
+		}
+		p.Endpoint = addr
+	case "persistent-keepalive":
+		d, err := parseKeepalive(v)
+		if err != nil {
+			return err
+		}
+		p.PersistentKeepaliveInterval = &d
+	case "allowed-ips":
+		ips, err := parseAllowedIPs(v)
+		if err != nil {
+			return err
+		}
+		p.ReplaceAllowedIPs = true
+		p.AllowedIPs = ips
+	default:
+		return fmt.Errorf("invalid peer option %q", opt)
+	}
+
+	return nil
+}
+
+// readKeyFile reads a base64-encoded key from the file at path. As with
+// wg(8), an empty file produces a zero key, which clears the key when
+// applied to a device.
+func readKeyFile(path string) (wgtypes.Key, error) {
+	var (
+		b   []byte
+		err error
+	)
+
+	if path == "/dev/stdin" {
+		// Read stdin directly for platforms without /dev/stdin.
+		b, err = ioutil.ReadAll(stdin)
+	} else {
+		b, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return wgtypes.Key{}, err
+	}
+
+	s := strings.TrimSpace(string(b))
+	if s == "" {
+		return wgtypes.Key{}, nil
+	}
+
+	k, err := parseKey(s)
+	if err != nil {
+		return wgtypes.Key{}, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return k, nil
+}
+
+// parseKey parses a base64-encoded key. The key itself is never included in
+// the error, since it may be private.
+func parseKey(s string) (wgtypes.Key, error) {
+	k, err := wgtypes.ParseKey(s)
+	if err != nil {
+		return wgtypes.Key{}, fmt.Errorf("invalid key: %v", err)
+	}
+
+	return k, nil
+}
+
+// parsePort parses a UDP port number.
+func parsePort(s string) (int, error) {
+	port, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+
+	return int(port), nil
+}
+
+// parseFwmark parses a firewall mark, which may be "off" or a decimal or
+// hexadecimal number.
+func parseFwmark(s string) (int, error) {
+	if s == "off" {
+		return 0, nil
+	}
+
+	mark, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid fwmark %q", s)
+	}
+
+	return int(mark), nil
+}
+
+// parseKeepalive parses a persistent keepalive interval in seconds, which
+// may be "off".
+func parseKeepalive(s string) (time.Duration, error) {
+	if s == "off" {
+		return 0, nil
+	}
+
+	secs, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid persistent keepalive interval %q", s)
+	}
+
+	return time.Duration(secs) * time.Second, nil
+}
+
+// parseAllowedIPs parses a comma-separated list of allowed IPs. Addresses
+// without a prefix length are treated as a single host.
+func parseAllowedIPs(s string) ([]net.IPNet, error) {
+	var ipns []net.IPNet
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+
+		if !strings.Contains(f, "/") {
+			ip := net.ParseIP(f)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid allowed IP %q", f)
+			}
+
+			if ip4 := ip.To4(); ip4 != nil {
+				f += "/32"
+			} else {
+				f += "/128"
+			}
+		}
+
+		_, ipn, err := net.ParseCIDR(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed IP %q", f)
+		}
+
+		ipns = append(ipns, *ipn)
+	}
+
+	return ipns, nil
+}
+
+// parseEndpoint parses and resolves a peer endpoint of the form host:port.
+func parseEndpoint(s string) (*net.UDPAddr, error) {
+	addr, err := net.ResolveUDPAddr("udp", s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %q: %v", s, err)
+	}
+
+	if ip4 := addr.IP.To4(); ip4 != nil {
+		addr.IP = ip4
+	}
+
+	return addr, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func Test_parseSet(t *testing.T) {
+	tmp, err := ioutil.TempDir(os.TempDir(), "wgctrl-set")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var (
+		priv = wgtest.MustPrivateKey()
+		pub  = wgtest.MustPublicKey()
+		psk  = wgtest.MustPresharedKey()
+
+		port = 51820
+		mark = 0
+		keep = 25 * time.Second
+		zero wgtypes.Key
+	)
+
+	privFile := filepath.Join(tmp, "private")
+	if err := ioutil.WriteFile(privFile, []byte(priv.String()+"\n"), 0600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+
+	emptyFile := filepath.Join(tmp, "empty")
+	if err := ioutil.WriteFile(emptyFile, nil, 0600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		args  string
+		stdin string
+		cfg   *wgtypes.Config
+		ok    bool
+	}{
+		{
+			name: "no options",
+			args: "wg0",
+		},
+		{
+			name: "missing value",
+			args: "wg0 listen-port",
+		},
+		{
+			name: "unknown interface option",
+			args: "wg0 address 192.0.2.1",
+		},
+		{
+			name: "interface option after peer",
+			args: "wg0 peer " + pub.String() + " listen-port 1",
+		},
+		{
+			name: "remove without peer",
+			args: "wg0 remove",
+		},
+		{
+			name: "bad keepalive",
+			args: "wg0 peer " + pub.String() + " persistent-keepalive 65536",
+		},
+		{
+			name: "OK interface",
+			args: "wg0 listen-port 51820 fwmark off private-key " + privFile,
+			cfg: &wgtypes.Config{
+				PrivateKey:   &priv,
+				ListenPort:   &port,
+				FirewallMark: &mark,
+			},
+			ok: true,
+		},
+		{
+			name:  "OK peers",
+			args:  "wg0 peer " + pub.String() + " preshared-key /dev/stdin endpoint 192.0.2.1:51820 persistent-keepalive 25 allowed-ips 192.0.2.0/24,2001:db8::/32 peer " + priv.PublicKey().String() + " remove",
+			stdin: psk.String(),
+			cfg: &wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{
+					{
+						PublicKey:                   pub,
+						PresharedKey:                &psk,
+						Endpoint:                    wgtest.MustUDPAddr("192.0.2.1:51820"),
+						PersistentKeepaliveInterval: &keep,
+						ReplaceAllowedIPs:           true,
+						AllowedIPs: []net.IPNet{
+							wgtest.MustCIDR("192.0.2.0/24"),
+							wgtest.MustCIDR("2001:db8::/32"),
+						},
+					},
+					{
+						PublicKey: priv.PublicKey(),
+						Remove:    true,
+					},
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "OK clear",
+			args: "wg0 peer " + pub.String() + " preshared-key " + emptyFile + " allowed-ips ''",
+			cfg: &wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey:         pub,
+					PresharedKey:      &zero,
+					ReplaceAllowedIPs: true,
+				}},
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdin = strings.NewReader(tt.stdin)
+			defer func() { stdin = os.Stdin }()
+
+			// Allow an empty argument in the test table.
+			args := strings.Fields(tt.args)
+			for i := range args {
+				if args[i] == "''" {
+					args[i] = ""
+				}
+			}
+
+			device, cfg, err := parseSet(args)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to parse arguments: %v", err)
+			}
+			if !tt.ok {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+
+				return
+			}
+
+			if diff := cmp.Diff("wg0", device); diff != "" {
+				t.Fatalf("unexpected device (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.cfg, cfg); diff != "" {
+				t.Fatalf("unexpected Config (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// cmdShow implements "wgctrl show".
+func cmdShow(c *wgctrl.Client, args []string) error {
+	fs := flag.NewFlagSet("show", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	var (
+		format  = fs.String("format", "pretty", "")
+		resolve = fs.Bool("resolve", false, "")
+	)
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	args = fs.Args()
+	if len(args) > 2 {
+		return errUsage
+	}
+
+	p, err := parseFormat(*format, *resolve)
+	if err != nil {
+		return err
+	}
+
+	device := "all"
+	if len(args) > 0 {
+		device = args[0]
+	}
+
+	if len(args) == 2 {
+		if _, ok := fields[args[1]]; !ok {
+			return fmt.Errorf("unknown field %q", args[1])
+		}
+		if *format != "pretty" {
+			return errors.New("--format cannot be used with a field")
+		}
+
+		p = fieldPrinter(args[1])
+	}
+
+	var devices []*wgtypes.Device
+	switch device {
+	case "all":
+		devices, err = sortedDevices(c)
+		if err != nil {
+			return err
+		}
+	case "interfaces":
+		if len(args) > 1 {
+			return errUsage
+		}
+
+		return printInterfaces(c, *format == "json")
+	default:
+		d, err := c.Device(device)
+		if err != nil {
+			return fmt.Errorf("failed to get device %q: %v", device, err)
+		}
+
+		devices = []*wgtypes.Device{d}
+	}
+
+	return p(stdout, devices, device == "all")
+}
+
+// printInterfaces prints the names of all devices.
+func printInterfaces(c *wgctrl.Client, asJSON bool) error {
+	devices, err := sortedDevices(c)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(devices))
+	for _, d := range devices {
+		names = append(names, d.Name)
+	}
+
+	if asJSON {
+		return json.NewEncoder(stdout).Encode(names)
+	}
+
+	_, err = fmt.Fprintln(stdout, strings.Join(names, " "))
+	return err
+}
+
+// cmdShowconf implements "wgctrl showconf".
+func cmdShowconf(c *wgctrl.Client, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	d, err := c.Device(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to get device %q: %v", args[0], err)
+	}
+
+	// A configuration without the device's keys would remove them when it
+	// is applied by setconf or syncconf.
+	if d.KeysRedacted {
+		return fmt.Errorf("keys of device %q are redacted by its backend", args[0])
+	}
+
+	return writeConfig(stdout, d)
+}
+
+// sortedDevices fetches all devices, sorted by name.
+func sortedDevices(c *wgctrl.Client) ([]*wgtypes.Device, error) {
+	devices, err := c.Devices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get devices: %v", err)
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Name < devices[j].Name
+	})
+
+	return devices, nil
+}
+
+func ipsString(ipns []net.IPNet) string {
+	ss := make([]string, 0, len(ipns))
+	for _, ipn := range ipns {
+		ss = append(ss, ipn.String())
+	}
+
+	return strings.Join(ss, ", ")
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// termClear moves the cursor to the top left and clears the terminal.
+const termClear = "\x1b[H\x1b[2J"
+
+// keyPrefixLen is the number of characters of a public key displayed by
+// "wgctrl watch"; enough to identify a peer at a glance.
+const keyPrefixLen = 16
+
+// cmdWatch implements "wgctrl watch".
+func cmdWatch(c *wgctrl.Client, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	var (
+		interval = fs.Duration("interval", 1*time.Second, "")
+		sortBy   = fs.String("sort", sortDevice, "")
+		filter   = fs.String("filter", "", "")
+	)
+	if err := fs.Parse(args); err != nil || fs.NArg() > 1 || *interval <= 0 {
+		return errUsage
+	}
+
+	if _, ok := rowOrders[*sortBy]; !ok {
+		return fmt.Errorf("unknown sort order %q", *sortBy)
+	}
+
+	device := fs.Arg(0)
+	color := useColor()
+
+	sigC := make(chan os.Signal, 1)
+	signal.Notify(sigC, os.Interrupt)
+	defer signal.Stop(sigC)
+
+	t := time.NewTicker(*interval)
+	defer t.Stop()
+
+	var (
+		prev *sample
+		b    bytes.Buffer
+	)
+
+	for {
+		cur, err := takeSample(c, device)
+		if err != nil {
+			return err
+		}
+
+		rows := buildRows(prev, cur, *filter)
+		sortRows(rows, *sortBy)
+
+		b.Reset()
+		if color {
+			b.WriteString(termClear)
+		} else if prev != nil {
+			b.WriteString("\n")
+		}
+
+		renderRows(&b, rows, color)
+		if _, err := b.WriteTo(stdout); err != nil {
+			return err
+		}
+
+		prev = cur
+
+		select {
+		case <-sigC:
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// A sample is the state of one or more devices at a point in time.
+type sample struct {
+	at      time.Time
+	devices []*wgtypes.Device
+}
+
+// takeSample fetches the named device, or all devices if device is empty.
+func takeSample(c *wgctrl.Client, device string) (*sample, error) {
+	if device == "" {
+		devices, err := sortedDevices(c)
+		if err != nil {
+			return nil, err
+		}
+
+		return &sample{at: time.Now(), devices: devices}, nil
+	}
+
+	d, err := c.Device(device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device %q: %v", device, err)
+	}
+
+	return &sample{at: time.Now(), devices: []*wgtypes.Device{d}}, nil
+}
+
+// A row is a single peer in the "wgctrl watch" table.
+type row struct {
+	Device    string
+	PublicKey wgtypes.Key
+	Endpoint  string
+
+	// Handshake is the time since the latest handshake, or -1 if none has
+	// occurred.
+	Handshake time.Duration
+
+	ReceiveBytes, TransmitBytes int64
+	ReceiveRate, TransmitRate   float64
+
+	// Changed reports whether the peer is new, or its endpoint or latest
+	// handshake changed since the previous sample.
+	Changed bool
+}
+
+// buildRows produces a row for each peer in cur whose public key begins with
+// filter. Rates are computed against prev, which may be nil.
+func buildRows(prev, cur *sample, filter string) []row {
+	type peerID struct {
+		device string
+		key    wgtypes.Key
+	}
+
+	before := make(map[peerID]*wgtypes.Peer)
+	if prev != nil {
+		for _, d := range prev.devices {
+			for i, p := range d.Peers {
+				before[peerID{d.Name, p.PublicKey}] = &d.Peers[i]
+			}
+		}
+	}
+
+	var rows []row
+	for _, d := range cur.devices {
+		for _, p := range d.Peers {
+			if !strings.HasPrefix(p.PublicKey.String(), filter) {
+				continue
+			}
+
+			r := row{
+				Device:        d.Name,
+				PublicKey:     p.PublicKey,
+				Endpoint:      endpointString(p.Endpoint),
+				Handshake:     -1,
+				ReceiveBytes:  p.ReceiveBytes,
+				TransmitBytes: p.TransmitBytes,
+			}
+
+			if !p.LastHandshakeTime.IsZero() {
+				r.Handshake = cur.at.Sub(p.LastHandshakeTime).Truncate(time.Second)
+			}
+
+			if prev == nil {
+				rows = append(rows, r)
+				continue
+			}
+
+			old, ok := before[peerID{d.Name, p.PublicKey}]
+			if !ok {
+				r.Changed = true
+				rows = append(rows, r)
+				continue
+			}
+
+			r.Changed = endpointString(old.Endpoint) != r.Endpoint ||
+				!old.LastHandshakeTime.Equal(p.LastHandshakeTime)
+
+			secs := cur.at.Sub(prev.at).Seconds()
+			r.ReceiveRate = rate(old.ReceiveBytes, p.ReceiveBytes, secs)
+			r.TransmitRate = rate(old.TransmitBytes, p.TransmitBytes, secs)
+
+			rows = append(rows, r)
+		}
+	}
+
+	return rows
+}
+
+// rate computes bytes per second between two counter values. Counters which
+// go backward, such as when a peer is removed and added again, produce 0.
+func rate(before, after int64, secs float64) float64 {
+	if after < before || secs <= 0 {
+		return 0
+	}
+
+	return float64(after-before) / secs
+}
+
+// Sort orders for "wgctrl watch".
+const (
+	sortDevice    = "device"
+	sortKey       = "key"
+	sortHandshake = "handshake"
+	sortRX        = "rx"
+	sortTX        = "tx"
+)
+
+// rowOrders are the less functions for each sort order. Every order falls
+// back to sorting by device and public key.
+var rowOrders = map[string]func(a, b *row) bool{
+	sortDevice: func(a, b *row) bool { return false },
+	sortKey: func(a, b *row) bool {
+		return bytes.Compare(a.PublicKey[:], b.PublicKey[:]) < 0
+	},
+	sortHandshake: func(a, b *row) bool {
+		// Most recent first, and peers without a handshake last.
+		if a.Handshake < 0 || b.Handshake < 0 {
+			return a.Handshake >= 0 && b.Handshake < 0
+		}
+
+		return a.Handshake < b.Handshake
+	},
+	sortRX: func(a, b *row) bool { return a.ReceiveRate > b.ReceiveRate },
+	sortTX: func(a, b *row) bool { return a.TransmitRate > b.TransmitRate },
+}
+
+// sortRows sorts rows by the named order.
+func sortRows(rows []row, by string) {
+	less := rowOrders[by]
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := &rows[i], &rows[j]
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+
+		if a.Device != b.Device {
+			return a.Device < b.Device
+		}
+
+		return bytes.Compare(a.PublicKey[:], b.PublicKey[:]) < 0
+	})
+}
+
+// renderRows writes rows as an aligned table, highlighting changed rows if
+// color is enabled.
+func renderRows(w io.Writer, rows []row, color bool) {
+	// Format rates and counters without color, so that cells can be aligned.
+	plain := &pretty{}
+
+	table := [][]string{{"DEVICE", "PEER", "ENDPOINT", "HANDSHAKE", "RX/s", "TX/s", "RX", "TX"}}
+	for _, r := range rows {
+		hs := "never"
+		if r.Handshake >= 0 {
+			hs = r.Handshake.String()
+		}
+
+		table = append(table, []string{
+			r.Device,
+			r.PublicKey.String()[:keyPrefixLen],
+			r.Endpoint,
+			hs,
+			plain.bytes(int64(r.ReceiveRate)) + "/s",
+			plain.bytes(int64(r.TransmitRate)) + "/s",
+			plain.bytes(r.ReceiveBytes),
+			plain.bytes(r.TransmitBytes),
+		})
+	}
+
+	widths := make([]int, len(table[0]))
+	for _, cells := range table {
+		for i, c := range cells {
+			if len(c) > widths[i] {
+				widths[i] = len(c)
+			}
+		}
+	}
+
+	pp := &pretty{color: color}
+	for i, cells := range table {
+		padded := make([]string, len(cells))
+		for j, c := range cells {
+			padded[j] = fmt.Sprintf("%-*s", widths[j], c)
+		}
+
+		line := strings.TrimRight(strings.Join(padded, "  "), " ")
+		switch {
+		case i == 0:
+			line = pp.paint(termBold, line)
+		case rows[i-1].Changed:
+			line = pp.paint(termBold+termYellow, line)
+		}
+
+		fmt.Fprintln(w, line)
+	}
+}
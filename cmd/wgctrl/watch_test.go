@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func Test_buildRows(t *testing.T) {
+	var (
+		now = time.Unix(1600000000, 0)
+
+		a = wgtest.MustPublicKey()
+		b = wgtest.MustPublicKey()
+		c = wgtest.MustPublicKey()
+	)
+
+	prev := &sample{
+		at: now.Add(-2 * time.Second),
+		devices: []*wgtypes.Device{{
+			Name: "wg0",
+			Peers: []wgtypes.Peer{
+				{
+					PublicKey:         a,
+					Endpoint:          wgtest.MustUDPAddr("192.0.2.1:51820"),
+					LastHandshakeTime: now.Add(-time.Minute),
+					ReceiveBytes:      1000,
+					TransmitBytes:     1000,
+				},
+				{
+					PublicKey:     b,
+					ReceiveBytes:  5000,
+					TransmitBytes: 5000,
+				},
+			},
+		}},
+	}
+
+	cur := &sample{
+		at: now,
+		devices: []*wgtypes.Device{{
+			Name: "wg0",
+			Peers: []wgtypes.Peer{
+				{
+					PublicKey:         a,
+					Endpoint:          wgtest.MustUDPAddr("192.0.2.1:51820"),
+					LastHandshakeTime: now.Add(-time.Minute),
+					ReceiveBytes:      3048,
+					TransmitBytes:     2000,
+				},
+				{
+					// Counters reset and a new endpoint.
+					PublicKey:     b,
+					Endpoint:      wgtest.MustUDPAddr("192.0.2.2:51820"),
+					ReceiveBytes:  10,
+					TransmitBytes: 10,
+				},
+				{
+					PublicKey: c,
+				},
+			},
+		}},
+	}
+
+	want := []row{
+		{
+			Device:        "wg0",
+			PublicKey:     a,
+			Endpoint:      "192.0.2.1:51820",
+			Handshake:     time.Minute,
+			ReceiveBytes:  3048,
+			TransmitBytes: 2000,
+			ReceiveRate:   1024,
+			TransmitRate:  500,
+		},
+		{
+			Device:        "wg0",
+			PublicKey:     b,
+			Endpoint:      "192.0.2.2:51820",
+			Handshake:     -1,
+			ReceiveBytes:  10,
+			TransmitBytes: 10,
+			Changed:       true,
+		},
+		{
+			Device:    "wg0",
+			PublicKey: c,
+			Endpoint:  "(none)",
+			Handshake: -1,
+			Changed:   true,
+		},
+	}
+
+	if diff := cmp.Diff(want, buildRows(prev, cur, "")); diff != "" {
+		t.Fatalf("unexpected rows (-want +got):\n%s", diff)
+	}
+
+	rows := buildRows(nil, cur, b.String()[:8])
+	if len(rows) != 1 || rows[0].PublicKey != b || rows[0].Changed {
+		t.Fatalf("unexpected filtered rows: %#v", rows)
+	}
+}
+
+func Test_sortRows(t *testing.T) {
+	rows := []row{
+		{Device: "wg1", Handshake: -1, ReceiveRate: 10},
+		{Device: "wg0", Handshake: 2 * time.Second, ReceiveRate: 30},
+		{Device: "wg2", Handshake: time.Second, ReceiveRate: 20},
+	}
+
+	tests := []struct {
+		by   string
+		want []string
+	}{
+		{by: sortDevice, want: []string{"wg0", "wg1", "wg2"}},
+		{by: sortHandshake, want: []string{"wg2", "wg0", "wg1"}},
+		{by: sortRX, want: []string{"wg0", "wg2", "wg1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.by, func(t *testing.T) {
+			sortRows(rows, tt.by)
+
+			var got []string
+			for _, r := range rows {
+				got = append(got, r.Device)
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("unexpected order (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_renderRows(t *testing.T) {
+	k := wgtest.MustPublicKey()
+
+	rows := []row{{
+		Device:       "wg0",
+		PublicKey:    k,
+		Endpoint:     "192.0.2.1:51820",
+		Handshake:    time.Minute + 3*time.Second,
+		ReceiveBytes: 2048,
+		ReceiveRate:  1536,
+		Changed:      true,
+	}}
+
+	var b bytes.Buffer
+	renderRows(&b, rows, false)
+
+	want := strings.Join([]string{
+		"DEVICE  PEER              ENDPOINT         HANDSHAKE  RX/s        TX/s   RX        TX",
+		"wg0     " + k.String()[:keyPrefixLen] + "  192.0.2.1:51820  1m3s       1.50 KiB/s  0 B/s  2.00 KiB  0 B",
+		"",
+	}, "\n")
+
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Fatalf("unexpected table (-want +got):\n%s", diff)
+	}
+}
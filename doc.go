@@ -15,6 +15,9 @@
 //   - **Experimental:** OpenBSD kernel module devices, via ioctl interface
 //     See <https://git.zx2c4.com/wireguard-openbsd/about/> for details. Specify
 //     environment variable WGCTRL_OPENBSD_KERNEL=1 to enable this interface.
+//   - embedded devices, which run wireguard-go within the current process and
+//     can use a virtual TUN which requires no privileges; see
+//     Client.CreateEmbeddedDevice
 //
 // As new operating systems add support for in-kernel WireGuard implementations,
 // this package should also be extended to support those native implementations.
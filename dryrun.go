@@ -0,0 +1,49 @@
+package wgctrl
+
+import (
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgstate"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// A DryRunResult reports the predicted outcome of applying a configuration to
+// a device, as produced by DryRun.
+type DryRunResult struct {
+	// Before is the device as it is now.
+	Before *wgtypes.Device
+
+	// After is the device as it is predicted to be once the configuration is
+	// applied.
+	After *wgtypes.Device
+
+	// Changes describes the differences between Before and After.
+	Changes *Changes
+}
+
+// DryRun predicts the effect of configuring a WireGuard device by its interface
+// name with cfg, without modifying the device.
+//
+// The device is retrieved and cfg is applied to a copy of it following the
+// semantics of the WireGuard implementations: for example, an allowed IP added
+// to one peer is removed from any other peer, and a peer whose public key
+// matches the device's own is removed. Statistics and handshakes are carried
+// over from the existing peers unchanged.
+//
+// The prediction may not hold if the device changes before cfg is applied.
+// A listen port of 0 is chosen by the implementation when cfg is applied, and
+// is predicted as 0.
+//
+// If the device specified by name does not exist or is not a WireGuard device,
+// an error is returned which can be checked using os.IsNotExist.
+func (c *Client) DryRun(name string, cfg wgtypes.Config) (*DryRunResult, error) {
+	before, err := c.Device(name)
+	if err != nil {
+		return nil, err
+	}
+
+	after := wgstate.Simulate(before, cfg)
+	return &DryRunResult{
+		Before:  before,
+		After:   after,
+		Changes: CompareDevices(before, after),
+	}, nil
+}
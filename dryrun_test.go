@@ -0,0 +1,120 @@
+package wgctrl
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgstate"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestClientDryRun(t *testing.T) {
+	var (
+		keyA = wgtest.MustPublicKey()
+		keyB = wgtest.MustPublicKey()
+		keyC = wgtest.MustPublicKey()
+		ipA  = wgtest.MustCIDR("10.0.0.1/32")
+		ipB  = wgtest.MustCIDR("10.0.0.2/32")
+		ipC  = wgtest.MustCIDR("10.0.0.3/32")
+		addr = wgtest.MustUDPAddr("[fd00::1]:51820")
+
+		port = 51821
+		keep = 25 * time.Second
+	)
+
+	before := &wgtypes.Device{
+		Name:       "wg0",
+		ListenPort: 51820,
+		Peers: []wgtypes.Peer{
+			{PublicKey: keyA, AllowedIPs: []net.IPNet{ipA}},
+			{PublicKey: keyB, AllowedIPs: []net.IPNet{ipB}},
+		},
+	}
+
+	m := wgtest.NewMemClient(before)
+	c := &Client{cs: []wginternal.Client{m}}
+
+	tests := []struct {
+		name  string
+		cfg   wgtypes.Config
+		lines []string
+	}{
+		{
+			name: "no changes",
+			cfg: wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey:  keyA,
+					AllowedIPs: []net.IPNet{ipA},
+				}},
+			},
+		},
+		{
+			name: "changes",
+			cfg: wgtypes.Config{
+				ListenPort: &port,
+				Peers: []wgtypes.PeerConfig{
+					{
+						PublicKey: keyA,
+						Remove:    true,
+					},
+					{
+						PublicKey:                   keyB,
+						Endpoint:                    addr,
+						PersistentKeepaliveInterval: &keep,
+						AllowedIPs:                  []net.IPNet{ipA},
+					},
+					{
+						PublicKey:  keyC,
+						AllowedIPs: []net.IPNet{ipC, ipB},
+					},
+				},
+			},
+			lines: []string{
+				"listen-port: 51820 -> 51821",
+				fmt.Sprintf("peer %s: removed", keyA),
+				fmt.Sprintf("peer %s: added", keyC),
+				fmt.Sprintf("peer %s: allowed-ips: (none) -> 10.0.0.2/32, 10.0.0.3/32", keyC),
+				fmt.Sprintf("peer %s: endpoint: (none) -> [fd00::1]:51820", keyB),
+				fmt.Sprintf("peer %s: persistent-keepalive: off -> 25", keyB),
+				fmt.Sprintf("peer %s: allowed-ips: 10.0.0.2/32 -> 10.0.0.1/32", keyB),
+				fmt.Sprintf("allowed IP 10.0.0.1/32: moved from peer %s to peer %s", keyA, keyB),
+				fmt.Sprintf("allowed IP 10.0.0.2/32: moved from peer %s to peer %s", keyB, keyC),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := c.DryRun("wg0", tt.cfg)
+			if err != nil {
+				t.Fatalf("failed to perform dry run: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.lines, res.Changes.Lines()); diff != "" {
+				t.Fatalf("unexpected changes (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(len(tt.lines) == 0, res.Changes.Empty()); diff != "" {
+				t.Fatalf("unexpected empty (-want +got):\n%s", diff)
+			}
+
+			if !wgstate.Equal(wgstate.Simulate(before, tt.cfg), res.After) {
+				t.Fatalf("unexpected predicted device:\n%+v", res.After)
+			}
+
+			// The device itself must not be modified.
+			if !wgstate.Equal(before, m.State("wg0")) {
+				t.Fatalf("device was modified by dry run:\n%+v", m.State("wg0"))
+			}
+		})
+	}
+
+	if _, err := c.DryRun("wg1", wgtypes.Config{}); !os.IsNotExist(err) {
+		t.Fatalf("expected is not exist, but got: %v", err)
+	}
+}
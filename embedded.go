@@ -0,0 +1,107 @@
+package wgctrl
+
+import (
+	"context"
+	"net"
+	"os"
+
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgembed"
+)
+
+// EmbeddedDeviceOptions specify optional configuration for an EmbeddedDevice.
+type EmbeddedDeviceOptions struct {
+	// KernelTUN specifies that an operating system TUN interface with the
+	// device's name is created, which typically requires elevated privileges.
+	//
+	// By default, a virtual TUN which requires no privileges is used. It is
+	// backed by a userspace network stack, and TCP and UDP sockets are opened
+	// over the device's tunnels using its DialContext, Listen, and
+	// ListenPacket methods.
+	KernelTUN bool
+
+	// Addresses are the IP addresses of the device's virtual TUN, which its
+	// sockets use within the tunnels. Addresses is ignored when KernelTUN is
+	// set.
+	Addresses []net.IP
+
+	// MTU specifies the MTU of the device's TUN. If zero, 1420 is used.
+	MTU int
+
+	// Loopback specifies that the device sends and receives WireGuard traffic
+	// using UDP on the IPv4 loopback address only, so that its peers must run
+	// on the same host. By default, the device listens on all interfaces.
+	Loopback bool
+
+	// Logf, if not nil, receives log messages from the device.
+	Logf func(format string, v ...interface{})
+}
+
+// An EmbeddedDevice is a userspace WireGuard device which runs within the
+// current process. Once created, it can be controlled using the Client's
+// Device, Devices, and ConfigureDevice methods like any other device.
+type EmbeddedDevice struct {
+	d *wgembed.Device
+}
+
+// CreateEmbeddedDevice creates an EmbeddedDevice with the specified name,
+// using the wireguard-go implementation. The device is closed when either its
+// Close method or the Client's Close method is called. If opts is nil, a
+// default configuration is used.
+//
+// If a device with the same name already exists, an error is returned which
+// can be checked using os.IsExist.
+func (c *Client) CreateEmbeddedDevice(name string, opts *EmbeddedDeviceOptions) (*EmbeddedDevice, error) {
+	if c.embed == nil {
+		return nil, ErrNotSupported
+	}
+
+	if opts == nil {
+		opts = &EmbeddedDeviceOptions{}
+	}
+
+	// Don't shadow a device owned by the operating system or another process.
+	if _, err := c.Device(name); err == nil {
+		return nil, os.ErrExist
+	}
+
+	d, err := c.embed.Create(name, wgembed.Config{
+		KernelTUN: opts.KernelTUN,
+		Addresses: opts.Addresses,
+		MTU:       opts.MTU,
+		Loopback:  opts.Loopback,
+		Logf:      opts.Logf,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &EmbeddedDevice{d: d}, nil
+}
+
+// Name returns the name of the device.
+func (d *EmbeddedDevice) Name() string { return d.d.Name() }
+
+// DialContext connects to address over the device's tunnels. The network
+// must be one of "tcp", "tcp4", "tcp6", "udp", "udp4", or "udp6", and address
+// must contain an IP address rather than a host name. DialContext returns an
+// error if the device uses a kernel TUN interface.
+func (d *EmbeddedDevice) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return d.d.DialContext(ctx, network, address)
+}
+
+// Listen listens for TCP connections on address over the device's tunnels.
+// The network must be one of "tcp", "tcp4", or "tcp6". Listen returns an
+// error if the device uses a kernel TUN interface.
+func (d *EmbeddedDevice) Listen(network, address string) (net.Listener, error) {
+	return d.d.Listen(network, address)
+}
+
+// ListenPacket listens for UDP datagrams on address over the device's
+// tunnels. The network must be one of "udp", "udp4", or "udp6". ListenPacket
+// returns an error if the device uses a kernel TUN interface.
+func (d *EmbeddedDevice) ListenPacket(network, address string) (net.PacketConn, error) {
+	return d.d.ListenPacket(network, address)
+}
+
+// Close stops the device and removes it from its Client.
+func (d *EmbeddedDevice) Close() error { return d.d.Close() }
@@ -0,0 +1,92 @@
+package wgctrl_test
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestClientEmbeddedDevice(t *testing.T) {
+	c, err := wgctrl.New()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer c.Close()
+
+	const name = "wgembedtest0"
+	ed, err := c.CreateEmbeddedDevice(name, nil)
+	if err != nil {
+		t.Fatalf("failed to create embedded device: %v", err)
+	}
+
+	if _, err := c.CreateEmbeddedDevice(name, nil); !os.IsExist(err) {
+		t.Fatalf("expected already exists error, but got: %v", err)
+	}
+
+	var (
+		priv    = wgtest.MustPrivateKey()
+		peerKey = wgtest.MustPublicKey()
+		port    = 0
+		ips     = []net.IPNet{wgtest.MustCIDR("192.0.2.0/24")}
+	)
+
+	err = c.ConfigureDevice(name, wgtypes.Config{
+		PrivateKey:   &priv,
+		ListenPort:   &port,
+		ReplacePeers: true,
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey:  peerKey,
+			AllowedIPs: ips,
+		}},
+	})
+	if err != nil {
+		t.Fatalf("failed to configure embedded device: %v", err)
+	}
+
+	d, err := c.Device(name)
+	if err != nil {
+		t.Fatalf("failed to get embedded device: %v", err)
+	}
+
+	// The listen port is chosen by the system, so ignore it.
+	want := &wgtypes.Device{
+		Name:       name,
+		Type:       wgtypes.Userspace,
+		PrivateKey: priv,
+		PublicKey:  priv.PublicKey(),
+		ListenPort: d.ListenPort,
+		Peers: []wgtypes.Peer{{
+			PublicKey:         peerKey,
+			LastHandshakeTime: time.Time{},
+			AllowedIPs:        ips,
+			ProtocolVersion:   1,
+		}},
+	}
+
+	if diff := cmp.Diff(want, d); diff != "" {
+		t.Fatalf("unexpected Device (-want +got):\n%s", diff)
+	}
+
+	caps, err := c.Capabilities(name)
+	if err != nil {
+		t.Fatalf("failed to get embedded device capabilities: %v", err)
+	}
+
+	if !caps.Has(wgtypes.CapabilityConfigure|wgtypes.CapabilityCreate) || caps.Type != wgtypes.Userspace {
+		t.Fatalf("unexpected capabilities: %+v", caps)
+	}
+
+	if err := ed.Close(); err != nil {
+		t.Fatalf("failed to close embedded device: %v", err)
+	}
+
+	if _, err := c.Device(name); !os.IsNotExist(err) {
+		t.Fatalf("expected is not exist error, but got: %v", err)
+	}
+}
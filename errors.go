@@ -0,0 +1,52 @@
+package wgctrl
+
+import "golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+
+var (
+	// ErrReadOnly indicates that the driver backing a device is read-only,
+	// and cannot be configured. Use errors.Is to check for this error.
+	ErrReadOnly = wginternal.ErrReadOnly
+
+	// ErrNotSupported indicates that an optional operation, such as watching
+	// devices or creating embedded devices, is not supported by the drivers
+	// on this system. Use errors.Is to check for this error.
+	ErrNotSupported = wginternal.ErrNotSupported
+)
+
+// An OpError is an error returned by an operation on a device. Use errors.As
+// to access an OpError, and errors.Is to check its underlying error, such as
+// ErrReadOnly or a syscall.Errno reported by the kernel.
+//
+// Errors which indicate that a device does not exist or that permission was
+// denied are not wrapped in an OpError, so that they remain compatible with
+// os.IsNotExist and os.IsPermission, which do not unwrap errors.
+type OpError struct {
+	// Backend identifies the device backend, such as "wglinux" for Linux
+	// kernel devices, or "wguser" for userspace and embedded devices.
+	Backend string
+
+	// Op is the operation which failed: "get" or "set".
+	Op string
+
+	// Device is the name of the device.
+	Device string
+
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements error.
+func (e *OpError) Error() string { return (*wginternal.OpError)(e).Error() }
+
+// Unwrap returns the underlying error, for use with errors.Is and errors.As.
+func (e *OpError) Unwrap() error { return e.Err }
+
+// wrapError converts an error returned by a backend into an OpError, if it
+// reports the failure of an operation.
+func wrapError(err error) error {
+	if oerr, ok := err.(*wginternal.OpError); ok {
+		return (*OpError)(oerr)
+	}
+
+	return err
+}
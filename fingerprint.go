@@ -0,0 +1,69 @@
+package wgctrl
+
+import (
+	"encoding/hex"
+	"errors"
+
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgstate"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// ErrConflict indicates that a device's configuration changed since its
+// Fingerprint was computed, so a configuration was not applied. Use errors.Is
+// to check for this error.
+var ErrConflict = errors.New("wgctrl: device configuration changed since it was read")
+
+// A Fingerprint is a stable hash of the configuration of a device, as
+// returned by DeviceFingerprint.
+type Fingerprint [32]byte
+
+// DeviceFingerprint computes a Fingerprint of the configuration of d: its
+// private key, listen port, and firewall mark, and the public key, preshared
+// key, persistent keepalive interval, and allowed IPs of each of its peers.
+// The name and type of d, statistics, handshakes, and the order of peers and
+// allowed IPs do not affect the Fingerprint. Nor do the endpoints of peers,
+// which a device updates as its peers roam.
+func DeviceFingerprint(d *wgtypes.Device) Fingerprint {
+	return Fingerprint(wgstate.Fingerprint(d))
+}
+
+// String returns the hexadecimal string representation of a Fingerprint.
+func (f Fingerprint) String() string {
+	return hex.EncodeToString(f[:])
+}
+
+// ConfigureDeviceIf configures a WireGuard device by its interface name, as
+// with ConfigureDevice, only if the configuration of the device still matches
+// expected, a Fingerprint typically computed from a device previously
+// retrieved by the caller. If the device has changed, it is not configured and
+// an error is returned which can be checked using errors.Is and ErrConflict.
+// The refused attempt is recorded by the audit sink set by Options.Audit.
+//
+// None of the supported backends can check and configure a device atomically,
+// so the device is retrieved and its Fingerprint checked immediately before
+// cfg is applied. A change made by another process between that check and
+// the configuration is not detected, and may be overwritten by cfg. If
+// locking is enabled by Options.Lock, the device is locked for both steps, so
+// only changes made by processes which do not lock devices, such as wg(8),
+// can occur in this window.
+func (c *Client) ConfigureDeviceIf(name string, expected Fingerprint, cfg wgtypes.Config) error {
+	return c.withLock(name, func() error {
+		return c.configureDeviceIf(name, expected, cfg)
+	})
+}
+
+// configureDeviceIf implements ConfigureDeviceIf without locking the device.
+func (c *Client) configureDeviceIf(name string, expected Fingerprint, cfg wgtypes.Config) error {
+	d, err := c.Device(name)
+	if err != nil {
+		return err
+	}
+
+	if DeviceFingerprint(d) != expected {
+		// The refusal is recorded with the audit sink, like any other failed
+		// attempt.
+		return c.record(c.actor, name, d, d, ErrConflict)
+	}
+
+	return c.configureDevice(name, cfg)
+}
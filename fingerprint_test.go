@@ -0,0 +1,48 @@
+package wgctrl
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgstate"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestClientConfigureDeviceIf(t *testing.T) {
+	var (
+		keyA = wgtest.MustPublicKey()
+		keyB = wgtest.MustPublicKey()
+		ipA  = wgtest.MustCIDR("10.0.0.1/32")
+	)
+
+	m := wgtest.NewMemClient(&wgtypes.Device{
+		Name:  "wg0",
+		Peers: []wgtypes.Peer{{PublicKey: keyA, AllowedIPs: []net.IPNet{ipA}}},
+	})
+	c := &Client{cs: []wginternal.Client{m}}
+
+	d, err := c.Device("wg0")
+	if err != nil {
+		t.Fatalf("failed to get device: %v", err)
+	}
+	fp := DeviceFingerprint(d)
+
+	addB := wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: keyB}}}
+	if err := c.ConfigureDeviceIf("wg0", fp, addB); err != nil {
+		t.Fatalf("failed to configure device: %v", err)
+	}
+
+	// The device has changed, so the stale fingerprint must be rejected and
+	// the device left untouched.
+	want := m.State("wg0")
+	removeA := wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: keyA, Remove: true}}}
+	if err := c.ConfigureDeviceIf("wg0", fp, removeA); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected conflict, but got: %v", err)
+	}
+	if !wgstate.Equal(want, m.State("wg0")) {
+		t.Fatalf("device was modified after a conflict:\n%+v", m.State("wg0"))
+	}
+}
@@ -1,13 +1,22 @@
 module golang.zx2c4.com/wireguard/wgctrl
 
-go 1.13
+go 1.23.1
 
 require (
-	github.com/google/go-cmp v0.5.5
+	github.com/google/go-cmp v0.6.0
 	github.com/mdlayher/genetlink v1.0.0
 	github.com/mdlayher/netlink v1.4.0
 	github.com/mikioh/ipaddr v0.0.0-20190404000644-d465c8ab6721
-	golang.org/x/crypto v0.0.0-20210421170649-83a5a9bb288b
-	golang.org/x/sys v0.0.0-20210426230700-d19ff857e887
-	golang.zx2c4.com/wireguard v0.0.0-20210427022245-097af6e1351b
+	golang.org/x/crypto v0.37.0
+	golang.org/x/sys v0.32.0
+	golang.zx2c4.com/wireguard v0.0.0-20250521234502-f333402bd9cb
+)
+
+require (
+	github.com/google/btree v1.1.2 // indirect
+	github.com/josharian/native v0.0.0-20200817173448-b6b71def0850 // indirect
+	golang.org/x/net v0.39.0 // indirect
+	golang.org/x/time v0.7.0 // indirect
+	golang.zx2c4.com/wintun v0.0.0-20230126152724-0fa3db229ce2 // indirect
+	gvisor.dev/gvisor v0.0.0-20250503011706-39ed1f5ac29c // indirect
 )
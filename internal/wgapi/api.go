@@ -0,0 +1,353 @@
+package wgapi
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Paths served by the API. A device is addressed by appending its name to
+// PathDevices, separated by a slash.
+const (
+	PathDevices = "/v1/devices"
+	PathSchema  = "/v1/openapi.json"
+)
+
+// Devices is the response to a request for all devices.
+type Devices struct {
+	Devices []Device `json:"devices"`
+}
+
+// A Device is the JSON form of a wgtypes.Device. Keys other than public keys
+// are omitted and KeysRedacted is set unless the caller may view them.
+type Device struct {
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	PrivateKey   string `json:"private_key,omitempty"`
+	PublicKey    string `json:"public_key"`
+	ListenPort   int    `json:"listen_port"`
+	FirewallMark int    `json:"firewall_mark"`
+	Peers        []Peer `json:"peers"`
+	KeysRedacted bool   `json:"keys_redacted,omitempty"`
+}
+
+// A Peer is the JSON form of a wgtypes.Peer.
+type Peer struct {
+	PublicKey                   string     `json:"public_key"`
+	HasPresharedKey             bool       `json:"has_preshared_key"`
+	PresharedKey                string     `json:"preshared_key,omitempty"`
+	Endpoint                    string     `json:"endpoint,omitempty"`
+	PersistentKeepaliveInterval int        `json:"persistent_keepalive_interval"`
+	LastHandshakeTime           *time.Time `json:"last_handshake_time,omitempty"`
+	ReceiveBytes                int64      `json:"receive_bytes"`
+	TransmitBytes               int64      `json:"transmit_bytes"`
+	AllowedIPs                  []string   `json:"allowed_ips"`
+	ProtocolVersion             int        `json:"protocol_version"`
+}
+
+// A Config is the JSON form of a wgtypes.Config. Durations are in seconds.
+type Config struct {
+	PrivateKey   *string      `json:"private_key,omitempty"`
+	ListenPort   *int         `json:"listen_port,omitempty"`
+	FirewallMark *int         `json:"firewall_mark,omitempty"`
+	ReplacePeers bool         `json:"replace_peers,omitempty"`
+	Peers        []PeerConfig `json:"peers,omitempty"`
+}
+
+// A PeerConfig is the JSON form of a wgtypes.PeerConfig.
+type PeerConfig struct {
+	PublicKey                   string   `json:"public_key"`
+	Remove                      bool     `json:"remove,omitempty"`
+	UpdateOnly                  bool     `json:"update_only,omitempty"`
+	PresharedKey                *string  `json:"preshared_key,omitempty"`
+	Endpoint                    *string  `json:"endpoint,omitempty"`
+	PersistentKeepaliveInterval *int     `json:"persistent_keepalive_interval,omitempty"`
+	ReplaceAllowedIPs           bool     `json:"replace_allowed_ips,omitempty"`
+	AllowedIPs                  []string `json:"allowed_ips,omitempty"`
+}
+
+// Error codes returned in an Error.
+const (
+	CodeBadRequest   = "bad_request"
+	CodeUnauthorized = "unauthorized"
+	CodeForbidden    = "forbidden"
+	CodeNotExist     = "not_exist"
+	CodeReadOnly     = "read_only"
+	CodeNotSupported = "not_supported"
+	CodeInternal     = "internal"
+)
+
+// An Error is the response to a failed request.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// deviceTypes are the JSON forms of each wgtypes.DeviceType.
+var deviceTypes = map[wgtypes.DeviceType]string{
+	wgtypes.Unknown:       "unknown",
+	wgtypes.LinuxKernel:   "linux_kernel",
+	wgtypes.OpenBSDKernel: "openbsd_kernel",
+	wgtypes.Userspace:     "userspace",
+}
+
+// EncodeDevice produces the JSON form of d. Private and preshared keys are
+// only included if keys is set and d.KeysRedacted is not.
+func EncodeDevice(d *wgtypes.Device, keys bool) Device {
+	out := Device{
+		Name:         d.Name,
+		Type:         deviceTypes[d.Type],
+		PublicKey:    d.PublicKey.String(),
+		ListenPort:   d.ListenPort,
+		FirewallMark: d.FirewallMark,
+		Peers:        make([]Peer, 0, len(d.Peers)),
+		KeysRedacted: !keys || d.KeysRedacted,
+	}
+	if out.Type == "" {
+		out.Type = deviceTypes[wgtypes.Unknown]
+	}
+	if !out.KeysRedacted && d.PrivateKey != (wgtypes.Key{}) {
+		out.PrivateKey = d.PrivateKey.String()
+	}
+
+	for _, p := range d.Peers {
+		op := Peer{
+			PublicKey:                   p.PublicKey.String(),
+			HasPresharedKey:             p.PresharedKey != (wgtypes.Key{}) || p.PresharedKeyRedacted,
+			PersistentKeepaliveInterval: int(p.PersistentKeepaliveInterval / time.Second),
+			ReceiveBytes:                p.ReceiveBytes,
+			TransmitBytes:               p.TransmitBytes,
+			AllowedIPs:                  make([]string, 0, len(p.AllowedIPs)),
+			ProtocolVersion:             p.ProtocolVersion,
+		}
+		if !out.KeysRedacted && op.HasPresharedKey {
+			op.PresharedKey = p.PresharedKey.String()
+		}
+		if p.Endpoint != nil {
+			op.Endpoint = p.Endpoint.String()
+		}
+		if !p.LastHandshakeTime.IsZero() {
+			t := p.LastHandshakeTime.UTC()
+			op.LastHandshakeTime = &t
+		}
+		for _, ipn := range p.AllowedIPs {
+			op.AllowedIPs = append(op.AllowedIPs, ipn.String())
+		}
+
+		out.Peers = append(out.Peers, op)
+	}
+
+	return out
+}
+
+// Decode parses a wgtypes.Device from its JSON form. Keys which were omitted
+// are zero, and the device and its peers are marked as redacted if the keys
+// were withheld.
+func (d Device) Decode() (*wgtypes.Device, error) {
+	out := &wgtypes.Device{
+		Name:         d.Name,
+		ListenPort:   d.ListenPort,
+		FirewallMark: d.FirewallMark,
+		Peers:        make([]wgtypes.Peer, 0, len(d.Peers)),
+		KeysRedacted: d.KeysRedacted,
+	}
+
+	for dt, s := range deviceTypes {
+		if s == d.Type {
+			out.Type = dt
+		}
+	}
+
+	var err error
+	if out.PublicKey, err = parseKey(d.PublicKey); err != nil {
+		return nil, err
+	}
+	if out.PrivateKey, err = parseKey(d.PrivateKey); err != nil {
+		return nil, err
+	}
+
+	for _, p := range d.Peers {
+		op := wgtypes.Peer{
+			PersistentKeepaliveInterval: time.Duration(p.PersistentKeepaliveInterval) * time.Second,
+			ReceiveBytes:                p.ReceiveBytes,
+			TransmitBytes:               p.TransmitBytes,
+			ProtocolVersion:             p.ProtocolVersion,
+		}
+
+		if op.PublicKey, err = parseKey(p.PublicKey); err != nil {
+			return nil, err
+		}
+		if op.PresharedKey, err = parseKey(p.PresharedKey); err != nil {
+			return nil, err
+		}
+		if p.HasPresharedKey && op.PresharedKey == (wgtypes.Key{}) {
+			if !d.KeysRedacted {
+				return nil, fmt.Errorf("peer %s has a preshared key which was not provided", p.PublicKey)
+			}
+
+			op.PresharedKeyRedacted = true
+		}
+		if op.Endpoint, err = parseEndpoint(p.Endpoint); err != nil {
+			return nil, err
+		}
+		if p.LastHandshakeTime != nil {
+			op.LastHandshakeTime = *p.LastHandshakeTime
+		}
+		if op.AllowedIPs, err = parseAllowedIPs(p.AllowedIPs); err != nil {
+			return nil, err
+		}
+
+		out.Peers = append(out.Peers, op)
+	}
+
+	return out, nil
+}
+
+// EncodeConfig produces the JSON form of cfg.
+func EncodeConfig(cfg wgtypes.Config) Config {
+	out := Config{
+		ListenPort:   cfg.ListenPort,
+		FirewallMark: cfg.FirewallMark,
+		ReplacePeers: cfg.ReplacePeers,
+	}
+	if cfg.PrivateKey != nil {
+		k := cfg.PrivateKey.String()
+		out.PrivateKey = &k
+	}
+
+	for _, pc := range cfg.Peers {
+		opc := PeerConfig{
+			PublicKey:         pc.PublicKey.String(),
+			Remove:            pc.Remove,
+			UpdateOnly:        pc.UpdateOnly,
+			ReplaceAllowedIPs: pc.ReplaceAllowedIPs,
+		}
+		if pc.PresharedKey != nil {
+			k := pc.PresharedKey.String()
+			opc.PresharedKey = &k
+		}
+		if pc.Endpoint != nil {
+			ep := pc.Endpoint.String()
+			opc.Endpoint = &ep
+		}
+		if pc.PersistentKeepaliveInterval != nil {
+			secs := int(*pc.PersistentKeepaliveInterval / time.Second)
+			opc.PersistentKeepaliveInterval = &secs
+		}
+		for _, ipn := range pc.AllowedIPs {
+			opc.AllowedIPs = append(opc.AllowedIPs, ipn.String())
+		}
+
+		out.Peers = append(out.Peers, opc)
+	}
+
+	return out
+}
+
+// Decode parses a wgtypes.Config from its JSON form.
+func (cfg Config) Decode() (wgtypes.Config, error) {
+	out := wgtypes.Config{
+		ListenPort:   cfg.ListenPort,
+		FirewallMark: cfg.FirewallMark,
+		ReplacePeers: cfg.ReplacePeers,
+	}
+
+	if cfg.PrivateKey != nil {
+		k, err := wgtypes.ParseKey(*cfg.PrivateKey)
+		if err != nil {
+			return wgtypes.Config{}, err
+		}
+		out.PrivateKey = &k
+	}
+
+	for _, pc := range cfg.Peers {
+		k, err := wgtypes.ParseKey(pc.PublicKey)
+		if err != nil {
+			return wgtypes.Config{}, err
+		}
+
+		opc := wgtypes.PeerConfig{
+			PublicKey:         k,
+			Remove:            pc.Remove,
+			UpdateOnly:        pc.UpdateOnly,
+			ReplaceAllowedIPs: pc.ReplaceAllowedIPs,
+		}
+
+		if pc.PresharedKey != nil {
+			psk, err := wgtypes.ParseKey(*pc.PresharedKey)
+			if err != nil {
+				return wgtypes.Config{}, err
+			}
+			opc.PresharedKey = &psk
+		}
+		if pc.Endpoint != nil {
+			if opc.Endpoint, err = parseEndpoint(*pc.Endpoint); err != nil {
+				return wgtypes.Config{}, err
+			}
+			if opc.Endpoint == nil {
+				return wgtypes.Config{}, fmt.Errorf("empty endpoint for peer %s", k)
+			}
+		}
+		if pc.PersistentKeepaliveInterval != nil {
+			ka := time.Duration(*pc.PersistentKeepaliveInterval) * time.Second
+			opc.PersistentKeepaliveInterval = &ka
+		}
+		if opc.AllowedIPs, err = parseAllowedIPs(pc.AllowedIPs); err != nil {
+			return wgtypes.Config{}, err
+		}
+
+		out.Peers = append(out.Peers, opc)
+	}
+
+	return out, nil
+}
+
+// parseKey parses a key, or returns the zero key if s is empty.
+func parseKey(s string) (wgtypes.Key, error) {
+	if s == "" {
+		return wgtypes.Key{}, nil
+	}
+
+	return wgtypes.ParseKey(s)
+}
+
+// parseEndpoint parses a numeric UDP endpoint, or returns nil if s is empty.
+func parseEndpoint(s string) (*net.UDPAddr, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	host, _, err := net.SplitHostPort(s)
+	if err != nil {
+		return nil, err
+	}
+
+	// Endpoints are never resolved, so that a request cannot cause the
+	// server to perform DNS lookups.
+	if i := strings.IndexByte(host, '%'); i != -1 {
+		host = host[:i]
+	}
+	if net.ParseIP(host) == nil {
+		return nil, fmt.Errorf("endpoint %q is not a numeric IP address and port", s)
+	}
+
+	return net.ResolveUDPAddr("udp", s)
+}
+
+// parseAllowedIPs parses a list of CIDR prefixes.
+func parseAllowedIPs(ss []string) ([]net.IPNet, error) {
+	var out []net.IPNet
+	for _, s := range ss {
+		_, ipn, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, *ipn)
+	}
+
+	return out, nil
+}
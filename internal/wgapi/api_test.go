@@ -0,0 +1,126 @@
+package wgapi_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgapi"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestDeviceRoundTrip(t *testing.T) {
+	priv := wgtest.MustPrivateKey()
+	d := &wgtypes.Device{
+		Name:         "wg0",
+		Type:         wgtypes.Userspace,
+		PrivateKey:   priv,
+		PublicKey:    priv.PublicKey(),
+		ListenPort:   51820,
+		FirewallMark: 1,
+		Peers: []wgtypes.Peer{{
+			PublicKey:                   wgtest.MustPublicKey(),
+			PresharedKey:                wgtest.MustPresharedKey(),
+			Endpoint:                    wgtest.MustUDPAddr("[fe80::1%eth0]:51820"),
+			PersistentKeepaliveInterval: 25 * time.Second,
+			LastHandshakeTime:           time.Unix(1, 0).UTC(),
+			ReceiveBytes:                1,
+			TransmitBytes:               2,
+			AllowedIPs:                  []net.IPNet{wgtest.MustCIDR("10.0.0.0/24")},
+			ProtocolVersion:             1,
+		}},
+	}
+
+	got, err := wgapi.EncodeDevice(d, true).Decode()
+	if err != nil {
+		t.Fatalf("failed to decode device: %v", err)
+	}
+
+	if diff := cmp.Diff(d, got); diff != "" {
+		t.Fatalf("unexpected device (-want +got):\n%s", diff)
+	}
+
+	// Without keys, only the public keys remain, and the device is marked as
+	// redacted.
+	redacted := wgapi.EncodeDevice(d, false)
+	if redacted.PrivateKey != "" || redacted.Peers[0].PresharedKey != "" || !redacted.KeysRedacted {
+		t.Fatalf("keys were not redacted: %+v", redacted)
+	}
+
+	got, err = redacted.Decode()
+	if err != nil {
+		t.Fatalf("failed to decode redacted device: %v", err)
+	}
+
+	want := *d
+	want.PrivateKey = wgtypes.Key{}
+	want.KeysRedacted = true
+	want.Peers = []wgtypes.Peer{d.Peers[0]}
+	want.Peers[0].PresharedKey = wgtypes.Key{}
+	want.Peers[0].PresharedKeyRedacted = true
+
+	if diff := cmp.Diff(&want, got); diff != "" {
+		t.Fatalf("unexpected redacted device (-want +got):\n%s", diff)
+	}
+
+	// A redacted device remains redacted when it is encoded again.
+	if again := wgapi.EncodeDevice(got, true); !again.KeysRedacted || !again.Peers[0].HasPresharedKey {
+		t.Fatalf("redaction was lost: %+v", again)
+	}
+
+	// A preshared key may only be missing if keys are redacted.
+	redacted.KeysRedacted = false
+	if _, err := redacted.Decode(); err == nil {
+		t.Fatal("expected an error for a missing preshared key")
+	}
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	var (
+		priv = wgtest.MustPrivateKey()
+		psk  = wgtest.MustPresharedKey()
+		port = 51820
+		ka   = 25 * time.Second
+	)
+
+	cfg := wgtypes.Config{
+		PrivateKey:   &priv,
+		ListenPort:   &port,
+		ReplacePeers: true,
+		Peers: []wgtypes.PeerConfig{
+			{
+				PublicKey:                   wgtest.MustPublicKey(),
+				PresharedKey:                &psk,
+				Endpoint:                    wgtest.MustUDPAddr("192.0.2.1:51820"),
+				PersistentKeepaliveInterval: &ka,
+				ReplaceAllowedIPs:           true,
+				AllowedIPs:                  []net.IPNet{wgtest.MustCIDR("10.0.0.1/32")},
+			},
+			{
+				PublicKey: wgtest.MustPublicKey(),
+				Remove:    true,
+			},
+		},
+	}
+
+	got, err := wgapi.EncodeConfig(cfg).Decode()
+	if err != nil {
+		t.Fatalf("failed to decode config: %v", err)
+	}
+
+	if diff := cmp.Diff(cfg, got); diff != "" {
+		t.Fatalf("unexpected config (-want +got):\n%s", diff)
+	}
+
+	// Endpoints must be numeric, so that decoding never performs DNS lookups.
+	ep := "example.com:51820"
+	bad := wgapi.Config{Peers: []wgapi.PeerConfig{{
+		PublicKey: wgtest.MustPublicKey().String(),
+		Endpoint:  &ep,
+	}}}
+	if _, err := bad.Decode(); err == nil {
+		t.Fatal("expected an error for a hostname endpoint")
+	}
+}
@@ -0,0 +1,6 @@
+// Package wgapi defines the JSON HTTP API served by package wgserver, and the
+// conversions between its messages and package wgtypes.
+//
+// This package is internal-only and not meant for end users to consume.
+// Please use package wgserver instead.
+package wgapi
@@ -0,0 +1,115 @@
+package wgembed
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+var _ conn.Bind = &loopbackBind{}
+
+// A loopbackBind is a conn.Bind which sends and receives WireGuard traffic
+// using a UDP socket bound to the IPv4 loopback address, so that its device
+// is unreachable from other hosts.
+type loopbackBind struct {
+	mu sync.Mutex
+	c  *net.UDPConn
+}
+
+// Open implements conn.Bind.
+func (b *loopbackBind) Open(port uint16) ([]conn.ReceiveFunc, uint16, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.c != nil {
+		return nil, 0, conn.ErrBindAlreadyOpen
+	}
+
+	c, err := net.ListenUDP("udp4", &net.UDPAddr{
+		IP:   net.IPv4(127, 0, 0, 1),
+		Port: int(port),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	b.c = c
+	return []conn.ReceiveFunc{receiveFunc(c)}, uint16(c.LocalAddr().(*net.UDPAddr).Port), nil
+}
+
+// receiveFunc returns a conn.ReceiveFunc which reads one packet at a time
+// from c. Once c is closed, the function returns an error which wraps
+// net.ErrClosed, as the device expects.
+func receiveFunc(c *net.UDPConn) conn.ReceiveFunc {
+	return func(packets [][]byte, sizes []int, eps []conn.Endpoint) (int, error) {
+		n, ap, err := c.ReadFromUDPAddrPort(packets[0])
+		if err != nil {
+			return 0, err
+		}
+
+		sizes[0] = n
+		eps[0] = &conn.StdNetEndpoint{AddrPort: netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port())}
+		return 1, nil
+	}
+}
+
+// Close implements conn.Bind.
+func (b *loopbackBind) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.c == nil {
+		return nil
+	}
+
+	err := b.c.Close()
+	b.c = nil
+	return err
+}
+
+// SetMark implements conn.Bind; marks have no effect on loopback traffic.
+func (b *loopbackBind) SetMark(_ uint32) error { return nil }
+
+// errEndpoint is returned when a loopbackBind is asked to send to an endpoint
+// which it did not create.
+var errEndpoint = errors.New("wgembed: unsupported endpoint type")
+
+// Send implements conn.Bind.
+func (b *loopbackBind) Send(bufs [][]byte, ep conn.Endpoint) error {
+	b.mu.Lock()
+	c := b.c
+	b.mu.Unlock()
+
+	if c == nil {
+		return net.ErrClosed
+	}
+
+	se, ok := ep.(*conn.StdNetEndpoint)
+	if !ok {
+		return errEndpoint
+	}
+
+	for _, buf := range bufs {
+		if _, err := c.WriteToUDPAddrPort(buf, se.AddrPort); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ParseEndpoint implements conn.Bind.
+func (b *loopbackBind) ParseEndpoint(s string) (conn.Endpoint, error) {
+	ap, err := netip.ParseAddrPort(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &conn.StdNetEndpoint{AddrPort: netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port())}, nil
+}
+
+// BatchSize implements conn.Bind.
+func (b *loopbackBind) BatchSize() int { return 1 }
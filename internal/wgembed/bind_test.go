@@ -0,0 +1,65 @@
+package wgembed
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+func TestLoopbackBind(t *testing.T) {
+	var b loopbackBind
+	fns, port, err := b.Open(0)
+	if err != nil {
+		t.Fatalf("failed to open bind: %v", err)
+	}
+	defer b.Close()
+
+	if _, _, err := b.Open(0); !errors.Is(err, conn.ErrBindAlreadyOpen) {
+		t.Fatalf("expected already open error, but got: %v", err)
+	}
+
+	if ip := b.c.LocalAddr().(*net.UDPAddr).IP; !ip.IsLoopback() {
+		t.Fatalf("expected a loopback address, but got: %s", ip)
+	}
+
+	ep, err := b.ParseEndpoint("127.0.0.1:" + strconv.Itoa(int(port)))
+	if err != nil {
+		t.Fatalf("failed to parse endpoint: %v", err)
+	}
+
+	msg := []byte("hello")
+	if err := b.Send([][]byte{msg}, ep); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	var (
+		bufs  = [][]byte{make([]byte, 1500)}
+		sizes = make([]int, 1)
+		eps   = make([]conn.Endpoint, 1)
+	)
+
+	n, err := fns[0](bufs, sizes, eps)
+	if err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+
+	if diff := cmp.Diff(msg, bufs[0][:sizes[0]]); n != 1 || diff != "" {
+		t.Fatalf("unexpected packet (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(ep.DstToString(), eps[0].DstToString()); diff != "" {
+		t.Fatalf("unexpected endpoint (-want +got):\n%s", diff)
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatalf("failed to close bind: %v", err)
+	}
+
+	if _, err := fns[0](bufs, sizes, eps); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected closed error, but got: %v", err)
+	}
+}
@@ -0,0 +1,357 @@
+package wgembed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wguser"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+var _ wginternal.Client = &Client{}
+
+// defaultMTU is the MTU used by wireguard-go and wg-quick by default.
+const defaultMTU = 1420
+
+// A Client provides access to WireGuard devices within this process.
+type Client struct {
+	mu      sync.Mutex
+	devices map[string]*Device
+
+	// Embedded devices speak the userspace configuration protocol, so the
+	// userspace backend is reused over in-memory connections.
+	uc *wguser.Client
+}
+
+// New creates a new Client. If trace is not nil, it receives the raw exchanges
+// with each device. If observer is not nil, it is notified of each operation.
+func New(trace wginternal.Tracer, observer wginternal.Observer) (*Client, error) {
+	c := &Client{
+		devices: make(map[string]*Device),
+	}
+
+	uc, err := wguser.New(&wguser.Config{
+		Trace:    trace,
+		Observer: observer,
+		Find:     c.find,
+		Dial:     c.dial,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.uc = uc
+	return c, nil
+}
+
+// Close implements wginternal.Client by closing all devices.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	ds := make([]*Device, 0, len(c.devices))
+	for _, d := range c.devices {
+		ds = append(ds, d)
+	}
+	c.mu.Unlock()
+
+	for _, d := range ds {
+		_ = d.Close()
+	}
+
+	return c.uc.Close()
+}
+
+// Devices implements wginternal.Client.
+func (c *Client) Devices() ([]*wgtypes.Device, error) {
+	return c.uc.Devices()
+}
+
+// Device implements wginternal.Client.
+func (c *Client) Device(name string) (*wgtypes.Device, error) {
+	return c.uc.Device(name)
+}
+
+// ConfigureDevice implements wginternal.Client.
+func (c *Client) ConfigureDevice(name string, cfg wgtypes.Config) error {
+	return c.uc.ConfigureDevice(name, cfg)
+}
+
+// Capabilities implements wginternal.Client.
+func (c *Client) Capabilities(name string) (*wgtypes.Capabilities, error) {
+	caps, err := c.uc.Capabilities(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Embedded devices are created by this Client.
+	caps.Supported |= wgtypes.CapabilityCreate
+	return caps, nil
+}
+
+// A Config configures a Device.
+type Config struct {
+	// KernelTUN specifies that an operating system TUN interface is created
+	// for the Device, which typically requires elevated privileges. If false,
+	// a virtual TUN backed by a userspace network stack is used, and sockets
+	// are opened over the tunnel using Device methods.
+	KernelTUN bool
+
+	// Addresses are the IP addresses of the Device's virtual TUN. They are
+	// ignored when KernelTUN is set, as the operating system's interface is
+	// configured separately.
+	Addresses []net.IP
+
+	// MTU specifies the MTU of the TUN interface. If zero, a default is used.
+	MTU int
+
+	// Loopback specifies that the Device sends and receives WireGuard traffic
+	// using UDP on the IPv4 loopback address only, so that it can only reach
+	// and be reached by peers on the same host. If false, the Device listens
+	// on all interfaces.
+	Loopback bool
+
+	// Logf, if not nil, receives log messages from the device.
+	Logf func(format string, v ...interface{})
+}
+
+// A Device is a WireGuard device within this process.
+type Device struct {
+	c    *Client
+	name string
+	d    *device.Device
+
+	// net is nil if the Device uses a kernel TUN interface.
+	net *netstack.Net
+
+	closeOnce sync.Once
+}
+
+// Create creates a Device with the specified name.
+func (c *Client) Create(name string, cfg Config) (*Device, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("wgembed: invalid device name: %q", name)
+	}
+
+	mtu := cfg.MTU
+	if mtu == 0 {
+		mtu = defaultMTU
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.devices[name]; ok {
+		return nil, os.ErrExist
+	}
+
+	var (
+		td tun.Device
+		tn *netstack.Net
+	)
+
+	if cfg.KernelTUN {
+		var err error
+		td, err = tun.CreateTUN(name, mtu)
+		if err != nil {
+			return nil, fmt.Errorf("wgembed: failed to create TUN interface %q: %v", name, err)
+		}
+	} else {
+		addrs := make([]netip.Addr, 0, len(cfg.Addresses))
+		for _, ip := range cfg.Addresses {
+			addr, ok := netip.AddrFromSlice(ip)
+			if !ok {
+				return nil, fmt.Errorf("wgembed: invalid address for device %q: %v", name, ip)
+			}
+
+			addrs = append(addrs, addr.Unmap())
+		}
+
+		var err error
+		td, tn, err = netstack.CreateNetTUN(addrs, nil, mtu)
+		if err != nil {
+			return nil, fmt.Errorf("wgembed: failed to create virtual TUN %q: %v", name, err)
+		}
+	}
+
+	logger := &device.Logger{
+		Verbosef: device.DiscardLogf,
+		Errorf:   device.DiscardLogf,
+	}
+	if cfg.Logf != nil {
+		prefix := fmt.Sprintf("wgembed: %s: ", name)
+		logger.Verbosef = func(format string, v ...interface{}) { cfg.Logf(prefix+format, v...) }
+		logger.Errorf = func(format string, v ...interface{}) { cfg.Logf(prefix+"error: "+format, v...) }
+	}
+
+	bind := conn.NewDefaultBind()
+	if cfg.Loopback {
+		bind = &loopbackBind{}
+	}
+
+	d := &Device{
+		c:    c,
+		name: name,
+		d:    device.NewDevice(td, bind, logger),
+		net:  tn,
+	}
+
+	// The device would come up asynchronously when its TUN reports that it is
+	// up, but bring it up now so that its listening port is bound before the
+	// caller configures or queries it.
+	if err := d.d.Up(); err != nil {
+		d.d.Close()
+		return nil, fmt.Errorf("wgembed: failed to bring up device %q: %v", name, err)
+	}
+
+	c.devices[name] = d
+	return d, nil
+}
+
+// Name returns the name of the Device.
+func (d *Device) Name() string { return d.name }
+
+// errKernelTUN is returned when socket operations are used with a kernel TUN.
+var errKernelTUN = errors.New("wgembed: device uses a kernel TUN interface")
+
+// DialContext connects to address over the Device's tunnels, using the
+// network stack of its virtual TUN. The network must be one of "tcp", "tcp4",
+// "tcp6", "udp", "udp4", or "udp6", and address must contain an IP address
+// rather than a host name.
+func (d *Device) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.net == nil {
+		return nil, errKernelTUN
+	}
+
+	return d.net.DialContext(ctx, network, address)
+}
+
+// Listen listens for TCP connections on address over the Device's tunnels.
+// The network must be one of "tcp", "tcp4", or "tcp6". If the host in address
+// is empty, Listen listens on all of the Device's addresses.
+func (d *Device) Listen(network, address string) (net.Listener, error) {
+	if d.net == nil {
+		return nil, errKernelTUN
+	}
+
+	ap, err := listenAddr(network, address, "tcp")
+	if err != nil {
+		return nil, err
+	}
+
+	return d.net.ListenTCPAddrPort(ap)
+}
+
+// ListenPacket listens for UDP datagrams on address over the Device's
+// tunnels. The network must be one of "udp", "udp4", or "udp6". If the host
+// in address is empty, ListenPacket listens on all of the Device's addresses.
+func (d *Device) ListenPacket(network, address string) (net.PacketConn, error) {
+	if d.net == nil {
+		return nil, errKernelTUN
+	}
+
+	ap, err := listenAddr(network, address, "udp")
+	if err != nil {
+		return nil, err
+	}
+
+	return d.net.ListenUDPAddrPort(ap)
+}
+
+// listenAddr parses a listening address for a network of the specified
+// protocol. The host in address must be empty or an IP address.
+func listenAddr(network, address, protocol string) (netip.AddrPort, error) {
+	var ip netip.Addr
+	switch network {
+	case protocol:
+	case protocol + "4":
+		ip = netip.IPv4Unspecified()
+	case protocol + "6":
+		ip = netip.IPv6Unspecified()
+	default:
+		return netip.AddrPort{}, fmt.Errorf("wgembed: unsupported network: %q", network)
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("wgembed: invalid port in address %q", address)
+	}
+
+	if host != "" {
+		ip, err = netip.ParseAddr(host)
+		if err != nil {
+			return netip.AddrPort{}, fmt.Errorf("wgembed: invalid IP address in address %q", address)
+		}
+
+		ip = ip.Unmap()
+	}
+
+	return netip.AddrPortFrom(ip, uint16(p)), nil
+}
+
+// Close stops the Device and removes it from its Client.
+func (d *Device) Close() error {
+	d.closeOnce.Do(func() {
+		d.c.mu.Lock()
+		delete(d.c.devices, d.name)
+		d.c.mu.Unlock()
+
+		// Closing the device also closes its TUN and bind.
+		d.d.Close()
+	})
+
+	return nil
+}
+
+// sockExt is appended to device names to form the paths used by the
+// userspace backend.
+const sockExt = ".sock"
+
+// find implements wguser.Config.Find.
+func (c *Client) find() ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	paths := make([]string, 0, len(c.devices))
+	for name := range c.devices {
+		paths = append(paths, name+sockExt)
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// dial implements wguser.Config.Dial by serving the configuration protocol
+// for a device over an in-memory connection.
+func (c *Client) dial(path string) (net.Conn, error) {
+	name := strings.TrimSuffix(filepath.Base(path), sockExt)
+
+	c.mu.Lock()
+	d, ok := c.devices[name]
+	c.mu.Unlock()
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	client, server := net.Pipe()
+	go d.d.IpcHandle(server)
+
+	return client, nil
+}
@@ -0,0 +1,185 @@
+package wgembed
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestClientTunnel(t *testing.T) {
+	c, err := New(nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer c.Close()
+
+	var (
+		ipA = net.IPv4(192, 0, 2, 1)
+		ipB = net.IPv4(192, 0, 2, 2)
+	)
+
+	a := testDevice(t, c, "wga", ipA)
+	b := testDevice(t, c, "wgb", ipB)
+
+	connect(t, c, a, b, ipB)
+	connect(t, c, b, a, ipA)
+
+	l, err := b.Listen("tcp", ":80")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	msg := []byte("hello")
+
+	errC := make(chan error, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			errC <- err
+			return
+		}
+		defer conn.Close()
+
+		_, err = io.Copy(conn, conn)
+		errC <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := a.DialContext(ctx, "tcp", "192.0.2.2:80")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	got := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	_ = conn.Close()
+
+	if diff := cmp.Diff(msg, got); diff != "" {
+		t.Fatalf("unexpected echo (-want +got):\n%s", diff)
+	}
+
+	if err := <-errC; err != nil {
+		t.Fatalf("failed to echo: %v", err)
+	}
+
+	d, err := c.Device("wga")
+	if err != nil {
+		t.Fatalf("failed to get device: %v", err)
+	}
+
+	if d.Peers[0].LastHandshakeTime.IsZero() || d.Peers[0].TransmitBytes == 0 {
+		t.Fatalf("expected a handshake and transmitted bytes: %+v", d.Peers[0])
+	}
+}
+
+func TestDeviceListenAddress(t *testing.T) {
+	c, err := New(nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer c.Close()
+
+	d := testDevice(t, c, "wga", net.IPv4(192, 0, 2, 1))
+
+	tests := []struct {
+		name, network, address string
+		ok                     bool
+	}{
+		{name: "TCP any", network: "tcp", address: ":80", ok: true},
+		{name: "TCP IPv4", network: "tcp4", address: "192.0.2.1:81", ok: true},
+		{name: "UDP any", network: "udp", address: ":80", ok: true},
+		{name: "UDP IPv4 any", network: "udp4", address: ":81", ok: true},
+		{name: "bad network", network: "unix", address: ":80"},
+		{name: "bad port", network: "tcp", address: ":http"},
+		{name: "host name", network: "tcp", address: "localhost:80"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				c   io.Closer
+				err error
+			)
+
+			if strings.HasPrefix(tt.network, "udp") {
+				c, err = d.ListenPacket(tt.network, tt.address)
+			} else {
+				c, err = d.Listen(tt.network, tt.address)
+			}
+
+			if tt.ok && err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			if err == nil {
+				_ = c.Close()
+			}
+		})
+	}
+}
+
+func testDevice(t *testing.T, c *Client, name string, ip net.IP) *Device {
+	t.Helper()
+
+	d, err := c.Create(name, Config{
+		Addresses: []net.IP{ip},
+		Loopback:  true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create device %q: %v", name, err)
+	}
+
+	priv := wgtest.MustPrivateKey()
+	port := 0
+	if err := c.ConfigureDevice(name, wgtypes.Config{PrivateKey: &priv, ListenPort: &port}); err != nil {
+		t.Fatalf("failed to configure device %q: %v", name, err)
+	}
+
+	return d
+}
+
+// connect adds peer as a peer of d, routing ip to peer over loopback.
+func connect(t *testing.T, c *Client, d, peer *Device, ip net.IP) {
+	t.Helper()
+
+	pd, err := c.Device(peer.Name())
+	if err != nil {
+		t.Fatalf("failed to get device: %v", err)
+	}
+
+	err = c.ConfigureDevice(d.Name(), wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey: pd.PublicKey,
+			Endpoint: &net.UDPAddr{
+				IP:   net.IPv4(127, 0, 0, 1),
+				Port: pd.ListenPort,
+			},
+			AllowedIPs: []net.IPNet{{
+				IP:   ip,
+				Mask: net.CIDRMask(32, 32),
+			}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("failed to configure device: %v", err)
+	}
+}
@@ -0,0 +1,12 @@
+// Package wgembed provides internal access to WireGuard devices which run
+// within the current process, using the wireguard-go device implementation.
+//
+// By default, each device uses a virtual TUN which needs no privileges,
+// backed by wireguard-go's userspace network stack (gVisor's netstack). TCP
+// and UDP sockets are opened over a device's tunnels using its DialContext,
+// Listen, and ListenPacket methods. Alternatively, a device may use a kernel
+// TUN interface.
+//
+// This package is internal-only and not meant for end users to consume.
+// Please use package wgctrl (an abstraction over this package) instead.
+package wgembed
@@ -1,21 +1,57 @@
 package wginternal
 
 import (
+	"context"
 	"errors"
 	"io"
 
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
-// ErrReadOnly indicates that the driver backing a device is read-only. It is
-// a sentinel value used in integration tests.
-// TODO(mdlayher): consider exposing in API.
+// ErrReadOnly indicates that the driver backing a device is read-only.
 var ErrReadOnly = errors.New("driver is read-only")
 
+// ErrNotSupported indicates that the driver backing a device does not support
+// an optional operation.
+var ErrNotSupported = errors.New("operation not supported by driver")
+
+// ErrUntrustedSocket indicates that a userspace device socket was refused
+// because it does not satisfy the configured socket policy.
+var ErrUntrustedSocket = errors.New("untrusted device socket")
+
 // A Client is a type which can control a WireGuard device.
 type Client interface {
 	io.Closer
 	Devices() ([]*wgtypes.Device, error)
 	Device(name string) (*wgtypes.Device, error)
 	ConfigureDevice(name string, cfg wgtypes.Config) error
+
+	// Capabilities reports the Capabilities of the named device, or returns
+	// an error compatible with os.IsNotExist if the Client does not control
+	// the device.
+	Capabilities(name string) (*wgtypes.Capabilities, error)
+}
+
+// A Watcher is a Client which can report WireGuard devices appearing and
+// disappearing. Watch returns ErrNotSupported if the Client is unable to watch
+// devices on this system.
+type Watcher interface {
+	Watch(ctx context.Context) (<-chan Event, error)
+}
+
+// An EventOp is the kind of change reported by an Event.
+type EventOp int
+
+// Possible EventOp values.
+const (
+	_ EventOp = iota
+	EventAppeared
+	EventDisappeared
+)
+
+// An Event reports that a WireGuard device has appeared or disappeared.
+type Event struct {
+	Name string
+	Type wgtypes.DeviceType
+	Op   EventOp
 }
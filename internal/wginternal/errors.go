@@ -0,0 +1,43 @@
+package wginternal
+
+import "os"
+
+// An OpError is an error returned by a backend operation on a device.
+type OpError struct {
+	Backend string
+	Op      string
+	Device  string
+	Err     error
+}
+
+// Error implements error.
+func (e *OpError) Error() string {
+	return e.Backend + ": " + e.Op + " " + e.Device + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error, for use with errors.Is and errors.As.
+func (e *OpError) Unwrap() error { return e.Err }
+
+// WrapError wraps err, returned by backend while performing op on device, in
+// an OpError. nil and errors which are already an OpError are returned
+// unchanged.
+//
+// Errors compatible with os.IsNotExist or os.IsPermission are also returned
+// unchanged: the os package does not unwrap arbitrary errors, so wrapping them
+// would break callers which check for those conditions, and a Client relies on
+// os.IsNotExist to try each backend in turn.
+func WrapError(backend, op, device string, err error) error {
+	if err == nil || os.IsNotExist(err) || os.IsPermission(err) {
+		return err
+	}
+	if _, ok := err.(*OpError); ok {
+		return err
+	}
+
+	return &OpError{
+		Backend: backend,
+		Op:      op,
+		Device:  device,
+		Err:     err,
+	}
+}
@@ -0,0 +1,74 @@
+package wginternal
+
+import (
+	"sync"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// FetchDevices retrieves a device for each of names by calling fetch from at
+// most n goroutines at once, and returns the devices in the same order as
+// names. If n is less than 2, devices are retrieved sequentially.
+//
+// If skip is not nil and reports true for an error returned by fetch, that
+// device is omitted. Otherwise, the error for the earliest of names is
+// returned, so that the result is the same regardless of n.
+func FetchDevices(names []string, n int, fetch func(name string) (*wgtypes.Device, error), skip func(err error) bool) ([]*wgtypes.Device, error) {
+	type result struct {
+		d   *wgtypes.Device
+		err error
+	}
+
+	results := make([]result, len(names))
+	if n > len(names) {
+		n = len(names)
+	}
+
+	if n < 2 {
+		for i, name := range names {
+			d, err := fetch(name)
+			results[i] = result{d: d, err: err}
+
+			// Stop early on an error which will be returned anyway.
+			if err != nil && (skip == nil || !skip(err)) {
+				results = results[:i+1]
+				break
+			}
+		}
+	} else {
+		idx := make(chan int)
+
+		var wg sync.WaitGroup
+		wg.Add(n)
+		for i := 0; i < n; i++ {
+			go func() {
+				defer wg.Done()
+				for j := range idx {
+					d, err := fetch(names[j])
+					results[j] = result{d: d, err: err}
+				}
+			}()
+		}
+
+		for j := range names {
+			idx <- j
+		}
+		close(idx)
+		wg.Wait()
+	}
+
+	ds := make([]*wgtypes.Device, 0, len(results))
+	for _, r := range results {
+		if r.err != nil {
+			if skip != nil && skip(r.err) {
+				continue
+			}
+
+			return nil, r.err
+		}
+
+		ds = append(ds, r.d)
+	}
+
+	return ds, nil
+}
@@ -0,0 +1,61 @@
+package wginternal
+
+import "time"
+
+// OpDial is the name of an Op which connects to a device, in addition to the
+// operation names used in an Exchange.
+const OpDial = "dial"
+
+// An Op describes a single operation performed by a backend.
+type Op struct {
+	Backend   string
+	Operation string
+	Device    string
+	Start     time.Time
+	Duration  time.Duration
+
+	// Messages is the number of request messages sent, and Batches is the
+	// number of configuration batches those messages carried.
+	Messages int
+	Batches  int
+
+	BytesSent     int
+	BytesReceived int
+
+	Err error
+}
+
+// An Observer is notified as each backend operation starts and ends. The same
+// Op is passed to both methods, with its results filled in before End is
+// called. An Observer must be safe for concurrent use.
+type Observer interface {
+	Start(op *Op)
+	End(op *Op)
+}
+
+// StartOp creates an Op and notifies o that it has started. o may be nil.
+func StartOp(o Observer, backend, operation, device string) *Op {
+	op := &Op{
+		Backend:   backend,
+		Operation: operation,
+		Device:    device,
+		Start:     time.Now(),
+	}
+
+	if o != nil {
+		o.Start(op)
+	}
+
+	return op
+}
+
+// Finish records the duration and result of op and notifies o that it has
+// ended. o may be nil.
+func (op *Op) Finish(o Observer, err error) {
+	op.Duration = time.Since(op.Start)
+	op.Err = err
+
+	if o != nil {
+		o.End(op)
+	}
+}
@@ -0,0 +1,42 @@
+//+build linux
+
+package wginternal
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// PeerCredentials uses SO_PEERCRED to fetch the user and group IDs of the
+// process on the other end of c, which must be a UNIX socket.
+func PeerCredentials(c net.Conn) (uid, gid int, err error) {
+	sc, ok := c.(syscall.Conn)
+	if !ok {
+		return 0, 0, fmt.Errorf("connection type %T does not expose a file descriptor", c)
+	}
+
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var (
+		ucred *unix.Ucred
+		cerr  error
+	)
+
+	err = rc.Control(func(fd uintptr) {
+		ucred, cerr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if cerr != nil {
+		return 0, 0, cerr
+	}
+
+	return int(ucred.Uid), int(ucred.Gid), nil
+}
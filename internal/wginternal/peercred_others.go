@@ -0,0 +1,11 @@
+//+build !linux
+
+package wginternal
+
+import "net"
+
+// PeerCredentials is not implemented on this system, so peer verification
+// always fails.
+func PeerCredentials(_ net.Conn) (uid, gid int, err error) {
+	return 0, 0, ErrNotSupported
+}
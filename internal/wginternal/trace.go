@@ -0,0 +1,101 @@
+package wginternal
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+// Operation names used in an Exchange.
+const (
+	OpGet = "get"
+	OpSet = "set"
+)
+
+// An Exchange is a raw request and response exchanged with a device by a
+// backend during a single operation. Private and preshared keys are redacted
+// by the backend before an Exchange is produced.
+type Exchange struct {
+	Backend   string
+	Operation string
+	Device    string
+	Request   [][]byte
+	Response  [][]byte
+	Error     string
+}
+
+// Err returns the error recorded in an Exchange, if any. Errors which were
+// compatible with os.IsNotExist when recorded remain so.
+func (ex Exchange) Err() error {
+	switch ex.Error {
+	case "":
+		return nil
+	case os.ErrNotExist.Error():
+		return os.ErrNotExist
+	default:
+		return errors.New(ex.Error)
+	}
+}
+
+// A Tracer receives an Exchange after each backend operation. A Tracer must be
+// safe for concurrent use.
+type Tracer func(ex Exchange)
+
+// A Replay replays the recorded Exchanges of a single backend in order.
+type Replay struct {
+	mu      sync.Mutex
+	devices []string
+	queues  map[replayKey][]Exchange
+}
+
+type replayKey struct{ op, device string }
+
+// NewReplay creates a Replay from the Exchanges in exs which were recorded by
+// backend.
+func NewReplay(backend string, exs []Exchange) *Replay {
+	r := &Replay{queues: make(map[replayKey][]Exchange)}
+
+	seen := make(map[string]bool)
+	for _, ex := range exs {
+		if ex.Backend != backend {
+			continue
+		}
+
+		if !seen[ex.Device] {
+			seen[ex.Device] = true
+			r.devices = append(r.devices, ex.Device)
+		}
+
+		k := replayKey{op: ex.Operation, device: ex.Device}
+		r.queues[k] = append(r.queues[k], ex)
+	}
+
+	return r
+}
+
+// Devices returns the names of all recorded devices, in the order in which
+// they first appeared.
+func (r *Replay) Devices() []string {
+	return r.devices
+}
+
+// Next returns the next recorded Exchange for operation op on device. Once all
+// Exchanges for op and device are consumed, the last one is returned again.
+// If nothing was recorded, an error compatible with os.IsNotExist is returned.
+func (r *Replay) Next(op, device string) (Exchange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := replayKey{op: op, device: device}
+	q := r.queues[k]
+	if len(q) == 0 {
+		return Exchange{}, os.ErrNotExist
+	}
+
+	ex := q[0]
+	if len(q) > 1 {
+		r.queues[k] = q[1:]
+	}
+
+	return ex, nil
+}
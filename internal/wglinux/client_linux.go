@@ -18,23 +18,58 @@ import (
 
 var _ wginternal.Client = &Client{}
 
-// A Client provides access to Linux WireGuard netlink information.
+// A Client provides access to Linux WireGuard netlink information. A Client
+// is safe for concurrent use.
 type Client struct {
-	c      *genetlink.Conn
+	pool   *connPool
 	family genetlink.Family
 
 	interfaces func() ([]string, error)
+
+	// trace, if not nil, receives the raw exchanges with each device.
+	trace wginternal.Tracer
+
+	// observer, if not nil, is notified of each operation.
+	observer wginternal.Observer
+}
+
+// A Config configures a Client.
+type Config struct {
+	// Trace, if not nil, receives the raw exchanges with each device.
+	Trace wginternal.Tracer
+
+	// Observer, if not nil, is notified of each operation.
+	Observer wginternal.Observer
+
+	// Concurrency specifies the maximum number of requests performed at once,
+	// each using its own netlink socket. If less than 2, requests are
+	// performed one at a time.
+	Concurrency int
 }
 
 // New creates a new Client and returns whether or not the generic netlink
-// interface is available.
-func New() (*Client, bool, error) {
+// interface is available. If cfg is nil, a default configuration is used.
+func New(cfg *Config) (*Client, bool, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
 	c, err := genetlink.Dial(nil)
 	if err != nil {
 		return nil, false, err
 	}
 
-	return initClient(c)
+	wgc, ok, err := initClient(c)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+
+	wgc.pool = newConnPool(c, cfg.Concurrency, func() (*genetlink.Conn, error) {
+		return genetlink.Dial(nil)
+	})
+	wgc.trace = cfg.Trace
+	wgc.observer = cfg.Observer
+	return wgc, true, nil
 }
 
 // initClient is the internal Client constructor used in some tests.
@@ -55,7 +90,7 @@ func initClient(c *genetlink.Conn) (*Client, bool, error) {
 	}
 
 	return &Client{
-		c:      c,
+		pool:   newConnPool(c, 1, nil),
 		family: f,
 
 		// By default, gather only WireGuard interfaces using rtnetlink.
@@ -65,7 +100,7 @@ func initClient(c *genetlink.Conn) (*Client, bool, error) {
 
 // Close implements wginternal.Client.
 func (c *Client) Close() error {
-	return c.c.Close()
+	return c.pool.close()
 }
 
 // Devices implements wginternal.Client.
@@ -80,17 +115,7 @@ func (c *Client) Devices() ([]*wgtypes.Device, error) {
 		return nil, err
 	}
 
-	ds := make([]*wgtypes.Device, 0, len(ifis))
-	for _, ifi := range ifis {
-		d, err := c.Device(ifi)
-		if err != nil {
-			return nil, err
-		}
-
-		ds = append(ds, d)
-	}
-
-	return ds, nil
+	return wginternal.FetchDevices(ifis, c.pool.size(), c.Device, nil)
 }
 
 // Device implements wginternal.Client.
@@ -112,35 +137,100 @@ func (c *Client) Device(name string) (*wgtypes.Device, error) {
 		return nil, err
 	}
 
+	var o *wginternal.Op
+	if c.observer != nil {
+		o = wginternal.StartOp(c.observer, backend, wginternal.OpGet, name)
+	}
+
 	msgs, err := c.execute(wgh.CmdGetDevice, flags, b)
+	if o != nil {
+		c.finishOp(o, [][]byte{b}, msgs, err)
+	}
+	if c.trace != nil {
+		c.traceExchange(wginternal.OpGet, name, wgh.CmdGetDevice, [][]byte{b}, msgs, err)
+	}
 	if err != nil {
-		return nil, err
+		return nil, wginternal.WrapError(backend, wginternal.OpGet, name, err)
+	}
+
+	d, err := parseDevice(msgs)
+	if err != nil {
+		return nil, wginternal.WrapError(backend, wginternal.OpGet, name, err)
 	}
 
-	return parseDevice(msgs)
+	return d, nil
 }
 
 // ConfigureDevice implements wginternal.Client.
-func (c *Client) ConfigureDevice(name string, cfg wgtypes.Config) error {
+func (c *Client) ConfigureDevice(name string, cfg wgtypes.Config) (err error) {
 	// Large configurations are split into batches for use with netlink.
-	for _, b := range buildBatches(cfg) {
+	batches := buildBatches(cfg)
+
+	// Wrap any error once it has been traced and observed.
+	defer func() {
+		err = wginternal.WrapError(backend, wginternal.OpSet, name, err)
+	}()
+
+	// Gather the requests and responses of each batch for tracing and
+	// observation.
+	var reqs [][]byte
+	var res []genetlink.Message
+	if c.trace != nil {
+		defer func() {
+			c.traceExchange(wginternal.OpSet, name, wgh.CmdSetDevice, reqs, res, err)
+		}()
+	}
+	if c.observer != nil {
+		o := wginternal.StartOp(c.observer, backend, wginternal.OpSet, name)
+		o.Batches = len(batches)
+		defer func() { c.finishOp(o, reqs, res, err) }()
+	}
+
+	for _, b := range batches {
 		attrs, err := configAttrs(name, b)
 		if err != nil {
 			return err
 		}
+		reqs = append(reqs, attrs)
 
 		// Request acknowledgement of our request from netlink, even though the
 		// output messages are unused.  The netlink package checks and trims the
 		// status code value.
 		flags := netlink.Request | netlink.Acknowledge
-		if _, err := c.execute(wgh.CmdSetDevice, flags, attrs); err != nil {
+		msgs, err := c.execute(wgh.CmdSetDevice, flags, attrs)
+		if err != nil {
 			return err
 		}
+		res = append(res, msgs...)
 	}
 
 	return nil
 }
 
+// Capabilities implements wginternal.Client.
+func (c *Client) Capabilities(name string) (*wgtypes.Capabilities, error) {
+	// Devices are found using rtnetlink, so capabilities can be reported
+	// without the privileges needed to query a device.
+	ifis, err := c.interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ifi := range ifis {
+		if ifi != name {
+			continue
+		}
+
+		return &wgtypes.Capabilities{
+			Backend:   backend,
+			Type:      wgtypes.LinuxKernel,
+			Supported: wgtypes.CapabilityConfigure,
+		}, nil
+	}
+
+	return nil, os.ErrNotExist
+}
+
 // execute executes a single WireGuard netlink request with the specified command,
 // header flags, and attribute arguments.
 func (c *Client) execute(command uint8, flags netlink.HeaderFlags, attrb []byte) ([]genetlink.Message, error) {
@@ -152,7 +242,13 @@ func (c *Client) execute(command uint8, flags netlink.HeaderFlags, attrb []byte)
 		Data: attrb,
 	}
 
-	msgs, err := c.c.Execute(msg, c.family.ID, flags)
+	conn, err := c.pool.get()
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := conn.Execute(msg, c.family.ID, flags)
+	c.pool.put(conn)
 	if err == nil {
 		return msgs, nil
 	}
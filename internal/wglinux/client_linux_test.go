@@ -3,6 +3,7 @@
 package wglinux
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -18,6 +19,7 @@ import (
 	"github.com/mdlayher/netlink/nlenc"
 	"github.com/mdlayher/netlink/nltest"
 	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
 	"golang.zx2c4.com/wireguard/wgctrl/internal/wglinux/internal/wgh"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
@@ -131,7 +133,7 @@ func TestLinuxClientIsPermission(t *testing.T) {
 		t.Skip("skipping, test must be run without elevated privileges")
 	}
 
-	c, ok, err := New()
+	c, ok, err := New(nil)
 	if err != nil {
 		t.Fatalf("failed to create Client: %v", err)
 	}
@@ -147,6 +149,51 @@ func TestLinuxClientIsPermission(t *testing.T) {
 	}
 }
 
+func TestLinuxClientOpError(t *testing.T) {
+	c := testClient(t, func(_ genetlink.Message, _ netlink.Message) ([]genetlink.Message, error) {
+		// Attributes which are too short to be parsed.
+		return []genetlink.Message{{Data: []byte{0xff}}}, nil
+	})
+	defer c.Close()
+
+	_, err := c.Device(okName)
+
+	var oerr *wginternal.OpError
+	if !errors.As(err, &oerr) {
+		t.Fatalf("expected OpError, but got: %v", err)
+	}
+
+	if oerr.Backend != backend || oerr.Op != wginternal.OpGet || oerr.Device != okName {
+		t.Fatalf("unexpected OpError: %+v", oerr)
+	}
+}
+
+func TestLinuxClientCapabilities(t *testing.T) {
+	c := testClient(t, func(_ genetlink.Message, _ netlink.Message) ([]genetlink.Message, error) {
+		panic("devices should not be queried for capabilities")
+	})
+	defer c.Close()
+
+	caps, err := c.Capabilities(okName)
+	if err != nil {
+		t.Fatalf("failed to get capabilities: %v", err)
+	}
+
+	want := &wgtypes.Capabilities{
+		Backend:   backend,
+		Type:      wgtypes.LinuxKernel,
+		Supported: wgtypes.CapabilityConfigure,
+	}
+
+	if diff := cmp.Diff(want, caps); diff != "" {
+		t.Fatalf("unexpected capabilities (-want +got):\n%s", diff)
+	}
+
+	if _, err := c.Capabilities("wgnotexist0"); !os.IsNotExist(err) {
+		t.Fatalf("expected is not exist, but got: %v", err)
+	}
+}
+
 func Test_initClientNotExist(t *testing.T) {
 	conn := genltest.Dial(func(_ genetlink.Message, _ netlink.Message) ([]genetlink.Message, error) {
 		// Simulate genetlink family not found.
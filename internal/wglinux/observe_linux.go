@@ -0,0 +1,29 @@
+//+build linux
+
+package wglinux
+
+import (
+	"github.com/mdlayher/genetlink"
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+)
+
+// finishOp reports an operation which sent the request attributes in reqs
+// and received res to the Client's observer.
+func (c *Client) finishOp(o *wginternal.Op, reqs [][]byte, res []genetlink.Message, err error) {
+	o.Messages = len(reqs)
+	for _, b := range reqs {
+		o.BytesSent += msgLen(b)
+	}
+	for _, m := range res {
+		o.BytesReceived += msgLen(m.Data)
+	}
+
+	o.Finish(c.observer, err)
+}
+
+// msgLen returns the length of a netlink message carrying a generic netlink
+// message with the attributes in b.
+func msgLen(b []byte) int {
+	return unix.NLMSG_HDRLEN + unix.GENL_HDRLEN + len(b)
+}
@@ -0,0 +1,63 @@
+//+build linux
+
+package wglinux
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestLinuxClientObserver(t *testing.T) {
+	c := testClient(t, func(_ genetlink.Message, _ netlink.Message) ([]genetlink.Message, error) {
+		return []genetlink.Message{{}}, nil
+	})
+	defer c.Close()
+
+	var o testObserver
+	c.observer = &o
+
+	// Enough allowed IPs to require several batches.
+	err := c.ConfigureDevice(okName, wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey:  wgtest.MustPublicKey(),
+			AllowedIPs: generateIPs(ipBatchChunk * 2),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("failed to configure device: %v", err)
+	}
+
+	if diff := cmp.Diff(1, len(o.ops)); diff != "" {
+		t.Fatalf("unexpected number of operations (-want +got):\n%s", diff)
+	}
+
+	op := o.ops[0]
+	if diff := cmp.Diff(op.Batches, op.Messages); diff != "" {
+		t.Fatalf("unexpected number of messages (-want +got):\n%s", diff)
+	}
+	if op.Backend != backend || op.Operation != wginternal.OpSet || op.Device != okName ||
+		op.Batches < 2 || op.BytesSent == 0 || op.Err != nil {
+		t.Fatalf("unexpected operation: %+v", op)
+	}
+}
+
+// A testObserver records ended operations.
+type testObserver struct {
+	mu  sync.Mutex
+	ops []*wginternal.Op
+}
+
+func (o *testObserver) Start(_ *wginternal.Op) {}
+
+func (o *testObserver) End(op *wginternal.Op) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.ops = append(o.ops, op)
+}
@@ -0,0 +1,102 @@
+//+build linux
+
+package wglinux
+
+import (
+	"sync"
+
+	"github.com/mdlayher/genetlink"
+)
+
+// A connPool is a pool of generic netlink connections, which allows a Client
+// to perform several requests at once. Each connection performs only one
+// request at a time.
+type connPool struct {
+	dial func() (*genetlink.Conn, error)
+
+	// idle holds connections which are not in use, and slots holds a token
+	// for each connection which may still be dialed.
+	idle  chan *genetlink.Conn
+	slots chan struct{}
+
+	mu  sync.Mutex
+	all []*genetlink.Conn
+}
+
+// newConnPool creates a connPool of up to size connections, starting with c.
+// If dial is nil, c is the only connection.
+func newConnPool(c *genetlink.Conn, size int, dial func() (*genetlink.Conn, error)) *connPool {
+	if size < 1 || dial == nil {
+		size = 1
+	}
+
+	p := &connPool{
+		dial:  dial,
+		idle:  make(chan *genetlink.Conn, size),
+		slots: make(chan struct{}, size-1),
+		all:   []*genetlink.Conn{c},
+	}
+
+	p.idle <- c
+	for i := 1; i < size; i++ {
+		p.slots <- struct{}{}
+	}
+
+	return p
+}
+
+// get returns an idle connection, dialing a new one if none are idle and the
+// pool is not yet full, or waiting for one to become idle otherwise. The
+// connection must be returned using put.
+func (p *connPool) get() (*genetlink.Conn, error) {
+	// Prefer an idle connection to dialing another.
+	select {
+	case c := <-p.idle:
+		return c, nil
+	default:
+	}
+
+	select {
+	case c := <-p.idle:
+		return c, nil
+	case <-p.slots:
+	}
+
+	c, err := p.dial()
+	if err != nil {
+		// Allow a later call to try again.
+		p.slots <- struct{}{}
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.all = append(p.all, c)
+
+	return c, nil
+}
+
+// put returns a connection obtained by get to the pool.
+func (p *connPool) put(c *genetlink.Conn) {
+	p.idle <- c
+}
+
+// size returns the maximum number of connections in the pool.
+func (p *connPool) size() int {
+	return cap(p.idle)
+}
+
+// close closes all connections in the pool.
+func (p *connPool) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var err error
+	for _, c := range p.all {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,140 @@
+//+build linux
+
+package wglinux
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/genetlink/genltest"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"github.com/mdlayher/netlink/nltest"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wglinux/internal/wgh"
+)
+
+func TestLinuxClientDevicesConcurrent(t *testing.T) {
+	const size = 4
+
+	names := testNames(32)
+	c, dials := testPoolClient(t, size, names, time.Millisecond)
+	defer c.Close()
+
+	// Call Devices from several goroutines at once, each of which must
+	// observe devices in the same order as the interfaces.
+	var wg sync.WaitGroup
+	wg.Add(size)
+	for i := 0; i < size; i++ {
+		go func() {
+			defer wg.Done()
+
+			ds, err := c.Devices()
+			if err != nil {
+				t.Errorf("failed to get devices: %v", err)
+				return
+			}
+
+			got := make([]string, 0, len(ds))
+			for _, d := range ds {
+				got = append(got, d.Name)
+			}
+
+			if diff := cmp.Diff(names, got); diff != "" {
+				t.Errorf("unexpected device order (-want +got):\n%s", diff)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The initial connection is not dialed, and the pool must never exceed
+	// its size.
+	if n := atomic.LoadInt32(dials); n < 1 || n > size-1 {
+		t.Fatalf("unexpected number of dialed connections: %d", n)
+	}
+}
+
+func BenchmarkLinuxClientDevices(b *testing.B) {
+	// Simulate the latency of a kernel request for a device with many peers.
+	const latency = 200 * time.Microsecond
+
+	names := testNames(64)
+	for _, size := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("concurrency %d", size), func(b *testing.B) {
+			c, _ := testPoolClient(b, size, names, latency)
+			defer c.Close()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := c.Devices(); err != nil {
+					b.Fatalf("failed to get devices: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// testPoolClient creates a Client with a pool of up to size connections which
+// report a device for each of names after latency. dials reports the number
+// of connections dialed after the first.
+func testPoolClient(tb testing.TB, size int, names []string, latency time.Duration) (c *Client, dials *int32) {
+	tb.Helper()
+
+	family := genetlink.Family{
+		ID:      familyID,
+		Version: wgh.GenlVersion,
+		Name:    wgh.GenlName,
+	}
+
+	fn := genltest.ServeFamily(family, func(greq genetlink.Message, _ netlink.Message) ([]genetlink.Message, error) {
+		attrs, err := netlink.UnmarshalAttributes(greq.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		time.Sleep(latency)
+
+		// Echo the requested device name.
+		return []genetlink.Message{{
+			Data: nltest.MustMarshalAttributes([]netlink.Attribute{{
+				Type: wgh.DeviceAIfname,
+				Data: nlenc.Bytes(nlenc.String(attrs[0].Data)),
+			}}),
+		}}, nil
+	})
+
+	c, ok, err := initClient(genltest.Dial(fn))
+	if err != nil {
+		tb.Fatalf("failed to open Client: %v", err)
+	}
+	if !ok {
+		tb.Fatal("the generic netlink API was not available from genltest")
+	}
+
+	dials = new(int32)
+	c.pool = newConnPool(c.pool.all[0], size, func() (*genetlink.Conn, error) {
+		atomic.AddInt32(dials, 1)
+		return genltest.Dial(fn), nil
+	})
+	c.interfaces = func() ([]string, error) {
+		return names, nil
+	}
+
+	return c, dials
+}
+
+// testNames produces n device names.
+func testNames(n int) []string {
+	names := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		names = append(names, fmt.Sprintf("wg%d", i))
+	}
+
+	return names
+}
@@ -0,0 +1,89 @@
+//+build linux
+
+package wglinux
+
+import (
+	"os"
+
+	"github.com/mdlayher/genetlink"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+var _ wginternal.Client = &ReplayClient{}
+
+// A ReplayClient replays recorded generic netlink exchanges through the same
+// parser used for live Linux kernel devices.
+type ReplayClient struct {
+	r *wginternal.Replay
+}
+
+// NewReplay creates a ReplayClient from the exchanges in exs which were
+// recorded by this backend.
+func NewReplay(exs []wginternal.Exchange) *ReplayClient {
+	return &ReplayClient{r: wginternal.NewReplay(backend, exs)}
+}
+
+// Close implements wginternal.Client.
+func (c *ReplayClient) Close() error { return nil }
+
+// Devices implements wginternal.Client.
+func (c *ReplayClient) Devices() ([]*wgtypes.Device, error) {
+	var ds []*wgtypes.Device
+	for _, name := range c.r.Devices() {
+		d, err := c.Device(name)
+		if err != nil {
+			return nil, err
+		}
+
+		ds = append(ds, d)
+	}
+
+	return ds, nil
+}
+
+// Device implements wginternal.Client.
+func (c *ReplayClient) Device(name string) (*wgtypes.Device, error) {
+	ex, err := c.r.Next(wginternal.OpGet, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := ex.Err(); err != nil {
+		return nil, err
+	}
+
+	msgs := make([]genetlink.Message, 0, len(ex.Response))
+	for _, b := range ex.Response {
+		var m genetlink.Message
+		if err := m.UnmarshalBinary(b); err != nil {
+			return nil, err
+		}
+
+		msgs = append(msgs, m)
+	}
+
+	return parseDevice(msgs)
+}
+
+// ConfigureDevice implements wginternal.Client. The recorded result of the
+// configuration is returned, regardless of cfg.
+func (c *ReplayClient) ConfigureDevice(name string, _ wgtypes.Config) error {
+	ex, err := c.r.Next(wginternal.OpSet, name)
+	if err != nil {
+		return err
+	}
+
+	return ex.Err()
+}
+
+// Capabilities implements wginternal.Client. Replayed devices are reported
+// without any optional capabilities.
+func (c *ReplayClient) Capabilities(name string) (*wgtypes.Capabilities, error) {
+	for _, d := range c.r.Devices() {
+		if d == name {
+			return &wgtypes.Capabilities{Backend: backend, Type: wgtypes.LinuxKernel}, nil
+		}
+	}
+
+	return nil, os.ErrNotExist
+}
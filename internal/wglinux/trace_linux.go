@@ -0,0 +1,110 @@
+//+build linux
+
+package wglinux
+
+import (
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wglinux/internal/wgh"
+)
+
+// backend is the name of this backend in a wginternal.Exchange.
+const backend = "wglinux"
+
+// traceExchange passes the generic netlink messages exchanged with device to
+// the Client's tracer. Request attributes in reqs are wrapped in generic
+// netlink messages using command.
+func (c *Client) traceExchange(op, device string, command uint8, reqs [][]byte, res []genetlink.Message, err error) {
+	ex := wginternal.Exchange{
+		Backend:   backend,
+		Operation: op,
+		Device:    device,
+	}
+
+	for _, b := range reqs {
+		ex.Request = append(ex.Request, marshalRedacted(genetlink.Message{
+			Header: genetlink.Header{
+				Command: command,
+				Version: wgh.GenlVersion,
+			},
+			Data: b,
+		}))
+	}
+
+	for _, m := range res {
+		ex.Response = append(ex.Response, marshalRedacted(m))
+	}
+
+	if err != nil {
+		ex.Error = err.Error()
+	}
+
+	c.trace(ex)
+}
+
+// marshalRedacted marshals m to its binary form with all private and
+// preshared keys zeroed.
+func marshalRedacted(m genetlink.Message) []byte {
+	m.Data = redactKeys(m.Data)
+
+	// Marshaling a generic netlink message cannot fail.
+	b, _ := m.MarshalBinary()
+	return b
+}
+
+// redactKeys returns a copy of the WireGuard device attributes in b with all
+// private and preshared keys zeroed.
+func redactKeys(b []byte) []byte {
+	out := make([]byte, len(b))
+	copy(out, b)
+
+	walkAttrs(out, func(typ uint16, data []byte) {
+		switch typ {
+		case wgh.DeviceAPrivateKey:
+			zero(data)
+		case wgh.DeviceAPeers:
+			// Netlink array of peers, each with nested attributes.
+			walkAttrs(data, func(_ uint16, peer []byte) {
+				walkAttrs(peer, func(typ uint16, data []byte) {
+					if typ == wgh.PeerAPresharedKey {
+						zero(data)
+					}
+				})
+			})
+		}
+	})
+
+	return out
+}
+
+// walkAttrs calls fn with the type and data of each netlink attribute in b.
+// The data passed to fn aliases b.
+func walkAttrs(b []byte, fn func(typ uint16, data []byte)) {
+	const typeMask = ^uint16(unix.NLA_F_NESTED | unix.NLA_F_NET_BYTEORDER)
+
+	for len(b) >= unix.NLA_HDRLEN {
+		l := int(nlenc.Uint16(b[0:2]))
+		if l < unix.NLA_HDRLEN || l > len(b) {
+			// Malformed attribute; leave the rest alone.
+			return
+		}
+
+		fn(nlenc.Uint16(b[2:4])&typeMask, b[unix.NLA_HDRLEN:l])
+
+		// Attributes are padded to a 4 byte boundary.
+		next := (l + unix.NLA_ALIGNTO - 1) & ^(unix.NLA_ALIGNTO - 1)
+		if next > len(b) {
+			return
+		}
+
+		b = b[next:]
+	}
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,89 @@
+//+build linux
+
+package wglinux
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"github.com/mdlayher/netlink/nltest"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wglinux/internal/wgh"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestLinuxClientTraceReplay(t *testing.T) {
+	var (
+		priv    = wgtest.MustPrivateKey()
+		pub     = priv.PublicKey()
+		peerKey = wgtest.MustPublicKey()
+		psk     = wgtest.MustPresharedKey()
+	)
+
+	c := testClient(t, func(_ genetlink.Message, _ netlink.Message) ([]genetlink.Message, error) {
+		return []genetlink.Message{{
+			Data: nltest.MustMarshalAttributes([]netlink.Attribute{
+				{
+					Type: wgh.DeviceAIfname,
+					Data: nlenc.Bytes(okName),
+				},
+				{
+					Type: wgh.DeviceAPrivateKey,
+					Data: priv[:],
+				},
+				{
+					Type: wgh.DeviceAPublicKey,
+					Data: pub[:],
+				},
+				{
+					Type: netlink.Nested | wgh.DeviceAPeers,
+					Data: nltest.MustMarshalAttributes([]netlink.Attribute{{
+						Type: netlink.Nested,
+						Data: nltest.MustMarshalAttributes([]netlink.Attribute{
+							{
+								Type: wgh.PeerAPublicKey,
+								Data: peerKey[:],
+							},
+							{
+								Type: wgh.PeerAPresharedKey,
+								Data: psk[:],
+							},
+						}),
+					}}),
+				},
+			}),
+		}}, nil
+	})
+	defer c.Close()
+
+	var exs []wginternal.Exchange
+	c.trace = func(ex wginternal.Exchange) {
+		exs = append(exs, ex)
+	}
+
+	want, err := c.Device(okName)
+	if err != nil {
+		t.Fatalf("failed to get device: %v", err)
+	}
+
+	if diff := cmp.Diff(1, len(exs)); diff != "" {
+		t.Fatalf("unexpected number of exchanges (-want +got):\n%s", diff)
+	}
+
+	got, err := NewReplay(exs).Device(okName)
+	if err != nil {
+		t.Fatalf("failed to replay device: %v", err)
+	}
+
+	// Secret keys are redacted, but everything else must round-trip.
+	want.PrivateKey = wgtypes.Key{}
+	want.Peers[0].PresharedKey = wgtypes.Key{}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected replayed device (-want +got):\n%s", diff)
+	}
+}
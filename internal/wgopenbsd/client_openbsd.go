@@ -23,6 +23,9 @@ var (
 	ifGroupWG = [16]byte{0: 'w', 1: 'g'}
 )
 
+// backend identifies this package in errors.
+const backend = "wgopenbsd"
+
 var _ wginternal.Client = &Client{}
 
 // A Client provides access to OpenBSD WireGuard ioctl information.
@@ -133,7 +136,7 @@ func (c *Client) Device(name string) (*wgtypes.Device, error) {
 			case unix.ENXIO, unix.ENOTTY:
 				return nil, os.ErrNotExist
 			default:
-				return nil, err
+				return nil, wginternal.WrapError(backend, wginternal.OpGet, name, err)
 			}
 		}
 
@@ -231,7 +234,22 @@ func (c *Client) ConfigureDevice(name string, cfg wgtypes.Config) error {
 		return err
 	}
 
-	return wginternal.ErrReadOnly
+	return wginternal.WrapError(backend, wginternal.OpSet, name, wginternal.ErrReadOnly)
+}
+
+// Capabilities implements wginternal.Client. Devices are currently read-only,
+// but the kernel reports their statistics to unprivileged callers, omitting
+// the keys.
+func (c *Client) Capabilities(name string) (*wgtypes.Capabilities, error) {
+	if _, err := c.Device(name); err != nil {
+		return nil, err
+	}
+
+	return &wgtypes.Capabilities{
+		Backend:   backend,
+		Type:      wgtypes.OpenBSDKernel,
+		Supported: wgtypes.CapabilityStatsOnly,
+	}, nil
 }
 
 // deviceName converts an interface name string to the format required to pass
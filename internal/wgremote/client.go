@@ -0,0 +1,303 @@
+package wgremote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgapi"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// backend identifies this package in errors and operations.
+const backend = "wgremote"
+
+// Separator separates the name of a remote host from the name of one of its
+// devices, as in "host/wg0". Interface names cannot contain a slash, so remote
+// devices never collide with local devices.
+const Separator = "/"
+
+// unixPrefix marks a URL as the path of a UNIX socket.
+const unixPrefix = "unix:"
+
+// maxResponseSize bounds the size of a response from a remote host.
+const maxResponseSize = 64 << 20
+
+var _ wginternal.Client = &Client{}
+
+// Config configures a Client.
+type Config struct {
+	// Name is the name of the remote host, which prefixes the names of its
+	// devices.
+	Name string
+
+	// URL is the base URL of the API, such as "https://host:8080", or the
+	// path of a UNIX socket prefixed by "unix:".
+	URL string
+
+	// Token, if not empty, is sent as a bearer token with each request.
+	Token string
+
+	// HTTPClient, if not nil, performs requests. If nil, a client with a
+	// 30 second timeout is used.
+	HTTPClient *http.Client
+
+	// Observer, if not nil, is notified of each request.
+	Observer wginternal.Observer
+}
+
+// A Client provides access to the WireGuard devices of a remote host.
+type Client struct {
+	name     string
+	base     string
+	token    string
+	hc       *http.Client
+	observer wginternal.Observer
+}
+
+// New creates a Client for the remote host specified by cfg.
+func New(cfg *Config) (*Client, error) {
+	if cfg.Name == "" || strings.Contains(cfg.Name, Separator) {
+		return nil, fmt.Errorf("wgremote: invalid remote name: %q", cfg.Name)
+	}
+
+	c := &Client{
+		name:     cfg.Name,
+		base:     strings.TrimSuffix(cfg.URL, "/"),
+		token:    cfg.Token,
+		hc:       cfg.HTTPClient,
+		observer: cfg.Observer,
+	}
+
+	if strings.HasPrefix(cfg.URL, unixPrefix) {
+		if c.hc != nil {
+			return nil, errors.New("wgremote: an HTTP client cannot be used with a UNIX socket")
+		}
+
+		path := strings.TrimPrefix(cfg.URL, unixPrefix)
+		c.base = "http://wgctrl"
+		c.hc = &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", path)
+				},
+			},
+		}
+
+		return c, nil
+	}
+
+	u, err := url.Parse(c.base)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("wgremote: invalid URL: %q", cfg.URL)
+	}
+
+	if c.hc == nil {
+		c.hc = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return c, nil
+}
+
+// Close implements wginternal.Client.
+func (c *Client) Close() error {
+	c.hc.CloseIdleConnections()
+	return nil
+}
+
+// Devices implements wginternal.Client.
+func (c *Client) Devices() ([]*wgtypes.Device, error) {
+	var ds wgapi.Devices
+	if err := c.do(wginternal.OpGet, "", http.MethodGet, wgapi.PathDevices, nil, &ds); err != nil {
+		return nil, wginternal.WrapError(backend, wginternal.OpGet, "", err)
+	}
+
+	out := make([]*wgtypes.Device, 0, len(ds.Devices))
+	for _, ad := range ds.Devices {
+		d, err := c.decode(ad)
+		if err != nil {
+			return nil, wginternal.WrapError(backend, wginternal.OpGet, c.qualify(ad.Name), err)
+		}
+
+		out = append(out, d)
+	}
+
+	return out, nil
+}
+
+// Device implements wginternal.Client.
+func (c *Client) Device(name string) (*wgtypes.Device, error) {
+	remote, ok := c.remoteName(name)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	var ad wgapi.Device
+	if err := c.do(wginternal.OpGet, name, http.MethodGet, devicePath(remote), nil, &ad); err != nil {
+		return nil, wginternal.WrapError(backend, wginternal.OpGet, name, err)
+	}
+
+	d, err := c.decode(ad)
+	if err != nil {
+		return nil, wginternal.WrapError(backend, wginternal.OpGet, name, err)
+	}
+
+	return d, nil
+}
+
+// ConfigureDevice implements wginternal.Client.
+func (c *Client) ConfigureDevice(name string, cfg wgtypes.Config) error {
+	remote, ok := c.remoteName(name)
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	err := c.do(wginternal.OpSet, name, http.MethodPatch, devicePath(remote), wgapi.EncodeConfig(cfg), nil)
+	return wginternal.WrapError(backend, wginternal.OpSet, name, err)
+}
+
+// Capabilities implements wginternal.Client.
+func (c *Client) Capabilities(name string) (*wgtypes.Capabilities, error) {
+	d, err := c.Device(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Whether the caller may configure the device is only known once it
+	// tries, so configuration is assumed to be supported. The server withholds
+	// keys from callers which may not view them.
+	return &wgtypes.Capabilities{
+		Backend:   backend,
+		Type:      d.Type,
+		Supported: wgtypes.CapabilityConfigure | wgtypes.CapabilityStatsOnly,
+	}, nil
+}
+
+// remoteName returns the name of a device on the remote host, and whether
+// name refers to a device of this Client.
+func (c *Client) remoteName(name string) (string, bool) {
+	prefix := c.name + Separator
+	if !strings.HasPrefix(name, prefix) {
+		return "", false
+	}
+
+	remote := strings.TrimPrefix(name, prefix)
+	return remote, remote != ""
+}
+
+// qualify returns the local name of a device on the remote host.
+func (c *Client) qualify(remote string) string {
+	return c.name + Separator + remote
+}
+
+// decode parses a device from the remote host and qualifies its name.
+func (c *Client) decode(ad wgapi.Device) (*wgtypes.Device, error) {
+	d, err := ad.Decode()
+	if err != nil {
+		return nil, err
+	}
+
+	d.Name = c.qualify(d.Name)
+	return d, nil
+}
+
+// devicePath returns the API path of a device.
+func devicePath(name string) string {
+	return wgapi.PathDevices + "/" + url.PathEscape(name)
+}
+
+// do performs a request for operation op on device, sending in as the JSON
+// request body if not nil, and decoding the response into out if not nil.
+func (c *Client) do(op, device, method, path string, in, out interface{}) (err error) {
+	o := wginternal.StartOp(c.observer, backend, op, device)
+	defer func() {
+		o.Messages = 1
+		if op == wginternal.OpSet {
+			o.Batches = 1
+		}
+		o.Finish(c.observer, err)
+	}()
+
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+
+		o.BytesSent = len(b)
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	o.BytesReceived = len(b)
+
+	if res.StatusCode/100 != 2 {
+		return responseError(res.StatusCode, b)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return nil
+}
+
+// responseError converts an error response from the remote host into an
+// error compatible with those of other backends.
+func responseError(status int, b []byte) error {
+	var e wgapi.Error
+	if err := json.Unmarshal(b, &e); err != nil || e.Code == "" {
+		return fmt.Errorf("unexpected HTTP status: %d", status)
+	}
+
+	switch e.Code {
+	case wgapi.CodeNotExist:
+		return os.ErrNotExist
+	case wgapi.CodeReadOnly:
+		return wginternal.ErrReadOnly
+	case wgapi.CodeNotSupported:
+		return wginternal.ErrNotSupported
+	case wgapi.CodeUnauthorized, wgapi.CodeForbidden:
+		return &os.PathError{Op: e.Code, Path: "remote", Err: os.ErrPermission}
+	default:
+		return fmt.Errorf("remote error: %s: %s", e.Code, e.Message)
+	}
+}
@@ -0,0 +1,102 @@
+package wgremote
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		ok   bool
+	}{
+		{
+			name: "HTTP",
+			cfg:  Config{Name: "host", URL: "http://192.0.2.1:8080/"},
+			ok:   true,
+		},
+		{
+			name: "UNIX socket",
+			cfg:  Config{Name: "host", URL: "unix:/run/wgctrl.sock"},
+			ok:   true,
+		},
+		{
+			name: "no name",
+			cfg:  Config{URL: "http://192.0.2.1:8080"},
+		},
+		{
+			name: "slash in name",
+			cfg:  Config{Name: "a/b", URL: "http://192.0.2.1:8080"},
+		},
+		{
+			name: "bad scheme",
+			cfg:  Config{Name: "host", URL: "ftp://192.0.2.1"},
+		},
+		{
+			name: "UNIX socket with HTTP client",
+			cfg:  Config{Name: "host", URL: "unix:/run/wgctrl.sock", HTTPClient: &http.Client{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(&tt.cfg)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to create client: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		is   error
+	}{
+		{
+			name: "not exist",
+			body: `{"code":"not_exist","message":"x"}`,
+			is:   os.ErrNotExist,
+		},
+		{
+			name: "forbidden",
+			body: `{"code":"forbidden","message":"x"}`,
+			is:   os.ErrPermission,
+		},
+		{
+			name: "read-only",
+			body: `{"code":"read_only","message":"x"}`,
+			is:   wginternal.ErrReadOnly,
+		},
+		{
+			name: "not supported",
+			body: `{"code":"not_supported","message":"x"}`,
+			is:   wginternal.ErrNotSupported,
+		},
+		{
+			name: "not JSON",
+			body: `bad gateway`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := responseError(http.StatusBadGateway, []byte(tt.body))
+			if err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if tt.is != nil && !errors.Is(err, tt.is) {
+				t.Fatalf("expected %v, but got: %v", tt.is, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,6 @@
+// Package wgremote provides internal access to the WireGuard devices of a
+// remote host, using the JSON HTTP API served by package wgserver.
+//
+// This package is internal-only and not meant for end users to consume.
+// Please use package wgctrl (an abstraction over this package) instead.
+package wgremote
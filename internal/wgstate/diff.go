@@ -0,0 +1,154 @@
+package wgstate
+
+import (
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Diff computes a minimal Config which changes the configuration of device
+// from into that of device to, as compared by Equal. Only fields which differ
+// are set, and peers which are unchanged are omitted, so that applying the
+// Config does not disturb the sessions of unchanged peers.
+//
+// A peer's endpoint cannot be removed once set, so a peer in to without an
+// endpoint keeps the endpoint it has in from. Keys which are redacted in to
+// are left alone, as their values are unknown.
+func Diff(from, to *wgtypes.Device) wgtypes.Config {
+	var cfg wgtypes.Config
+
+	if !samePrivateKey(from, to) && privateKeyKnown(to) {
+		k := to.PrivateKey
+		cfg.PrivateKey = &k
+	}
+	if from.ListenPort != to.ListenPort {
+		port := to.ListenPort
+		cfg.ListenPort = &port
+	}
+	if from.FirewallMark != to.FirewallMark {
+		mark := to.FirewallMark
+		cfg.FirewallMark = &mark
+	}
+
+	want := make(map[wgtypes.Key]bool, len(to.Peers))
+	for _, p := range to.Peers {
+		want[p.PublicKey] = true
+	}
+
+	have := make(map[wgtypes.Key]*wgtypes.Peer, len(from.Peers))
+	for i, p := range from.Peers {
+		have[p.PublicKey] = &from.Peers[i]
+
+		if !want[p.PublicKey] {
+			cfg.Peers = append(cfg.Peers, wgtypes.PeerConfig{
+				PublicKey: p.PublicKey,
+				Remove:    true,
+			})
+		}
+	}
+
+	for _, p := range to.Peers {
+		old, ok := have[p.PublicKey]
+		if !ok {
+			cfg.Peers = append(cfg.Peers, newPeerConfig(p))
+			continue
+		}
+
+		if pc, changed := updatePeerConfig(old, &p); changed {
+			cfg.Peers = append(cfg.Peers, pc)
+		}
+	}
+
+	return cfg
+}
+
+// Restore computes a Config which replaces the entire configuration of a
+// device with that of d. Unlike Diff, it does not depend on the current state
+// of the device, but every peer's session is restarted when it is applied.
+//
+// A redacted private key is left alone, but redacted preshared keys are lost
+// as peers are replaced, so callers should not restore a device with redacted
+// keys.
+func Restore(d *wgtypes.Device) wgtypes.Config {
+	port := d.ListenPort
+	mark := d.FirewallMark
+
+	cfg := wgtypes.Config{
+		ListenPort:   &port,
+		FirewallMark: &mark,
+		ReplacePeers: true,
+		Peers:        make([]wgtypes.PeerConfig, 0, len(d.Peers)),
+	}
+
+	if privateKeyKnown(d) {
+		k := d.PrivateKey
+		cfg.PrivateKey = &k
+	}
+
+	for _, p := range d.Peers {
+		cfg.Peers = append(cfg.Peers, newPeerConfig(p))
+	}
+
+	return cfg
+}
+
+// Empty reports whether applying cfg would have no effect.
+func Empty(cfg wgtypes.Config) bool {
+	return cfg.PrivateKey == nil && cfg.ListenPort == nil && cfg.FirewallMark == nil &&
+		!cfg.ReplacePeers && len(cfg.Peers) == 0
+}
+
+// newPeerConfig produces a PeerConfig which adds p to a device. A redacted
+// preshared key is omitted.
+func newPeerConfig(p wgtypes.Peer) wgtypes.PeerConfig {
+	p = clonePeer(p)
+
+	pc := wgtypes.PeerConfig{
+		PublicKey:         p.PublicKey,
+		Endpoint:          p.Endpoint,
+		ReplaceAllowedIPs: true,
+		AllowedIPs:        SortedPrefixes(p.AllowedIPs),
+	}
+
+	if p.PresharedKey != (wgtypes.Key{}) {
+		psk := p.PresharedKey
+		pc.PresharedKey = &psk
+	}
+	if p.PersistentKeepaliveInterval != 0 {
+		ka := p.PersistentKeepaliveInterval
+		pc.PersistentKeepaliveInterval = &ka
+	}
+
+	return pc
+}
+
+// updatePeerConfig produces a PeerConfig which changes old into p, and
+// reports whether any changes are necessary.
+func updatePeerConfig(old, p *wgtypes.Peer) (wgtypes.PeerConfig, bool) {
+	pc := wgtypes.PeerConfig{
+		PublicKey:  p.PublicKey,
+		UpdateOnly: true,
+	}
+
+	var changed bool
+	if !samePresharedKey(old, p) && !p.PresharedKeyRedacted {
+		psk := p.PresharedKey
+		pc.PresharedKey = &psk
+		changed = true
+	}
+	if p.Endpoint != nil && !SameEndpoint(old.Endpoint, p.Endpoint) {
+		ep := clonePeer(wgtypes.Peer{Endpoint: p.Endpoint}).Endpoint
+		pc.Endpoint = ep
+		changed = true
+	}
+	if old.PersistentKeepaliveInterval != p.PersistentKeepaliveInterval {
+		ka := p.PersistentKeepaliveInterval
+		pc.PersistentKeepaliveInterval = &ka
+		changed = true
+	}
+	if !samePrefixes(old.AllowedIPs, p.AllowedIPs) {
+		pc.ReplaceAllowedIPs = true
+		pc.AllowedIPs = SortedPrefixes(p.AllowedIPs)
+		changed = true
+	}
+
+	return pc, changed
+}
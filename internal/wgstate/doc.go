@@ -0,0 +1,8 @@
+// Package wgstate contains shared logic for reasoning about the configuration
+// of WireGuard devices: predicting the effect of a wgtypes.Config, computing
+// the Config which changes one device state into another, comparing device
+// states, and storing device states on disk.
+//
+// This package is internal-only and not meant for end users to consume.
+// Please use package wgctrl (an abstraction over this package) instead.
+package wgstate
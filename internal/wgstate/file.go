@@ -0,0 +1,158 @@
+package wgstate
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// A DeviceFile is the on-disk JSON format of the configuration of a device.
+type DeviceFile struct {
+	Name         string     `json:"name"`
+	PrivateKey   string     `json:"private_key,omitempty"`
+	ListenPort   int        `json:"listen_port"`
+	FirewallMark int        `json:"fwmark,omitempty"`
+	Peers        []PeerFile `json:"peers"`
+}
+
+// A PeerFile is the on-disk JSON format of the configuration of a peer.
+type PeerFile struct {
+	PublicKey           string   `json:"public_key"`
+	PresharedKey        string   `json:"preshared_key,omitempty"`
+	Endpoint            string   `json:"endpoint,omitempty"`
+	PersistentKeepalive int      `json:"persistent_keepalive,omitempty"`
+	AllowedIPs          []string `json:"allowed_ips"`
+}
+
+// EncodeDevice produces the on-disk format of the configuration of d. Private
+// and preshared keys are only included if keys is set.
+func EncodeDevice(d *wgtypes.Device, keys bool) DeviceFile {
+	df := DeviceFile{
+		Name:         d.Name,
+		ListenPort:   d.ListenPort,
+		FirewallMark: d.FirewallMark,
+		Peers:        make([]PeerFile, 0, len(d.Peers)),
+	}
+	if keys && d.PrivateKey != (wgtypes.Key{}) {
+		df.PrivateKey = d.PrivateKey.String()
+	}
+
+	for _, p := range d.Peers {
+		pf := PeerFile{
+			PublicKey:           p.PublicKey.String(),
+			PersistentKeepalive: int(p.PersistentKeepaliveInterval / time.Second),
+			AllowedIPs:          make([]string, 0, len(p.AllowedIPs)),
+		}
+		if keys && p.PresharedKey != (wgtypes.Key{}) {
+			pf.PresharedKey = p.PresharedKey.String()
+		}
+		if p.Endpoint != nil {
+			pf.Endpoint = p.Endpoint.String()
+		}
+		for _, ipn := range SortedPrefixes(p.AllowedIPs) {
+			pf.AllowedIPs = append(pf.AllowedIPs, ipn.String())
+		}
+
+		df.Peers = append(df.Peers, pf)
+	}
+
+	return df
+}
+
+// Decode parses the configuration of a device from its on-disk format.
+func (df DeviceFile) Decode() (*wgtypes.Device, error) {
+	d := &wgtypes.Device{
+		Name:         df.Name,
+		ListenPort:   df.ListenPort,
+		FirewallMark: df.FirewallMark,
+		Peers:        make([]wgtypes.Peer, 0, len(df.Peers)),
+	}
+
+	if df.PrivateKey != "" {
+		k, err := wgtypes.ParseKey(df.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+
+		d.PrivateKey = k
+		d.PublicKey = k.PublicKey()
+	}
+
+	for _, pf := range df.Peers {
+		k, err := wgtypes.ParseKey(pf.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		p := wgtypes.Peer{
+			PublicKey:                   k,
+			PersistentKeepaliveInterval: time.Duration(pf.PersistentKeepalive) * time.Second,
+		}
+
+		if pf.PresharedKey != "" {
+			p.PresharedKey, err = wgtypes.ParseKey(pf.PresharedKey)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if pf.Endpoint != "" {
+			p.Endpoint, err = net.ResolveUDPAddr("udp", pf.Endpoint)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, s := range pf.AllowedIPs {
+			_, ipn, err := net.ParseCIDR(s)
+			if err != nil {
+				return nil, err
+			}
+
+			p.AllowedIPs = append(p.AllowedIPs, *ipn)
+		}
+
+		d.Peers = append(d.Peers, p)
+	}
+
+	return d, nil
+}
+
+// WriteFileAtomic writes b to a temporary file with permissions 0600 in the
+// same directory as path, and then renames it to path, so that a crash does
+// not leave a partially written file at path.
+func WriteFileAtomic(path string, b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	// Remove the temporary file unless it is renamed.
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if err := f.Chmod(0600); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,91 @@
+package wgstate
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"sort"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Fingerprint returns a SHA-256 hash of the configuration of d. Devices which
+// are Equal have the same fingerprint, provided that either both or neither
+// have redacted keys: a device with redacted keys is identified by its public
+// key and which of its peers have preshared keys. Peer endpoints are not
+// hashed, as they change when peers roam.
+func Fingerprint(d *wgtypes.Device) [sha256.Size]byte {
+	h := sha256.New()
+
+	if d.KeysRedacted {
+		writeString(h, "redacted")
+		h.Write(d.PublicKey[:])
+	} else {
+		h.Write(d.PrivateKey[:])
+	}
+	writeInt(h, int64(d.ListenPort))
+	writeInt(h, int64(d.FirewallMark))
+
+	// Peers are hashed in order of their public keys so that their order on
+	// the device does not matter.
+	peers := make([]*wgtypes.Peer, 0, len(d.Peers))
+	for i := range d.Peers {
+		peers = append(peers, &d.Peers[i])
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return string(peers[i].PublicKey[:]) < string(peers[j].PublicKey[:])
+	})
+
+	writeInt(h, int64(len(peers)))
+	for _, p := range peers {
+		h.Write(p.PublicKey[:])
+		if d.KeysRedacted {
+			writeBool(h, HasPresharedKey(p))
+		} else {
+			h.Write(p.PresharedKey[:])
+		}
+
+		writeInt(h, int64(p.PersistentKeepaliveInterval))
+
+		// Duplicate allowed IPs are ignored, as with Equal.
+		var prefixes []string
+		for _, ipn := range SortedPrefixes(p.AllowedIPs) {
+			s := ipn.String()
+			if n := len(prefixes); n == 0 || prefixes[n-1] != s {
+				prefixes = append(prefixes, s)
+			}
+		}
+
+		writeInt(h, int64(len(prefixes)))
+		for _, s := range prefixes {
+			writeString(h, s)
+		}
+	}
+
+	var out [sha256.Size]byte
+	copy(out[:], h.Sum(nil))
+	return out
+}
+
+// writeInt writes v to h in a fixed-size encoding.
+func writeInt(h hash.Hash, v int64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	h.Write(b[:])
+}
+
+// writeBool writes v to h as a single byte.
+func writeBool(h hash.Hash, v bool) {
+	var b byte
+	if v {
+		b = 1
+	}
+	h.Write([]byte{b})
+}
+
+// writeString writes s to h, prefixed by its length so that adjacent strings
+// cannot be confused.
+func writeString(h hash.Hash, s string) {
+	writeInt(h, int64(len(s)))
+	h.Write([]byte(s))
+}
@@ -0,0 +1,133 @@
+package wgstate
+
+import (
+	"net"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Simulate predicts the state of d after cfg is applied to it, following the
+// semantics of the WireGuard kernel and userspace implementations. d is not
+// modified.
+//
+// Statistics and handshakes are retained for existing peers, and zero for new
+// peers. New peers are added after existing peers.
+func Simulate(d *wgtypes.Device, cfg wgtypes.Config) *wgtypes.Device {
+	out := Clone(d)
+
+	if cfg.PrivateKey != nil {
+		out.PrivateKey = *cfg.PrivateKey
+		out.PublicKey = wgtypes.Key{}
+		if out.PrivateKey != (wgtypes.Key{}) {
+			out.PublicKey = out.PrivateKey.PublicKey()
+
+			// A peer cannot share the public key of its device, so any such
+			// peer is removed.
+			out.Peers = removePeer(out.Peers, out.PublicKey)
+		}
+	}
+	if cfg.ListenPort != nil {
+		out.ListenPort = *cfg.ListenPort
+	}
+	if cfg.FirewallMark != nil {
+		out.FirewallMark = *cfg.FirewallMark
+	}
+
+	if cfg.ReplacePeers {
+		out.Peers = nil
+	}
+
+	for _, pc := range cfg.Peers {
+		if pc.Remove {
+			out.Peers = removePeer(out.Peers, pc.PublicKey)
+			continue
+		}
+
+		// Peers with the device's own public key are ignored.
+		if out.PrivateKey != (wgtypes.Key{}) && pc.PublicKey == out.PublicKey {
+			continue
+		}
+
+		i := findPeer(out.Peers, pc.PublicKey)
+		if i == -1 {
+			if pc.UpdateOnly {
+				continue
+			}
+
+			out.Peers = append(out.Peers, wgtypes.Peer{
+				PublicKey:       pc.PublicKey,
+				ProtocolVersion: 1,
+			})
+			i = len(out.Peers) - 1
+		}
+
+		p := &out.Peers[i]
+		if pc.PresharedKey != nil {
+			p.PresharedKey = *pc.PresharedKey
+			p.PresharedKeyRedacted = false
+		}
+		if pc.Endpoint != nil {
+			ep := *pc.Endpoint
+			p.Endpoint = &ep
+		}
+		if pc.PersistentKeepaliveInterval != nil {
+			p.PersistentKeepaliveInterval = *pc.PersistentKeepaliveInterval
+		}
+		if pc.ReplaceAllowedIPs {
+			p.AllowedIPs = nil
+		}
+
+		for _, ipn := range pc.AllowedIPs {
+			addAllowedIP(out.Peers, i, Prefix(ipn))
+		}
+	}
+
+	return out
+}
+
+// findPeer returns the index of the peer with public key k, or -1 if none
+// exists.
+func findPeer(peers []wgtypes.Peer, k wgtypes.Key) int {
+	for i := range peers {
+		if peers[i].PublicKey == k {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// removePeer removes the peer with public key k, if it exists.
+func removePeer(peers []wgtypes.Peer, k wgtypes.Key) []wgtypes.Peer {
+	i := findPeer(peers, k)
+	if i == -1 {
+		return peers
+	}
+
+	return append(peers[:i:i], peers[i+1:]...)
+}
+
+// addAllowedIP adds ipn to the allowed IPs of peers[i]. As with the routing
+// table of a device, a prefix belongs to at most one peer, so it is removed
+// from any other peer.
+func addAllowedIP(peers []wgtypes.Peer, i int, ipn net.IPNet) {
+	s := ipn.String()
+	for j := range peers {
+		for k, pipn := range peers[j].AllowedIPs {
+			if pipn.String() != s {
+				continue
+			}
+
+			if j == i {
+				// Already present.
+				return
+			}
+
+			ips := peers[j].AllowedIPs
+			peers[j].AllowedIPs = append(ips[:k:k], ips[k+1:]...)
+			break
+		}
+	}
+
+	peers[i].AllowedIPs = append(peers[i].AllowedIPs, ipn)
+}
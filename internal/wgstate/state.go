@@ -0,0 +1,175 @@
+package wgstate
+
+import (
+	"net"
+	"sort"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Clone returns a deep copy of d.
+func Clone(d *wgtypes.Device) *wgtypes.Device {
+	out := *d
+	out.Peers = make([]wgtypes.Peer, 0, len(d.Peers))
+	for _, p := range d.Peers {
+		out.Peers = append(out.Peers, clonePeer(p))
+	}
+
+	return &out
+}
+
+// clonePeer returns a deep copy of p.
+func clonePeer(p wgtypes.Peer) wgtypes.Peer {
+	if p.Endpoint != nil {
+		ep := *p.Endpoint
+		ep.IP = append(net.IP(nil), ep.IP...)
+		p.Endpoint = &ep
+	}
+
+	ips := make([]net.IPNet, 0, len(p.AllowedIPs))
+	for _, ipn := range p.AllowedIPs {
+		ips = append(ips, Prefix(ipn))
+	}
+	p.AllowedIPs = ips
+
+	return p
+}
+
+// Prefix normalizes ipn in the same way as WireGuard implementations: host
+// bits are cleared, and IPv4 addresses use their 4-byte form.
+func Prefix(ipn net.IPNet) net.IPNet {
+	ones, bits := ipn.Mask.Size()
+
+	ip := ipn.IP
+	if ip4 := ip.To4(); ip4 != nil && bits != 8*net.IPv6len {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+
+	mask := net.CIDRMask(ones, bits)
+	return net.IPNet{IP: ip.Mask(mask), Mask: mask}
+}
+
+// prefixSet returns the normalized string form of each of ipns.
+func prefixSet(ipns []net.IPNet) map[string]bool {
+	set := make(map[string]bool, len(ipns))
+	for _, ipn := range ipns {
+		p := Prefix(ipn)
+		set[p.String()] = true
+	}
+
+	return set
+}
+
+// samePrefixes reports whether x and y contain the same prefixes, in any
+// order.
+func samePrefixes(x, y []net.IPNet) bool {
+	xs, ys := prefixSet(x), prefixSet(y)
+	if len(xs) != len(ys) {
+		return false
+	}
+
+	for p := range xs {
+		if !ys[p] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SortedPrefixes returns a normalized copy of ipns, sorted by their string
+// form.
+func SortedPrefixes(ipns []net.IPNet) []net.IPNet {
+	out := make([]net.IPNet, 0, len(ipns))
+	for _, ipn := range ipns {
+		out = append(out, Prefix(ipn))
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].String() < out[j].String()
+	})
+
+	return out
+}
+
+// SameEndpoint reports whether x and y are the same endpoint, or are both
+// nil.
+func SameEndpoint(x, y *net.UDPAddr) bool {
+	if x == nil || y == nil {
+		return x == y
+	}
+
+	return x.IP.Equal(y.IP) && x.Port == y.Port && x.Zone == y.Zone
+}
+
+// Equal reports whether x and y have the same configuration: the same private
+// key, listen port, firewall mark, and peers with the same preshared keys,
+// endpoints, persistent keepalive intervals, and allowed IPs. Names, types,
+// statistics, handshakes, and the order of peers and allowed IPs are ignored.
+//
+// Keys which were redacted by a backend cannot be compared, so private keys
+// are compared by their public keys if either device's keys are redacted, and
+// preshared keys by their presence if either peer's preshared key is redacted.
+func Equal(x, y *wgtypes.Device) bool {
+	if !samePrivateKey(x, y) || x.ListenPort != y.ListenPort || x.FirewallMark != y.FirewallMark {
+		return false
+	}
+
+	if len(x.Peers) != len(y.Peers) {
+		return false
+	}
+
+	peers := make(map[wgtypes.Key]*wgtypes.Peer, len(y.Peers))
+	for i := range y.Peers {
+		peers[y.Peers[i].PublicKey] = &y.Peers[i]
+	}
+
+	for _, xp := range x.Peers {
+		yp, ok := peers[xp.PublicKey]
+		if !ok || !peerEqual(&xp, yp) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// peerEqual reports whether x and y have the same configuration.
+func peerEqual(x, y *wgtypes.Peer) bool {
+	return samePresharedKey(x, y) &&
+		SameEndpoint(x.Endpoint, y.Endpoint) &&
+		x.PersistentKeepaliveInterval == y.PersistentKeepaliveInterval &&
+		samePrefixes(x.AllowedIPs, y.AllowedIPs)
+}
+
+// samePrivateKey reports whether x and y have the same private key, or the
+// same public key if either device's keys are redacted.
+func samePrivateKey(x, y *wgtypes.Device) bool {
+	if x.KeysRedacted || y.KeysRedacted {
+		return x.PublicKey == y.PublicKey
+	}
+
+	return x.PrivateKey == y.PrivateKey
+}
+
+// privateKeyKnown reports whether the PrivateKey of d is its actual private
+// key, rather than a zero key redacted by a backend.
+func privateKeyKnown(d *wgtypes.Device) bool {
+	return !d.KeysRedacted || d.PrivateKey != (wgtypes.Key{}) || d.PublicKey == (wgtypes.Key{})
+}
+
+// HasPresharedKey reports whether p has a preshared key, even if it is
+// redacted.
+func HasPresharedKey(p *wgtypes.Peer) bool {
+	return p.PresharedKeyRedacted || p.PresharedKey != (wgtypes.Key{})
+}
+
+// samePresharedKey reports whether x and y have the same preshared key, or
+// both have one if either is redacted.
+func samePresharedKey(x, y *wgtypes.Peer) bool {
+	if x.PresharedKeyRedacted || y.PresharedKeyRedacted {
+		return HasPresharedKey(x) == HasPresharedKey(y)
+	}
+
+	return x.PresharedKey == y.PresharedKey
+}
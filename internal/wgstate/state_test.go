@@ -0,0 +1,437 @@
+package wgstate_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgstate"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+var (
+	priv  = wgtest.MustPrivateKey()
+	keyA  = wgtest.MustPublicKey()
+	keyB  = wgtest.MustPublicKey()
+	keyC  = wgtest.MustPublicKey()
+	psk   = wgtest.MustPresharedKey()
+	epA   = wgtest.MustUDPAddr("192.0.2.1:51820")
+	epB   = wgtest.MustUDPAddr("[2001:db8::1]:51820")
+	netA  = wgtest.MustCIDR("10.0.0.1/32")
+	netB  = wgtest.MustCIDR("10.0.0.2/32")
+	netC  = wgtest.MustCIDR("2001:db8::/64")
+	port  = 51820
+	ka    = 25 * time.Second
+	zeroK = wgtypes.Key{}
+)
+
+// testDevice is the device each test starts from.
+func testDevice() *wgtypes.Device {
+	return &wgtypes.Device{
+		Name:       "wg0",
+		PrivateKey: priv,
+		PublicKey:  priv.PublicKey(),
+		ListenPort: port,
+		Peers: []wgtypes.Peer{
+			{
+				PublicKey:       keyA,
+				Endpoint:        epA,
+				AllowedIPs:      []net.IPNet{netA},
+				ReceiveBytes:    1,
+				ProtocolVersion: 1,
+			},
+			{
+				PublicKey:                   keyB,
+				PresharedKey:                psk,
+				PersistentKeepaliveInterval: ka,
+				AllowedIPs:                  []net.IPNet{netB, netC},
+				ProtocolVersion:             1,
+			},
+		},
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  wgtypes.Config
+		fn   func(d *wgtypes.Device)
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "device fields",
+			cfg: wgtypes.Config{
+				PrivateKey:   &zeroK,
+				ListenPort:   intPtr(0),
+				FirewallMark: intPtr(1),
+			},
+			fn: func(d *wgtypes.Device) {
+				d.PrivateKey = wgtypes.Key{}
+				d.PublicKey = wgtypes.Key{}
+				d.ListenPort = 0
+				d.FirewallMark = 1
+			},
+		},
+		{
+			name: "replace peers",
+			cfg: wgtypes.Config{
+				ReplacePeers: true,
+				Peers: []wgtypes.PeerConfig{{
+					PublicKey:  keyC,
+					AllowedIPs: []net.IPNet{wgtest.MustCIDR("10.0.0.3/24")},
+				}},
+			},
+			fn: func(d *wgtypes.Device) {
+				d.Peers = []wgtypes.Peer{{
+					PublicKey: keyC,
+					// Host bits are cleared.
+					AllowedIPs:      []net.IPNet{wgtest.MustCIDR("10.0.0.0/24")},
+					ProtocolVersion: 1,
+				}}
+			},
+		},
+		{
+			name: "update only and remove",
+			cfg: wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{
+					{
+						PublicKey:  keyC,
+						UpdateOnly: true,
+						Endpoint:   epB,
+					},
+					{
+						PublicKey: keyB,
+						Remove:    true,
+					},
+					{
+						PublicKey:                   keyA,
+						UpdateOnly:                  true,
+						PresharedKey:                &psk,
+						Endpoint:                    epB,
+						PersistentKeepaliveInterval: &ka,
+					},
+				},
+			},
+			fn: func(d *wgtypes.Device) {
+				d.Peers = d.Peers[:1]
+				d.Peers[0].PresharedKey = psk
+				d.Peers[0].Endpoint = epB
+				d.Peers[0].PersistentKeepaliveInterval = ka
+			},
+		},
+		{
+			name: "replace and move allowed IPs",
+			cfg: wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{
+					{
+						PublicKey:         keyA,
+						ReplaceAllowedIPs: true,
+						AllowedIPs:        []net.IPNet{netB},
+					},
+					{
+						PublicKey:  keyC,
+						AllowedIPs: []net.IPNet{netC},
+					},
+				},
+			},
+			fn: func(d *wgtypes.Device) {
+				d.Peers[0].AllowedIPs = []net.IPNet{netB}
+				d.Peers[1].AllowedIPs = []net.IPNet{}
+				d.Peers = append(d.Peers, wgtypes.Peer{
+					PublicKey:       keyC,
+					AllowedIPs:      []net.IPNet{netC},
+					ProtocolVersion: 1,
+				})
+			},
+		},
+		{
+			name: "own public key",
+			cfg: wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{PublicKey: priv.PublicKey()}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testDevice()
+			want := wgstate.Clone(d)
+			if tt.fn != nil {
+				tt.fn(want)
+			}
+
+			got := wgstate.Simulate(d, tt.cfg)
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("unexpected device (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(testDevice(), d); diff != "" {
+				t.Fatalf("input device was modified (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(d *wgtypes.Device)
+		cfg  wgtypes.Config
+	}{
+		{
+			name: "equal",
+		},
+		{
+			name: "device fields",
+			fn: func(d *wgtypes.Device) {
+				d.ListenPort = 0
+				d.FirewallMark = 1
+			},
+			cfg: wgtypes.Config{
+				ListenPort:   intPtr(0),
+				FirewallMark: intPtr(1),
+			},
+		},
+		{
+			name: "peers",
+			fn: func(d *wgtypes.Device) {
+				// Remove A, move one of B's prefixes to new peer C, and clear
+				// B's preshared key.
+				d.Peers = []wgtypes.Peer{
+					{
+						PublicKey:                   keyB,
+						PersistentKeepaliveInterval: ka,
+						AllowedIPs:                  []net.IPNet{netB},
+					},
+					{
+						PublicKey:  keyC,
+						Endpoint:   epB,
+						AllowedIPs: []net.IPNet{netC},
+					},
+				}
+			},
+			cfg: wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{
+					{
+						PublicKey: keyA,
+						Remove:    true,
+					},
+					{
+						PublicKey:         keyB,
+						UpdateOnly:        true,
+						PresharedKey:      &zeroK,
+						ReplaceAllowedIPs: true,
+						AllowedIPs:        []net.IPNet{netB},
+					},
+					{
+						PublicKey:         keyC,
+						Endpoint:          epB,
+						ReplaceAllowedIPs: true,
+						AllowedIPs:        []net.IPNet{netC},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from := testDevice()
+			to := wgstate.Clone(from)
+			if tt.fn != nil {
+				tt.fn(to)
+			}
+
+			cfg := wgstate.Diff(from, to)
+			if diff := cmp.Diff(tt.cfg, cfg); diff != "" {
+				t.Fatalf("unexpected config (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.fn == nil, wgstate.Empty(cfg)); diff != "" {
+				t.Fatalf("unexpected empty config (-want +got):\n%s", diff)
+			}
+
+			// Both Diff and Restore must produce the desired state.
+			if !wgstate.Equal(to, wgstate.Simulate(from, cfg)) {
+				t.Fatal("applying diff did not produce the desired device")
+			}
+			if !wgstate.Equal(to, wgstate.Simulate(from, wgstate.Restore(to))) {
+				t.Fatal("applying restore did not produce the desired device")
+			}
+		})
+	}
+}
+
+func intPtr(v int) *int { return &v }
+
+func TestDiffRedacted(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(d *wgtypes.Device)
+		cfg  wgtypes.Config
+	}{
+		{
+			name: "equal",
+		},
+		{
+			name: "keys known",
+			fn: func(d *wgtypes.Device) {
+				d.PrivateKey = priv
+				d.KeysRedacted = false
+				d.Peers[1].PresharedKey = psk
+				d.Peers[1].PresharedKeyRedacted = false
+			},
+		},
+		{
+			name: "preshared keys",
+			fn: func(d *wgtypes.Device) {
+				d.Peers[0].PresharedKey = psk
+				d.Peers[1].PresharedKeyRedacted = false
+			},
+			cfg: wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{
+					{
+						PublicKey:    keyA,
+						UpdateOnly:   true,
+						PresharedKey: &psk,
+					},
+					{
+						PublicKey:    keyB,
+						UpdateOnly:   true,
+						PresharedKey: &zeroK,
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from := redact(testDevice())
+			to := wgstate.Clone(from)
+			if tt.fn != nil {
+				tt.fn(to)
+			}
+
+			cfg := wgstate.Diff(from, to)
+			if diff := cmp.Diff(tt.cfg, cfg); diff != "" {
+				t.Fatalf("unexpected config (-want +got):\n%s", diff)
+			}
+
+			if !wgstate.Equal(to, wgstate.Simulate(from, cfg)) {
+				t.Fatal("applying diff did not produce the desired device")
+			}
+		})
+	}
+
+	// Redacted keys are compared by their public keys and presence.
+	d := testDevice()
+	if !wgstate.Equal(d, redact(d)) || !wgstate.Equal(redact(d), d) {
+		t.Fatal("redacted device is not equal to its original")
+	}
+
+	other := testDevice()
+	k := wgtest.MustPrivateKey()
+	other.PrivateKey, other.PublicKey = k, k.PublicKey()
+	if wgstate.Equal(other, redact(d)) {
+		t.Fatal("redacted device is equal to a device with another private key")
+	}
+
+	// A redacted private key is not restored.
+	if cfg := wgstate.Restore(redact(d)); cfg.PrivateKey != nil {
+		t.Fatalf("restore set a redacted private key: %+v", cfg)
+	}
+}
+
+// redact returns d as seen through a backend which redacts keys.
+func redact(d *wgtypes.Device) *wgtypes.Device {
+	d = wgstate.Clone(d)
+	d.PrivateKey = wgtypes.Key{}
+	d.KeysRedacted = true
+	for i := range d.Peers {
+		if d.Peers[i].PresharedKey != (wgtypes.Key{}) {
+			d.Peers[i].PresharedKey = wgtypes.Key{}
+			d.Peers[i].PresharedKeyRedacted = true
+		}
+	}
+
+	return d
+}
+
+func TestFingerprint(t *testing.T) {
+	want := wgstate.Fingerprint(testDevice())
+
+	// Fingerprints match exactly when devices are Equal, except that they
+	// ignore endpoints, which change as peers roam.
+	tests := []struct {
+		name        string
+		fn          func(d *wgtypes.Device)
+		equal, same bool
+	}{
+		{
+			name:  "unchanged",
+			fn:    func(_ *wgtypes.Device) {},
+			equal: true,
+			same:  true,
+		},
+		{
+			name: "statistics and order",
+			fn: func(d *wgtypes.Device) {
+				d.Name = "wg1"
+				d.Peers[0], d.Peers[1] = d.Peers[1], d.Peers[0]
+				d.Peers[0].AllowedIPs = []net.IPNet{netC, netB, netB}
+				d.Peers[1].ReceiveBytes = 2
+				d.Peers[1].LastHandshakeTime = time.Unix(1, 0)
+			},
+			equal: true,
+			same:  true,
+		},
+		{
+			name: "endpoint",
+			fn:   func(d *wgtypes.Device) { d.Peers[0].Endpoint = epB },
+			same: true,
+		},
+		{
+			name: "allowed IPs",
+			fn:   func(d *wgtypes.Device) { d.Peers[1].AllowedIPs = []net.IPNet{netB} },
+		},
+		{
+			name: "peer removed",
+			fn:   func(d *wgtypes.Device) { d.Peers = d.Peers[:1] },
+		},
+		{
+			name: "listen port",
+			fn:   func(d *wgtypes.Device) { d.ListenPort++ },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testDevice()
+			tt.fn(d)
+
+			if diff := cmp.Diff(tt.same, wgstate.Fingerprint(d) == want); diff != "" {
+				t.Fatalf("unexpected fingerprint equality (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.equal, wgstate.Equal(testDevice(), d)); diff != "" {
+				t.Fatalf("unexpected device equality (-want +got):\n%s", diff)
+			}
+		})
+	}
+	// Redacted devices have their own fingerprints, which depend on the
+	// presence of preshared keys.
+	redacted := wgstate.Fingerprint(redact(testDevice()))
+	if redacted == want || redacted != wgstate.Fingerprint(redact(testDevice())) {
+		t.Fatal("unexpected fingerprint of redacted device")
+	}
+
+	d := testDevice()
+	d.Peers[1].PresharedKey = wgtypes.Key{}
+	if wgstate.Fingerprint(redact(d)) == redacted {
+		t.Fatal("removing a redacted preshared key did not change the fingerprint")
+	}
+}
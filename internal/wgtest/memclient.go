@@ -0,0 +1,221 @@
+package wgtest
+
+import (
+	"os"
+	"sync"
+
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgstate"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+var _ wginternal.Client = &MemClient{}
+
+// A MemClient is a wginternal.Client which controls in-memory devices,
+// simulating the semantics of a WireGuard implementation. It is safe for
+// concurrent use.
+type MemClient struct {
+	mu         sync.Mutex
+	devices    []*wgtypes.Device
+	fail       map[string][]func(m *MemClient, cfg wgtypes.Config) error
+	redact     bool
+	configured int
+	actor      string
+}
+
+// NewMemClient creates a MemClient which controls copies of devices.
+func NewMemClient(devices ...*wgtypes.Device) *MemClient {
+	m := &MemClient{}
+	for _, d := range devices {
+		m.devices = append(m.devices, wgstate.Clone(d))
+	}
+
+	return m
+}
+
+// Redact specifies that private and preshared keys are withheld from the
+// devices returned by Device and Devices, as by a remote backend.
+func (m *MemClient) Redact(redact bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.redact = redact
+}
+
+// FailNext arranges for fn to be called once in place of the next
+// configuration of the device specified by name. Calls are queued, so that
+// several configurations can fail in turn.
+func (m *MemClient) FailNext(name string, fn func(m *MemClient, cfg wgtypes.Config) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.fail == nil {
+		m.fail = make(map[string][]func(m *MemClient, cfg wgtypes.Config) error)
+	}
+
+	m.fail[name] = append(m.fail[name], fn)
+}
+
+// State returns a copy of the device specified by name, including any keys
+// withheld by Redact, or nil if it does not exist.
+func (m *MemClient) State(name string) *wgtypes.Device {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if i := m.index(name); i >= 0 {
+		return wgstate.Clone(m.devices[i])
+	}
+
+	return nil
+}
+
+// SetState replaces the device with the same name as d with a copy of d, or
+// adds it if no such device exists.
+func (m *MemClient) SetState(d *wgtypes.Device) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if i := m.index(d.Name); i >= 0 {
+		m.devices[i] = wgstate.Clone(d)
+		return
+	}
+
+	m.devices = append(m.devices, wgstate.Clone(d))
+}
+
+// Apply applies cfg to the device specified by name, bypassing FailNext and
+// the count of configurations.
+func (m *MemClient) Apply(name string, cfg wgtypes.Config) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(name)
+	if i < 0 {
+		return os.ErrNotExist
+	}
+
+	m.devices[i] = wgstate.Simulate(m.devices[i], cfg)
+	return nil
+}
+
+// Configured returns the number of configurations applied by ConfigureDevice
+// and ConfigureDeviceAs.
+func (m *MemClient) Configured() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.configured
+}
+
+// Actor returns the actor of the most recent configuration applied by
+// ConfigureDeviceAs, or empty if it was applied by ConfigureDevice.
+func (m *MemClient) Actor() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.actor
+}
+
+// Close implements wginternal.Client.
+func (m *MemClient) Close() error { return nil }
+
+// Devices implements wginternal.Client.
+func (m *MemClient) Devices() ([]*wgtypes.Device, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]*wgtypes.Device, 0, len(m.devices))
+	for _, d := range m.devices {
+		out = append(out, m.view(d))
+	}
+
+	return out, nil
+}
+
+// Device implements wginternal.Client.
+func (m *MemClient) Device(name string) (*wgtypes.Device, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.index(name)
+	if i < 0 {
+		return nil, os.ErrNotExist
+	}
+
+	return m.view(m.devices[i]), nil
+}
+
+// ConfigureDevice implements wginternal.Client.
+func (m *MemClient) ConfigureDevice(name string, cfg wgtypes.Config) error {
+	return m.ConfigureDeviceAs("", name, cfg)
+}
+
+// ConfigureDeviceAs configures a device as with ConfigureDevice, recording
+// actor as the caller which configured it.
+func (m *MemClient) ConfigureDeviceAs(actor, name string, cfg wgtypes.Config) error {
+	m.mu.Lock()
+
+	if m.index(name) < 0 {
+		m.mu.Unlock()
+		return os.ErrNotExist
+	}
+
+	if fns := m.fail[name]; len(fns) > 0 {
+		m.fail[name] = fns[1:]
+		m.mu.Unlock()
+
+		// fn may apply configurations itself.
+		return fns[0](m, cfg)
+	}
+	defer m.mu.Unlock()
+
+	i := m.index(name)
+	m.devices[i] = wgstate.Simulate(m.devices[i], cfg)
+	m.configured++
+	m.actor = actor
+	return nil
+}
+
+// Capabilities implements wginternal.Client.
+func (m *MemClient) Capabilities(name string) (*wgtypes.Capabilities, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.index(name) < 0 {
+		return nil, os.ErrNotExist
+	}
+
+	return &wgtypes.Capabilities{Supported: wgtypes.CapabilityConfigure}, nil
+}
+
+// index returns the index of the device specified by name, or -1 if it does
+// not exist. The caller must hold m.mu.
+func (m *MemClient) index(name string) int {
+	for i, d := range m.devices {
+		if d.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// view returns a copy of d as seen by callers, withholding keys if m.redact
+// is set. The caller must hold m.mu.
+func (m *MemClient) view(d *wgtypes.Device) *wgtypes.Device {
+	d = wgstate.Clone(d)
+	if !m.redact {
+		return d
+	}
+
+	d.PrivateKey = wgtypes.Key{}
+	d.KeysRedacted = true
+	for i := range d.Peers {
+		if d.Peers[i].PresharedKey != (wgtypes.Key{}) {
+			d.Peers[i].PresharedKey = wgtypes.Key{}
+			d.Peers[i].PresharedKeyRedacted = true
+		}
+	}
+
+	return d
+}
@@ -1,37 +1,127 @@
 package wguser
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
-var _ wginternal.Client = &Client{}
+var (
+	_ wginternal.Client  = &Client{}
+	_ wginternal.Watcher = &Client{}
+)
 
-// A Client provides access to userspace WireGuard device information.
+// A Client provides access to userspace WireGuard device information. A
+// Client is safe for concurrent use.
 type Client struct {
 	dial func(device string) (net.Conn, error)
 	find func() ([]string, error)
+
+	// policy, if not nil, is checked before and after dialing a device.
+	policy *Policy
+
+	// trace, if not nil, receives the raw exchanges with each device.
+	trace wginternal.Tracer
+
+	// observer, if not nil, is notified of each operation.
+	observer wginternal.Observer
+
+	// concurrency is the maximum number of devices queried at once by
+	// Devices.
+	concurrency int
+
+	// Optional hooks which are only set when the operating system can notify
+	// us of userspace devices appearing and disappearing.
+	watch  func(ctx context.Context) (<-chan wginternal.Event, error)
+	forget func(device string)
+	close  func() error
 }
 
-// New creates a new Client.
-func New() (*Client, error) {
-	return &Client{
+// A Config configures a Client.
+type Config struct {
+	// Policy, if not nil, specifies which device sockets are trusted.
+	Policy *Policy
+
+	// Trace, if not nil, receives the raw exchanges with each device.
+	Trace wginternal.Tracer
+
+	// Observer, if not nil, is notified of each operation.
+	Observer wginternal.Observer
+
+	// Concurrency specifies the maximum number of devices queried at once by
+	// Devices. If less than 2, devices are queried one at a time.
+	Concurrency int
+
+	// Find and Dial, if not nil, replace the operating system-specific
+	// functions used to identify and connect to devices. Find returns paths
+	// which are passed to Dial; the device name is the base name of a path
+	// without its extension.
+	Find func() ([]string, error)
+	Dial func(device string) (net.Conn, error)
+}
+
+// New creates a new Client. If cfg is nil, a default configuration is used.
+func New(cfg *Config) (*Client, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	c := &Client{
 		// Operating system-specific functions which can identify and connect
 		// to userspace WireGuard devices. These functions can also be
 		// overridden for tests.
 		dial: dial,
 		find: find,
-	}, nil
+
+		policy:      cfg.Policy,
+		trace:       cfg.Trace,
+		observer:    cfg.Observer,
+		concurrency: cfg.Concurrency,
+	}
+
+	if cfg.Find != nil || cfg.Dial != nil {
+		if cfg.Find != nil {
+			c.find = cfg.Find
+		}
+		if cfg.Dial != nil {
+			c.dial = cfg.Dial
+		}
+
+		return c, nil
+	}
+
+	// Where possible, keep track of devices as they come and go rather than
+	// scanning for them on every call.
+	initWatcher(c)
+
+	return c, nil
 }
 
 // Close implements wginternal.Client.
-func (c *Client) Close() error { return nil }
+func (c *Client) Close() error {
+	if c.close == nil {
+		return nil
+	}
+
+	return c.close()
+}
+
+// Watch implements wginternal.Watcher.
+func (c *Client) Watch(ctx context.Context) (<-chan wginternal.Event, error) {
+	if c.watch == nil {
+		return nil, wginternal.ErrNotSupported
+	}
+
+	return c.watch(ctx)
+}
 
 // Devices implements wginternal.Client.
 func (c *Client) Devices() ([]*wgtypes.Device, error) {
@@ -40,17 +130,23 @@ func (c *Client) Devices() ([]*wgtypes.Device, error) {
 		return nil, err
 	}
 
-	var wgds []*wgtypes.Device
-	for _, d := range devices {
-		wgd, err := c.getDevice(d)
+	get := func(device string) (*wgtypes.Device, error) {
+		d, err := c.getDevice(device)
 		if err != nil {
-			return nil, err
+			return nil, wginternal.WrapError(backend, wginternal.OpGet, deviceName(device), err)
 		}
 
-		wgds = append(wgds, wgd)
+		return d, nil
 	}
 
-	return wgds, nil
+	skip := func(err error) bool {
+		// Skip devices which went away between finding and dialing them, and
+		// don't allow an untrusted socket to prevent listing the remaining
+		// devices.
+		return os.IsNotExist(err) || errors.Is(err, wginternal.ErrUntrustedSocket)
+	}
+
+	return wginternal.FetchDevices(devices, c.concurrency, get, skip)
 }
 
 // Device implements wginternal.Client.
@@ -65,7 +161,12 @@ func (c *Client) Device(name string) (*wgtypes.Device, error) {
 			continue
 		}
 
-		return c.getDevice(d)
+		wgd, err := c.getDevice(d)
+		if err != nil {
+			return nil, wginternal.WrapError(backend, wginternal.OpGet, name, err)
+		}
+
+		return wgd, nil
 	}
 
 	return nil, os.ErrNotExist
@@ -83,12 +184,73 @@ func (c *Client) ConfigureDevice(name string, cfg wgtypes.Config) error {
 			continue
 		}
 
-		return c.configureDevice(d, cfg)
+		err := c.configureDevice(d, cfg)
+		return wginternal.WrapError(backend, wginternal.OpSet, name, err)
 	}
 
 	return os.ErrNotExist
 }
 
+// Capabilities implements wginternal.Client.
+func (c *Client) Capabilities(name string) (*wgtypes.Capabilities, error) {
+	devices, err := c.find()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range devices {
+		if name != deviceName(d) {
+			continue
+		}
+
+		caps := &wgtypes.Capabilities{
+			Backend:   backend,
+			Type:      wgtypes.Userspace,
+			Supported: wgtypes.CapabilityConfigure,
+		}
+		if c.watch != nil {
+			caps.Supported |= wgtypes.CapabilityWatch
+		}
+
+		return caps, nil
+	}
+
+	return nil, os.ErrNotExist
+}
+
+// dialDevice dials a device specified by its path, enforcing the Client's
+// socket policy. If the device's socket is stale and a watcher is tracking
+// devices, the device is forgotten and an error compatible with os.IsNotExist
+// is returned.
+func (c *Client) dialDevice(device string) (net.Conn, error) {
+	if c.policy != nil {
+		if err := c.policy.checkSocket(device); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := c.observedDial(device)
+	if err != nil {
+		if c.forget != nil && errors.Is(err, syscall.ECONNREFUSED) {
+			// Nothing is listening on the socket: the process which created it
+			// has exited without cleaning up.
+			c.forget(device)
+			return nil, os.ErrNotExist
+		}
+
+		return nil, err
+	}
+
+	if c.policy != nil {
+		if err := c.policy.checkPeer(device, conn); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
 // deviceName infers a device name from an absolute file path with extension.
 func deviceName(sock string) string {
 	return strings.TrimSuffix(filepath.Base(sock), filepath.Ext(sock))
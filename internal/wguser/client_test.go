@@ -1,13 +1,19 @@
 package wguser
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
@@ -58,6 +64,73 @@ func TestClientDevice(t *testing.T) {
 	}
 }
 
+func TestClientDevicesConcurrency(t *testing.T) {
+	var paths []string
+	for i := 0; i < 8; i++ {
+		paths = append(paths, fmt.Sprintf("/run/wireguard/wg%d.sock", i))
+	}
+
+	for _, n := range []int{1, 4} {
+		t.Run(fmt.Sprintf("concurrency %d", n), func(t *testing.T) {
+			// Device wg1 always goes away before it can be dialed, and devices
+			// wg3 and wg5 report errors until fail is cleared.
+			var fail int32 = 1
+
+			c, err := New(&Config{
+				Concurrency: n,
+				Find:        func() ([]string, error) { return paths, nil },
+				Dial: func(device string) (net.Conn, error) {
+					res := "listen_port=51820\nerrno=0\n\n"
+					switch name := deviceName(device); {
+					case name == "wg1":
+						return nil, os.ErrNotExist
+					case (name == "wg3" || name == "wg5") && atomic.LoadInt32(&fail) == 1:
+						res = "errno=1\n\n"
+					}
+
+					c, s := net.Pipe()
+					go func() {
+						defer s.Close()
+						_, _ = s.Read(make([]byte, 64))
+						_, _ = io.WriteString(s, res)
+					}()
+
+					return c, nil
+				},
+			})
+			if err != nil {
+				t.Fatalf("failed to create client: %v", err)
+			}
+			defer c.Close()
+
+			// The error for the earliest device is always returned.
+			_, err = c.Devices()
+
+			var oerr *wginternal.OpError
+			if !errors.As(err, &oerr) || oerr.Device != "wg3" {
+				t.Fatalf("expected error for wg3, but got: %v", err)
+			}
+
+			atomic.StoreInt32(&fail, 0)
+
+			ds, err := c.Devices()
+			if err != nil {
+				t.Fatalf("failed to get devices: %v", err)
+			}
+
+			var names []string
+			for _, d := range ds {
+				names = append(names, d.Name)
+			}
+
+			want := []string{"wg0", "wg2", "wg3", "wg4", "wg5", "wg6", "wg7"}
+			if diff := cmp.Diff(want, names); diff != "" {
+				t.Fatalf("unexpected devices (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func testClient(t *testing.T, res []byte) (*Client, func() []byte) {
 	t.Helper()
 
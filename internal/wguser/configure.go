@@ -8,17 +8,21 @@ import (
 	"os"
 	"strings"
 
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 // configureDevice configures a device specified by its path.
-func (c *Client) configureDevice(device string, cfg wgtypes.Config) error {
-	conn, err := c.dial(device)
+func (c *Client) configureDevice(device string, cfg wgtypes.Config) (err error) {
+	conn, err := c.dialDevice(device)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
+	conn, done := c.traced(wginternal.OpSet, device, conn)
+	defer func() { done(err) }()
+
 	// Start with set command.
 	var buf bytes.Buffer
 	buf.WriteString("set=1\n")
@@ -14,13 +14,17 @@ func dial(device string) (net.Conn, error) {
 	return net.Dial("unix", device)
 }
 
+// socketDirs are the directories where userspace WireGuard devices create
+// their UNIX sockets.
+var socketDirs = []string{
+	// It seems that /var/run is a common location between Linux and the
+	// BSDs, even though it's a symlink on Linux.
+	"/var/run/wireguard",
+}
+
 // find is the default implementation of Client.find.
 func find() ([]string, error) {
-	return findUNIXSockets([]string{
-		// It seems that /var/run is a common location between Linux and the
-		// BSDs, even though it's a symlink on Linux.
-		"/var/run/wireguard",
-	})
+	return findUNIXSockets(socketDirs)
 }
 
 // findUNIXSockets looks for UNIX socket files in the specified directories.
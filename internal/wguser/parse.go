@@ -11,6 +11,7 @@ import (
 	"strconv"
 	"time"
 
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
@@ -19,13 +20,16 @@ import (
 
 // getDevice gathers device information from a device specified by its path
 // and returns a Device.
-func (c *Client) getDevice(device string) (*wgtypes.Device, error) {
-	conn, err := c.dial(device)
+func (c *Client) getDevice(device string) (_ *wgtypes.Device, err error) {
+	conn, err := c.dialDevice(device)
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Close()
 
+	conn, done := c.traced(wginternal.OpGet, device, conn)
+	defer func() { done(err) }()
+
 	// Get information about this device.
 	if _, err := io.WriteString(conn, "get=1\n\n"); err != nil {
 		return nil, err
@@ -88,8 +92,11 @@ func (dp *deviceParser) Device() (*wgtypes.Device, error) {
 		return nil, dp.err
 	}
 
-	// Compute remaining fields of the Device now that all parsing is done.
-	dp.d.PublicKey = dp.d.PrivateKey.PublicKey()
+	// Compute remaining fields of the Device now that all parsing is done,
+	// unless the public key was recorded in place of a redacted private key.
+	if !dp.d.KeysRedacted {
+		dp.d.PublicKey = dp.d.PrivateKey.PublicKey()
+	}
 
 	return &dp.d, nil
 }
@@ -132,6 +139,9 @@ func (dp *deviceParser) Parse(key, value string) {
 		dp.d.ListenPort = dp.parseInt(value)
 	case "fwmark":
 		dp.d.FirewallMark = dp.parseInt(value)
+	case keyRedactedPublic:
+		dp.d.PublicKey = dp.parseKey(value)
+		dp.d.KeysRedacted = true
 	}
 }
 
@@ -173,6 +183,8 @@ func (dp *deviceParser) peerParse(key, value string) {
 		}
 	case "protocol_version":
 		p.ProtocolVersion = dp.parseInt(value)
+	case keyRedactedPreshared:
+		p.PresharedKeyRedacted = true
 	}
 }
 
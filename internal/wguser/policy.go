@@ -0,0 +1,84 @@
+package wguser
+
+import (
+	"fmt"
+	"os"
+
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+)
+
+// defaultForbiddenMode refuses sockets which are writable by group or others.
+const defaultForbiddenMode os.FileMode = 0022
+
+// A Policy specifies which userspace device sockets a Client trusts.
+type Policy struct {
+	// UIDs are the user IDs permitted to own a device socket. If empty, only
+	// root and the effective user ID of this process are permitted.
+	UIDs []int
+
+	// GIDs are the group IDs permitted to own a device socket. If empty, the
+	// owning group is not checked.
+	GIDs []int
+
+	// ForbiddenMode specifies permission bits which must not be set on a
+	// device socket. If zero, sockets writable by group or others are refused.
+	ForbiddenMode os.FileMode
+
+	// VerifyPeer specifies that the credentials of the process listening on
+	// a device socket must also be checked against UIDs and GIDs. They are
+	// always checked on Linux, where the check is also what prevents the
+	// socket from being replaced between checkSocket and dialing it.
+	VerifyPeer bool
+}
+
+// checkOwner verifies the owner and permissions of a device socket.
+func (p *Policy) checkOwner(device string, uid, gid int, mode os.FileMode) error {
+	if err := p.checkIDs(uid, gid); err != nil {
+		return untrustedf(device, "owner %v", err)
+	}
+
+	forbidden := p.ForbiddenMode
+	if forbidden == 0 {
+		forbidden = defaultForbiddenMode
+	}
+
+	if bad := mode.Perm() & forbidden; bad != 0 {
+		return untrustedf(device, "mode %s has forbidden permissions %#o", mode.Perm(), uint32(bad))
+	}
+
+	return nil
+}
+
+// checkIDs verifies that uid and gid are permitted.
+func (p *Policy) checkIDs(uid, gid int) error {
+	uids := p.UIDs
+	if len(uids) == 0 {
+		uids = []int{0, os.Geteuid()}
+	}
+
+	if !contains(uids, uid) {
+		return fmt.Errorf("uid %d is not permitted", uid)
+	}
+
+	if len(p.GIDs) > 0 && !contains(p.GIDs, gid) {
+		return fmt.Errorf("gid %d is not permitted", gid)
+	}
+
+	return nil
+}
+
+// untrustedf produces an error wrapping wginternal.ErrUntrustedSocket for
+// device.
+func untrustedf(device, format string, a ...interface{}) error {
+	return fmt.Errorf("wguser: %s: %s: %w", device, fmt.Sprintf(format, a...), wginternal.ErrUntrustedSocket)
+}
+
+func contains(ids []int, id int) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+
+	return false
+}
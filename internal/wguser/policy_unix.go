@@ -0,0 +1,55 @@
+//+build !windows
+
+package wguser
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+)
+
+// checkSocket verifies the ownership and permissions of a device socket
+// before it is dialed. The socket may be replaced before it is dialed, which
+// only checkPeer can detect.
+func (p *Policy) checkSocket(device string) error {
+	// Use Lstat so a symlink to a socket elsewhere is refused.
+	fi, err := os.Lstat(device)
+	if err != nil {
+		return err
+	}
+
+	if fi.Mode()&os.ModeSocket == 0 {
+		return untrustedf(device, "not a socket")
+	}
+
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("wguser: unexpected file information type for %s: %T", device, fi.Sys())
+	}
+
+	return p.checkOwner(device, int(st.Uid), int(st.Gid), fi.Mode())
+}
+
+// checkPeer verifies the credentials of the process listening on a device
+// socket. They are always verified on Linux, and otherwise only if required
+// by p.
+func (p *Policy) checkPeer(device string, c net.Conn) error {
+	if !p.VerifyPeer && runtime.GOOS != "linux" {
+		return nil
+	}
+
+	uid, gid, err := wginternal.PeerCredentials(c)
+	if err != nil {
+		return untrustedf(device, "failed to verify peer credentials: %v", err)
+	}
+
+	if err := p.checkIDs(uid, gid); err != nil {
+		return untrustedf(device, "peer %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+//+build !windows
+
+package wguser
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"testing"
+
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+)
+
+func TestUNIXClientPolicy(t *testing.T) {
+	uid := os.Geteuid()
+
+	tests := []struct {
+		name    string
+		p       *Policy
+		chmod   os.FileMode
+		trusted bool
+	}{
+		{
+			name:    "default",
+			p:       &Policy{},
+			trusted: true,
+		},
+		{
+			name: "bad UID",
+			p:    &Policy{UIDs: []int{uid + 1}},
+		},
+		{
+			name: "bad GID",
+			p:    &Policy{GIDs: []int{os.Getegid() + 1}},
+		},
+		{
+			name:  "world writable",
+			p:     &Policy{},
+			chmod: 0777,
+		},
+		{
+			name:    "allowed mode",
+			p:       &Policy{ForbiddenMode: 0002},
+			chmod:   0770,
+			trusted: true,
+		},
+		{
+			name:    "verify peer",
+			p:       &Policy{VerifyPeer: true},
+			trusted: runtime.GOOS == "linux",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := testClient(t, nil)
+			defer done()
+
+			c.policy = tt.p
+
+			if tt.chmod != 0 {
+				socks, err := c.find()
+				if err != nil {
+					t.Fatalf("failed to find socket: %v", err)
+				}
+
+				if err := os.Chmod(socks[0], tt.chmod); err != nil {
+					t.Fatalf("failed to change socket mode: %v", err)
+				}
+			}
+
+			_, err := c.Device(testDevice)
+			if tt.trusted {
+				if err != nil {
+					t.Fatalf("failed to get device: %v", err)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, wginternal.ErrUntrustedSocket) {
+				t.Fatalf("expected untrusted socket error, but got: %v", err)
+			}
+
+			// Untrusted sockets are omitted rather than failing Devices.
+			devices, err := c.Devices()
+			if err != nil {
+				t.Fatalf("failed to get devices: %v", err)
+			}
+
+			if len(devices) != 0 {
+				t.Fatalf("expected no devices, but got: %d", len(devices))
+			}
+		})
+	}
+}
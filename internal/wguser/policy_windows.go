@@ -0,0 +1,12 @@
+//+build windows
+
+package wguser
+
+import "net"
+
+// checkSocket is a no-op on Windows, where access to device named pipes is
+// restricted by the ProtectedPrefix\Administrators namespace.
+func (p *Policy) checkSocket(_ string) error { return nil }
+
+// checkPeer is a no-op on Windows; see checkSocket.
+func (p *Policy) checkPeer(_ string, _ net.Conn) error { return nil }
@@ -0,0 +1,150 @@
+package wguser
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+)
+
+// backend is the name of this backend in a wginternal.Exchange.
+const backend = "wguser"
+
+// traced wraps conn so the raw exchange with device can be passed to the
+// Client's tracer, and the operation reported to the Client's observer. The
+// returned function must be called with the result of the operation once it
+// completes.
+func (c *Client) traced(op, device string, conn net.Conn) (net.Conn, func(err error)) {
+	if c.trace == nil && c.observer == nil {
+		return conn, func(error) {}
+	}
+
+	o := wginternal.StartOp(c.observer, backend, op, deviceName(device))
+	tc := &traceConn{
+		Conn:   conn,
+		record: c.trace != nil,
+	}
+
+	return tc, func(err error) {
+		if c.trace != nil {
+			ex := wginternal.Exchange{
+				Backend:   backend,
+				Operation: op,
+				Device:    deviceName(device),
+				Request:   [][]byte{redact(tc.req.Bytes())},
+				Response:  [][]byte{redact(tc.res.Bytes())},
+			}
+			if err != nil {
+				ex.Error = err.Error()
+			}
+
+			c.trace(ex)
+		}
+
+		// The configuration protocol uses a single request for each
+		// operation, and a set request is applied as a single batch.
+		o.Messages = 1
+		if op == wginternal.OpSet {
+			o.Batches = 1
+		}
+		o.BytesSent, o.BytesReceived = tc.sent, tc.received
+		o.Finish(c.observer, err)
+	}
+}
+
+// observedDial dials device, reporting the attempt to the Client's observer.
+func (c *Client) observedDial(device string) (net.Conn, error) {
+	if c.observer == nil {
+		return c.dial(device)
+	}
+
+	o := wginternal.StartOp(c.observer, backend, wginternal.OpDial, deviceName(device))
+	conn, err := c.dial(device)
+	o.Finish(c.observer, err)
+
+	return conn, err
+}
+
+// A traceConn counts, and optionally records, all data written to and read
+// from a net.Conn.
+type traceConn struct {
+	net.Conn
+	record         bool
+	req, res       bytes.Buffer
+	sent, received int
+}
+
+func (c *traceConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.received += n
+	if c.record {
+		c.res.Write(b[:n])
+	}
+	return n, err
+}
+
+func (c *traceConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.sent += n
+	if c.record {
+		c.req.Write(b[:n])
+	}
+	return n, err
+}
+
+// zeroKey is the hex representation of an all-zero key.
+var zeroKey = strings.Repeat("0", 64)
+
+// Keys added to recorded exchanges by redact, so that a replayed device can be
+// described accurately without its secret keys.
+const (
+	keyRedactedPublic    = "redacted_public_key"
+	keyRedactedPreshared = "redacted_preshared_key"
+)
+
+// redact produces a copy of the configuration protocol text in b with all
+// private and preshared keys replaced by zero keys. Each private key is
+// followed by the public key derived from it, and each non-zero preshared key
+// by a line noting that it was present.
+func redact(b []byte) []byte {
+	lines := bytes.Split(b, []byte("\n"))
+	out := make([][]byte, 0, len(lines))
+	for _, l := range lines {
+		out = append(out, l)
+
+		kvs := bytes.SplitN(l, []byte("="), 2)
+		if len(kvs) != 2 {
+			continue
+		}
+
+		key, value := string(kvs[0]), string(kvs[1])
+		switch key {
+		case "private_key", "preshared_key":
+			out[len(out)-1] = []byte(key + "=" + zeroKey)
+		default:
+			continue
+		}
+
+		if value == zeroKey {
+			continue
+		}
+
+		switch key {
+		case "private_key":
+			var dp deviceParser
+			priv := dp.parseKey(value)
+			if dp.err != nil {
+				continue
+			}
+
+			pub := priv.PublicKey()
+			out = append(out, []byte(keyRedactedPublic+"="+hex.EncodeToString(pub[:])))
+		case "preshared_key":
+			out = append(out, []byte(keyRedactedPreshared+"=true"))
+		}
+	}
+
+	return bytes.Join(out, []byte("\n"))
+}
@@ -0,0 +1,77 @@
+package wguser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestClientTraceReplay(t *testing.T) {
+	c, done := testClient(t, []byte(okGet))
+	defer done()
+
+	var exs []wginternal.Exchange
+	c.trace = func(ex wginternal.Exchange) {
+		exs = append(exs, ex)
+	}
+
+	want, err := c.Device(testDevice)
+	if err != nil {
+		t.Fatalf("failed to get device: %v", err)
+	}
+
+	if diff := cmp.Diff(1, len(exs)); diff != "" {
+		t.Fatalf("unexpected number of exchanges (-want +got):\n%s", diff)
+	}
+
+	ex := exs[0]
+	if diff := cmp.Diff("get=1\n\n", string(ex.Request[0])); diff != "" {
+		t.Fatalf("unexpected request (-want +got):\n%s", diff)
+	}
+
+	res := string(ex.Response[0])
+	for _, key := range []string{
+		"e84b5a6d2717c1003a13b431570353dbaca9146cf150c5f8575680feba52027a",
+		"188515093e952f5f22e865cef3012e72f8b5f0b598ac0309d5dacce3b70fcf52",
+	} {
+		if strings.Contains(res, key) {
+			t.Fatalf("secret key %s was not redacted:\n%s", key, res)
+		}
+	}
+
+	got, err := NewReplay(exs).Device(testDevice)
+	if err != nil {
+		t.Fatalf("failed to replay device: %v", err)
+	}
+
+	// Keys are redacted, but everything else must round-trip.
+	want.PrivateKey = wgtypes.Key{}
+	want.KeysRedacted = true
+	want.Peers[0].PresharedKey = wgtypes.Key{}
+	want.Peers[0].PresharedKeyRedacted = true
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected replayed device (-want +got):\n%s", diff)
+	}
+}
+
+func Test_redact(t *testing.T) {
+	const (
+		key  = "e84b5a6d2717c1003a13b431570353dbaca9146cf150c5f8575680feba52027a"
+		zero = "0000000000000000000000000000000000000000000000000000000000000000"
+		pub  = "c1532e1b3d3508fc7ebc354fa679620f33f287149542e684c67b7b0d81362b29"
+	)
+
+	in := "set=1\nprivate_key=" + key + "\npublic_key=" + key + "\npreshared_key=" + key +
+		"\npublic_key=" + key + "\npreshared_key=" + zero + "\n\n"
+	want := "set=1\nprivate_key=" + zero + "\nredacted_public_key=" + pub + "\npublic_key=" + key +
+		"\npreshared_key=" + zero + "\nredacted_preshared_key=true" +
+		"\npublic_key=" + key + "\npreshared_key=" + zero + "\n\n"
+
+	if diff := cmp.Diff(want, string(redact([]byte(in)))); diff != "" {
+		t.Fatalf("unexpected redacted output (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,538 @@
+//+build linux
+
+package wguser
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// initWatcher configures c to use an inotify watcher to track userspace
+// devices once c.Watch is first called. Until then, or if inotify is
+// unavailable, c continues to scan for devices on each call.
+func initWatcher(c *Client) {
+	lw := &lazyWatcher{
+		scan: c.find,
+		dial: c.probe,
+	}
+
+	c.find = lw.Find
+	c.watch = lw.Watch
+	c.forget = lw.Forget
+	c.close = lw.Close
+}
+
+// probe dials a device socket to check whether it is stale, enforcing the
+// Client's socket policy so that untrusted sockets are never dialed. Such
+// sockets are kept, and refused when the device is dialed.
+func (c *Client) probe(device string) (net.Conn, error) {
+	if c.policy != nil {
+		if err := c.policy.checkSocket(device); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.dial(device)
+}
+
+// A lazyWatcher starts a watcher on the first call to Watch, so that Clients
+// which never watch devices don't hold an inotify descriptor and goroutine.
+type lazyWatcher struct {
+	scan func() ([]string, error)
+	dial func(device string) (net.Conn, error)
+
+	mu     sync.Mutex
+	w      *watcher
+	closed bool
+}
+
+// get returns the watcher if it has been started.
+func (lw *lazyWatcher) get() *watcher {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	return lw.w
+}
+
+// Find implements Client.find by scanning for sockets until the watcher is
+// started.
+func (lw *lazyWatcher) Find() ([]string, error) {
+	if w := lw.get(); w != nil {
+		return w.Find()
+	}
+
+	return lw.scan()
+}
+
+// Forget implements Client.forget.
+func (lw *lazyWatcher) Forget(sock string) {
+	if w := lw.get(); w != nil {
+		w.Forget(sock)
+	}
+}
+
+// Watch implements Client.watch, starting the watcher if necessary.
+func (lw *lazyWatcher) Watch(ctx context.Context) (<-chan wginternal.Event, error) {
+	lw.mu.Lock()
+	if lw.closed {
+		lw.mu.Unlock()
+		return nil, os.ErrClosed
+	}
+
+	if lw.w == nil {
+		w, err := newWatcher(socketDirs, lw.dial)
+		if err != nil {
+			lw.mu.Unlock()
+			return nil, err
+		}
+
+		lw.w = w
+	}
+
+	w := lw.w
+	lw.mu.Unlock()
+
+	return w.Watch(ctx)
+}
+
+// Close implements Client.close.
+func (lw *lazyWatcher) Close() error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	lw.closed = true
+	if lw.w == nil {
+		return nil
+	}
+
+	return lw.w.Close()
+}
+
+// Inotify masks for socket directories and their parents.
+const (
+	dirMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM |
+		unix.IN_MOVED_TO | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF | unix.IN_ONLYDIR
+
+	parentMask = unix.IN_CREATE | unix.IN_MOVED_TO | unix.IN_ONLYDIR
+)
+
+// A watcher uses inotify to maintain an always-current list of userspace
+// device sockets, and notifies subscribers as devices appear and disappear.
+type watcher struct {
+	fd   int
+	f    *os.File
+	dial func(device string) (net.Conn, error)
+	done chan struct{}
+
+	mu sync.Mutex
+	// Watch descriptors map to either a socket directory, or the parent of
+	// socket directories which do not exist yet.
+	dirs    map[int]string
+	parents map[int][]string
+	socks   map[string]struct{}
+
+	subMu sync.Mutex
+	subs  map[*subscription]struct{}
+	subWG sync.WaitGroup
+}
+
+// A subscription is a single caller of watcher.Watch. Events are queued for
+// each subscription and delivered by its own goroutine, so that a subscriber
+// which stops reading never blocks the watcher, other subscribers, or
+// callers which forget stale sockets.
+type subscription struct {
+	ctx context.Context
+	c   chan wginternal.Event
+
+	mu    sync.Mutex
+	queue []wginternal.Event
+	wake  chan struct{}
+}
+
+// newWatcher creates a watcher over the socket directories in dirs, using
+// dial to probe for stale sockets.
+func newWatcher(dirs []string, dial func(device string) (net.Conn, error)) (*watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	w := &watcher{
+		// A non-blocking file is registered with the runtime network poller,
+		// so Close will interrupt a pending Read.
+		fd:   fd,
+		f:    os.NewFile(uintptr(fd), "inotify"),
+		dial: dial,
+		done: make(chan struct{}),
+
+		dirs:    make(map[int]string),
+		parents: make(map[int][]string),
+		socks:   make(map[string]struct{}),
+		subs:    make(map[*subscription]struct{}),
+	}
+
+	for _, d := range dirs {
+		ok, err := w.addDir(d)
+		if err != nil {
+			_ = w.f.Close()
+			return nil, err
+		}
+		if ok {
+			w.scan(d)
+		}
+	}
+
+	go w.loop()
+	return w, nil
+}
+
+// Close stops the watcher and closes all subscription channels.
+func (w *watcher) Close() error {
+	err := w.f.Close()
+	<-w.done
+
+	// Each subscription closes its channel when the watcher is done.
+	w.subWG.Wait()
+	return err
+}
+
+// Find returns the currently known device sockets. It implements Client.find.
+func (w *watcher) Find() ([]string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	socks := make([]string, 0, len(w.socks))
+	for s := range w.socks {
+		socks = append(socks, s)
+	}
+
+	// Keep the same ordering as a directory scan.
+	sort.Strings(socks)
+	return socks, nil
+}
+
+// Watch subscribes to device events until ctx is canceled.
+func (w *watcher) Watch(ctx context.Context) (<-chan wginternal.Event, error) {
+	s := &subscription{
+		ctx:  ctx,
+		c:    make(chan wginternal.Event, 16),
+		wake: make(chan struct{}, 1),
+	}
+
+	w.subMu.Lock()
+	w.subs[s] = struct{}{}
+	w.subMu.Unlock()
+
+	w.subWG.Add(1)
+	go func() {
+		defer w.subWG.Done()
+		w.deliver(s)
+
+		w.subMu.Lock()
+		delete(w.subs, s)
+		w.subMu.Unlock()
+
+		close(s.c)
+	}()
+
+	return s.c, nil
+}
+
+// deliver sends queued events to s until its context is canceled or the
+// watcher is closed.
+func (w *watcher) deliver(s *subscription) {
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+
+			select {
+			case <-s.wake:
+				continue
+			case <-s.ctx.Done():
+				return
+			case <-w.done:
+				return
+			}
+		}
+
+		ev := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		select {
+		case s.c <- ev:
+		case <-s.ctx.Done():
+			return
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Forget removes a stale device socket from the list of known sockets.
+func (w *watcher) Forget(sock string) {
+	w.mu.Lock()
+	evs := w.remove(sock)
+	w.mu.Unlock()
+
+	w.notify(evs)
+}
+
+// loop processes inotify events until the watcher is closed.
+func (w *watcher) loop() {
+	defer close(w.done)
+
+	b := make([]byte, 4096)
+	for {
+		n, err := w.f.Read(b)
+		if err != nil {
+			return
+		}
+
+		w.mu.Lock()
+		evs := w.handle(b[:n])
+		w.mu.Unlock()
+
+		w.notify(evs)
+	}
+}
+
+// handle processes a buffer of inotify events and returns any resulting
+// device events. The caller must hold w.mu.
+func (w *watcher) handle(b []byte) []wginternal.Event {
+	var evs []wginternal.Event
+	for len(b) >= unix.SizeofInotifyEvent {
+		ie := (*unix.InotifyEvent)(unsafe.Pointer(&b[0]))
+		end := unix.SizeofInotifyEvent + int(ie.Len)
+		if end > len(b) {
+			// Truncated event; should never happen.
+			break
+		}
+
+		name := string(bytes.TrimRight(b[unix.SizeofInotifyEvent:end], "\x00"))
+		b = b[end:]
+
+		if ie.Mask&unix.IN_Q_OVERFLOW != 0 {
+			// Events were dropped; rescan everything.
+			for _, d := range w.dirs {
+				evs = append(evs, w.scan(d)...)
+			}
+			continue
+		}
+
+		wd := int(ie.Wd)
+		if dir, ok := w.dirs[wd]; ok {
+			evs = append(evs, w.handleDir(wd, dir, name, ie.Mask)...)
+			continue
+		}
+
+		if ie.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+			evs = append(evs, w.handleParent(wd, name)...)
+		}
+	}
+
+	return evs
+}
+
+// handleParent processes the creation of name in the parent of one or more
+// socket directories which do not exist yet.
+func (w *watcher) handleParent(wd int, name string) []wginternal.Event {
+	var (
+		evs     []wginternal.Event
+		pending []string
+	)
+
+	for _, dir := range w.parents[wd] {
+		if filepath.Base(dir) != name {
+			pending = append(pending, dir)
+			continue
+		}
+
+		// The socket directory we are waiting for has been created.
+		if ok, err := w.addDir(dir); err == nil && ok {
+			evs = append(evs, w.scan(dir)...)
+		}
+	}
+
+	if len(pending) > 0 {
+		w.parents[wd] = pending
+		return evs
+	}
+
+	// Nothing left to wait for in this parent.
+	delete(w.parents, wd)
+	_, _ = unix.InotifyRmWatch(w.fd, uint32(wd))
+
+	return evs
+}
+
+// handleDir processes an inotify event for a socket directory.
+func (w *watcher) handleDir(wd int, dir, name string, mask uint32) []wginternal.Event {
+	switch {
+	case mask&(unix.IN_DELETE_SELF|unix.IN_MOVE_SELF) != 0:
+		// The directory itself is gone, and so are all of its sockets. Wait
+		// for it to be created again.
+		_, _ = unix.InotifyRmWatch(w.fd, uint32(wd))
+		fallthrough
+	case mask&unix.IN_IGNORED != 0:
+		delete(w.dirs, wd)
+
+		var evs []wginternal.Event
+		for s := range w.socks {
+			if filepath.Dir(s) == dir {
+				evs = append(evs, w.remove(s)...)
+			}
+		}
+
+		// The directory may have been recreated already.
+		if ok, err := w.addDir(dir); err == nil && ok {
+			evs = append(evs, w.scan(dir)...)
+		}
+
+		return evs
+	case mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+		sock := filepath.Join(dir, name)
+		fi, err := os.Lstat(sock)
+		if err != nil || fi.Mode()&os.ModeSocket == 0 {
+			return nil
+		}
+
+		// The listener may not be accepting connections yet, so don't probe
+		// the new socket; dialDevice reports it if it turns out to be stale.
+		return w.add(sock)
+	case mask&(unix.IN_DELETE|unix.IN_MOVED_FROM) != 0:
+		return w.remove(filepath.Join(dir, name))
+	}
+
+	return nil
+}
+
+// addDir begins watching dir for sockets and reports whether dir is being
+// watched. If dir does not exist, its parent is watched instead until dir is
+// created. The caller must hold w.mu or have exclusive access to w.
+func (w *watcher) addDir(dir string) (bool, error) {
+	wd, err := unix.InotifyAddWatch(w.fd, dir, dirMask)
+	switch err {
+	case nil:
+		w.dirs[wd] = dir
+		return true, nil
+	case unix.ENOENT, unix.ENOTDIR:
+	default:
+		return false, os.NewSyscallError("inotify_add_watch", err)
+	}
+
+	// If the parent doesn't exist either, there's nothing more we can do.
+	wd, err = unix.InotifyAddWatch(w.fd, filepath.Dir(dir), parentMask)
+	switch err {
+	case nil:
+		w.parents[wd] = append(w.parents[wd], dir)
+		return false, nil
+	case unix.ENOENT, unix.ENOTDIR:
+		return false, nil
+	default:
+		return false, os.NewSyscallError("inotify_add_watch", err)
+	}
+}
+
+// scan reconciles the known sockets in dir with its current contents,
+// ignoring any stale sockets. The caller must hold w.mu or have exclusive
+// access to w.
+func (w *watcher) scan(dir string) []wginternal.Event {
+	// Treat a missing or unreadable directory as empty.
+	socks, _ := findUNIXSockets([]string{dir})
+
+	seen := make(map[string]struct{}, len(socks))
+	var evs []wginternal.Event
+	for _, s := range socks {
+		if w.stale(s) {
+			continue
+		}
+
+		seen[s] = struct{}{}
+		evs = append(evs, w.add(s)...)
+	}
+
+	for s := range w.socks {
+		if _, ok := seen[s]; !ok && filepath.Dir(s) == dir {
+			evs = append(evs, w.remove(s)...)
+		}
+	}
+
+	return evs
+}
+
+// stale reports whether nothing is listening on sock.
+func (w *watcher) stale(sock string) bool {
+	c, err := w.dial(sock)
+	if err != nil {
+		return errors.Is(err, syscall.ECONNREFUSED)
+	}
+
+	_ = c.Close()
+	return false
+}
+
+// add adds sock to the known sockets. The caller must hold w.mu.
+func (w *watcher) add(sock string) []wginternal.Event {
+	if _, ok := w.socks[sock]; ok {
+		return nil
+	}
+
+	w.socks[sock] = struct{}{}
+	return []wginternal.Event{event(sock, wginternal.EventAppeared)}
+}
+
+// remove removes sock from the known sockets. The caller must hold w.mu.
+func (w *watcher) remove(sock string) []wginternal.Event {
+	if _, ok := w.socks[sock]; !ok {
+		return nil
+	}
+
+	delete(w.socks, sock)
+	return []wginternal.Event{event(sock, wginternal.EventDisappeared)}
+}
+
+// notify queues evs for all subscribers. notify never blocks, so it is safe
+// to call while dialing a device.
+func (w *watcher) notify(evs []wginternal.Event) {
+	if len(evs) == 0 {
+		return
+	}
+
+	w.subMu.Lock()
+	defer w.subMu.Unlock()
+
+	for s := range w.subs {
+		s.mu.Lock()
+		s.queue = append(s.queue, evs...)
+		s.mu.Unlock()
+
+		select {
+		case s.wake <- struct{}{}:
+		default:
+			// A wakeup is already pending.
+		}
+	}
+}
+
+// event produces an Event for the device socket sock.
+func event(sock string, op wginternal.EventOp) wginternal.Event {
+	return wginternal.Event{
+		Name: deviceName(sock),
+		Type: wgtypes.Userspace,
+		Op:   op,
+	}
+}
@@ -0,0 +1,309 @@
+//+build linux
+
+package wguser
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestLinux_watcherEvents(t *testing.T) {
+	tmp, err := ioutil.TempDir(os.TempDir(), "wguser-watch")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// Watch a socket directory which does not exist yet.
+	dir := filepath.Join(tmp, "wireguard")
+	w, err := newWatcher([]string{dir}, dial)
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := w.Watch(ctx)
+	if err != nil {
+		t.Fatalf("failed to watch: %v", err)
+	}
+
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatalf("failed to create socket directory: %v", err)
+	}
+
+	// Give the watcher a chance to notice the new directory before creating
+	// a socket; otherwise the socket is found by the directory scan.
+	waitFor(t, func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return len(w.dirs) == 1
+	})
+
+	sock := filepath.Join(dir, testDevice+".sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	if diff := cmp.Diff(event(sock, wginternal.EventAppeared), nextEvent(t, events)); diff != "" {
+		t.Fatalf("unexpected appeared event (-want +got):\n%s", diff)
+	}
+
+	socks, err := w.Find()
+	if err != nil {
+		t.Fatalf("failed to find sockets: %v", err)
+	}
+
+	if diff := cmp.Diff([]string{sock}, socks); diff != "" {
+		t.Fatalf("unexpected sockets (-want +got):\n%s", diff)
+	}
+
+	// Closing the listener removes the socket file.
+	_ = l.Close()
+
+	want := wginternal.Event{
+		Name: testDevice,
+		Type: wgtypes.Userspace,
+		Op:   wginternal.EventDisappeared,
+	}
+
+	if diff := cmp.Diff(want, nextEvent(t, events)); diff != "" {
+		t.Fatalf("unexpected disappeared event (-want +got):\n%s", diff)
+	}
+
+	cancel()
+	for range events {
+		// Wait for the channel to be closed.
+	}
+}
+
+func TestLinux_watcherStale(t *testing.T) {
+	tmp, err := ioutil.TempDir(os.TempDir(), "wguser-watch")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// Leave a socket file behind with nothing listening on it, as a crashed
+	// userspace implementation would.
+	stale := filepath.Join(tmp, "wgstale0.sock")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: stale, Net: "unix"})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	l.SetUnlinkOnClose(false)
+	_ = l.Close()
+
+	live, err := net.Listen("unix", filepath.Join(tmp, testDevice+".sock"))
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer live.Close()
+
+	w, err := newWatcher([]string{tmp}, dial)
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+	defer w.Close()
+
+	c := &Client{
+		dial:   dial,
+		find:   w.Find,
+		forget: w.Forget,
+	}
+
+	socks, err := c.find()
+	if err != nil {
+		t.Fatalf("failed to find sockets: %v", err)
+	}
+
+	if diff := cmp.Diff([]string{live.Addr().String()}, socks); diff != "" {
+		t.Fatalf("unexpected sockets (-want +got):\n%s", diff)
+	}
+
+	// A socket which goes stale after discovery is forgotten on dial.
+	w.mu.Lock()
+	w.add(stale)
+	w.mu.Unlock()
+
+	if _, err := c.dialDevice(stale); !os.IsNotExist(err) {
+		t.Fatalf("expected is not exist error, but got: %v", err)
+	}
+
+	socks, err = c.find()
+	if err != nil {
+		t.Fatalf("failed to find sockets: %v", err)
+	}
+
+	if diff := cmp.Diff([]string{live.Addr().String()}, socks); diff != "" {
+		t.Fatalf("unexpected sockets after dial (-want +got):\n%s", diff)
+	}
+}
+
+func TestLinux_watcherProbePolicy(t *testing.T) {
+	tmp, err := ioutil.TempDir(os.TempDir(), "wguser-watch")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	l, err := net.Listen("unix", filepath.Join(tmp, testDevice+".sock"))
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	// Any process could have replaced a world-writable socket.
+	if err := os.Chmod(l.Addr().String(), 0777); err != nil {
+		t.Fatalf("failed to change socket mode: %v", err)
+	}
+
+	var dials int
+	c := &Client{
+		dial: func(device string) (net.Conn, error) {
+			dials++
+			return dial(device)
+		},
+		policy: &Policy{},
+	}
+
+	w, err := newWatcher([]string{tmp}, c.probe)
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+	defer w.Close()
+
+	if dials != 0 {
+		t.Fatalf("untrusted socket was dialed %d times", dials)
+	}
+
+	// The socket is still tracked, and refused when the device is dialed.
+	socks, err := w.Find()
+	if err != nil {
+		t.Fatalf("failed to find sockets: %v", err)
+	}
+
+	if diff := cmp.Diff([]string{l.Addr().String()}, socks); diff != "" {
+		t.Fatalf("unexpected sockets (-want +got):\n%s", diff)
+	}
+}
+
+func TestLinux_watcherSlowSubscriber(t *testing.T) {
+	tmp, err := ioutil.TempDir(os.TempDir(), "wguser-watch")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	w, err := newWatcher([]string{tmp}, dial)
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+
+	// Subscribe but never read or cancel.
+	events, err := w.Watch(context.Background())
+	if err != nil {
+		t.Fatalf("failed to watch: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		// Far more events than the subscription's channel can buffer.
+		for i := 0; i < 100; i++ {
+			sock := filepath.Join(tmp, testDevice+".sock")
+
+			w.mu.Lock()
+			evs := w.add(sock)
+			w.mu.Unlock()
+
+			w.notify(evs)
+			w.Forget(sock)
+		}
+
+		_ = w.Close()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watcher blocked on a subscriber which is not reading")
+	}
+
+	// The channel is closed once its buffered events are drained.
+	for range events {
+	}
+}
+
+func TestLinux_watcherLazy(t *testing.T) {
+	var scans int
+	lw := &lazyWatcher{
+		scan: func() ([]string, error) {
+			scans++
+			return nil, nil
+		},
+		dial: dial,
+	}
+	defer lw.Close()
+
+	// Until Watch is called, devices are found by scanning.
+	if _, err := lw.Find(); err != nil {
+		t.Fatalf("failed to find sockets: %v", err)
+	}
+	if lw.get() != nil || scans != 1 {
+		t.Fatal("watcher was started before Watch was called")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := lw.Watch(ctx); err != nil {
+		t.Fatalf("failed to watch: %v", err)
+	}
+
+	if _, err := lw.Find(); err != nil {
+		t.Fatalf("failed to find sockets: %v", err)
+	}
+	if lw.get() == nil || scans != 1 {
+		t.Fatal("watcher was not started by Watch")
+	}
+}
+
+func nextEvent(t *testing.T, events <-chan wginternal.Event) wginternal.Event {
+	t.Helper()
+
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+		return wginternal.Event{}
+	}
+}
+
+func waitFor(t *testing.T, fn func() bool) {
+	t.Helper()
+
+	for i := 0; i < 500; i++ {
+		if fn() {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("timed out waiting for condition")
+}
@@ -0,0 +1,7 @@
+//+build !linux
+
+package wguser
+
+// initWatcher is a no-op on systems which cannot notify us of userspace
+// devices appearing and disappearing; c scans for devices on each call.
+func initWatcher(_ *Client) {}
@@ -0,0 +1,262 @@
+package wgctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// defaultLockTimeout bounds how long methods which lock a device implicitly
+// wait for it when LockOptions.Timeout is zero.
+const defaultLockTimeout = 30 * time.Second
+
+// ErrDeviceLocked indicates that a device could not be configured because the
+// Client itself holds a lock on it, acquired using Client.Lock. Use errors.Is
+// to check for this error.
+var ErrDeviceLocked = errors.New("wgctrl: device is locked by this Client")
+
+// LockOptions configure the advisory locking of devices by a Client.
+type LockOptions struct {
+	// Dir is the directory containing a lock file for each device, which is
+	// created if it does not exist. If empty, /run/wgctrl is used, or
+	// %ProgramData%\wgctrl on Windows.
+	Dir string
+
+	// Timeout bounds how long a Client waits to lock a device. If zero, Lock
+	// waits until the device is unlocked or its context is canceled, and
+	// methods which configure a device wait for at most 30 seconds.
+	Timeout time.Duration
+}
+
+// dir returns the directory containing lock files.
+func (o *LockOptions) dir() string {
+	if o == nil || o.Dir == "" {
+		return defaultLockDir()
+	}
+
+	return o.Dir
+}
+
+// timeout returns the lock timeout, or 0 for none.
+func (o *LockOptions) timeout() time.Duration {
+	if o == nil {
+		return 0
+	}
+
+	return o.Timeout
+}
+
+// A DeviceLock is an exclusive advisory lock on a device, acquired using
+// Client.Lock. While a device is locked, other Clients which lock devices,
+// including those in other processes, cannot configure it.
+type DeviceLock struct {
+	c    *Client
+	name string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// Lock acquires an exclusive advisory lock on the device specified by name,
+// waiting until it is available, ctx is canceled, or the timeout set by
+// Options.Lock expires. The lock is held until Unlock is called.
+//
+// Lock is intended for read-modify-write sequences, which must use the
+// methods of the DeviceLock to retrieve and configure the device: if locking
+// is enabled by Options.Lock, methods of the Client which configure a device
+// return an error which can be checked using errors.Is and ErrDeviceLocked
+// while the Client holds the lock, rather than deadlocking the goroutine
+// which holds it.
+//
+// Each device is locked using flock(2) on a lock file named after the device,
+// or LockFileEx on Windows. The lock only excludes other Clients which lock
+// the same device, and is released if the process exits.
+func (c *Client) Lock(ctx context.Context, name string) (*DeviceLock, error) {
+	if t := c.lock.timeout(); t > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t)
+		defer cancel()
+	}
+
+	f, err := c.lockFile(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.hold(name, 1)
+	return &DeviceLock{c: c, name: name, f: f}, nil
+}
+
+// lockFile locks the lock file for the device specified by name, waiting until
+// it is available or ctx is canceled. Closing the returned file releases the
+// lock.
+func (c *Client) lockFile(ctx context.Context, name string) (*os.File, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return nil, fmt.Errorf("wgctrl: invalid device name for lock: %q", name)
+	}
+
+	dir := c.lock.dir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, name+".lock"), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	// Poll for the lock so that waiting can be interrupted by ctx.
+	delay := time.Millisecond
+	for {
+		ok, err := tryLock(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("wgctrl: failed to lock device %q: %v", name, err)
+		}
+		if ok {
+			return f, nil
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			_ = f.Close()
+			return nil, fmt.Errorf("wgctrl: failed to lock device %q: %w", name, ctx.Err())
+		case <-t.C:
+		}
+
+		if delay < 100*time.Millisecond {
+			delay *= 2
+		}
+	}
+}
+
+// Device retrieves the locked device, as with Client.Device.
+func (l *DeviceLock) Device() (*wgtypes.Device, error) {
+	return l.c.Device(l.name)
+}
+
+// ConfigureDevice configures the locked device, as with
+// Client.ConfigureDevice. An error is returned if the lock was released.
+func (l *DeviceLock) ConfigureDevice(cfg wgtypes.Config) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.f == nil {
+		return fmt.Errorf("wgctrl: device %q is not locked", l.name)
+	}
+
+	return l.c.configureDevice(l.name, cfg)
+}
+
+// Unlock releases the lock. Calling Unlock more than once has no effect.
+func (l *DeviceLock) Unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.f == nil {
+		return nil
+	}
+
+	// Closing the lock file releases the lock. The file itself is left in
+	// place, as removing it could allow two Clients to lock different files
+	// for the same device.
+	err := l.f.Close()
+	l.f = nil
+	l.c.hold(l.name, -1)
+	return err
+}
+
+// hold adjusts the number of locks held on the device specified by name by
+// this Client.
+func (c *Client) hold(name string, n int) {
+	c.heldMu.Lock()
+	defer c.heldMu.Unlock()
+
+	if c.held == nil {
+		c.held = make(map[string]int)
+	}
+
+	c.held[name] += n
+	if c.held[name] <= 0 {
+		delete(c.held, name)
+	}
+}
+
+// holds reports whether this Client holds a lock on the device specified by
+// name.
+func (c *Client) holds(name string) bool {
+	c.heldMu.Lock()
+	defer c.heldMu.Unlock()
+
+	return c.held[name] > 0
+}
+
+// withLock calls fn while holding the lock for the device specified by name,
+// if locking is enabled by Options.Lock. Concurrent calls for the same device
+// wait for each other. An error is returned if the lock is held by this
+// Client using Lock, or cannot be acquired before the lock timeout.
+func (c *Client) withLock(name string, fn func() error) error {
+	if c.lock == nil {
+		return fn()
+	}
+
+	if c.holds(name) {
+		return fmt.Errorf("wgctrl: failed to lock device %q: %w", name, ErrDeviceLocked)
+	}
+
+	timeout := c.lock.timeout()
+	if timeout == 0 {
+		timeout = defaultLockTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	sem := c.implicitLock(name)
+	select {
+	case sem <- struct{}{}:
+	case <-ctx.Done():
+		return fmt.Errorf("wgctrl: failed to lock device %q: %w", name, ctx.Err())
+	}
+	defer func() { <-sem }()
+
+	f, err := c.lockFile(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// implicitLock returns the semaphore which serializes implicit locks on the
+// device specified by name.
+func (c *Client) implicitLock(name string) chan struct{} {
+	c.implicitMu.Lock()
+	defer c.implicitMu.Unlock()
+
+	if c.implicit == nil {
+		c.implicit = make(map[string]chan struct{})
+	}
+
+	sem, ok := c.implicit[name]
+	if !ok {
+		sem = make(chan struct{}, 1)
+		c.implicit[name] = sem
+	}
+
+	return sem
+}
@@ -0,0 +1,137 @@
+package wgctrl
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestClientLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wgctrl-lock")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := wgtest.NewMemClient(&wgtypes.Device{Name: "wg0"})
+	c := &Client{
+		cs: []wginternal.Client{m},
+		lock: &LockOptions{
+			Dir:     dir,
+			Timeout: 50 * time.Millisecond,
+		},
+	}
+
+	l, err := c.Lock(context.Background(), "wg0")
+	if err != nil {
+		t.Fatalf("failed to lock device: %v", err)
+	}
+
+	// Locks on other devices are independent.
+	l1, err := c.Lock(context.Background(), "wg1")
+	if err != nil {
+		t.Fatalf("failed to lock other device: %v", err)
+	}
+	_ = l1.Unlock()
+
+	cfg := wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: wgtest.MustPublicKey()}}}
+
+	// Configuration through the Client must not deadlock while the Client
+	// holds the lock, and through the lock must succeed.
+	if err := c.ConfigureDevice("wg0", cfg); !errors.Is(err, ErrDeviceLocked) {
+		t.Fatalf("expected device locked, but got: %v", err)
+	}
+
+	// Another Client must wait for the lock.
+	c2 := &Client{cs: c.cs, lock: c.lock}
+	if err := c2.ConfigureDevice("wg0", cfg); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, but got: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Lock(ctx, "wg0"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, but got: %v", err)
+	}
+
+	if err := l.ConfigureDevice(cfg); err != nil {
+		t.Fatalf("failed to configure locked device: %v", err)
+	}
+
+	if err := l.Unlock(); err != nil {
+		t.Fatalf("failed to unlock device: %v", err)
+	}
+	if err := l.Unlock(); err != nil {
+		t.Fatalf("failed to unlock device twice: %v", err)
+	}
+	if err := l.ConfigureDevice(cfg); err == nil {
+		t.Fatal("expected an error configuring an unlocked device")
+	}
+
+	if err := c.ConfigureDevice("wg0", cfg); err != nil {
+		t.Fatalf("failed to configure unlocked device: %v", err)
+	}
+
+	if _, err := c.Lock(context.Background(), "../wg0"); err == nil {
+		t.Fatal("expected an error for an invalid device name")
+	}
+}
+
+func TestClientLockConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wgctrl-lock")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := wgtest.NewMemClient(&wgtypes.Device{Name: "wg0"})
+	c := &Client{
+		cs:   []wginternal.Client{slowClient{m}},
+		lock: &LockOptions{Dir: dir},
+	}
+
+	// Concurrent configurations through the same Client lock the device
+	// implicitly, and must wait for each other rather than fail.
+	const n = 10
+	errC := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			errC <- c.ConfigureDevice("wg0", wgtypes.Config{
+				Peers: []wgtypes.PeerConfig{{PublicKey: wgtest.MustPublicKey()}},
+			})
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		if err := <-errC; err != nil {
+			t.Fatalf("failed to configure device: %v", err)
+		}
+	}
+
+	d, err := c.Device("wg0")
+	if err != nil {
+		t.Fatalf("failed to get device: %v", err)
+	}
+
+	if len(d.Peers) != n {
+		t.Fatalf("expected %d peers, but got %d", n, len(d.Peers))
+	}
+}
+
+// A slowClient is a wgtest.MemClient which takes a while to configure its
+// device, so that concurrent configurations overlap.
+type slowClient struct {
+	*wgtest.MemClient
+}
+
+func (c slowClient) ConfigureDevice(name string, cfg wgtypes.Config) error {
+	time.Sleep(5 * time.Millisecond)
+	return c.MemClient.ConfigureDevice(name, cfg)
+}
@@ -0,0 +1,24 @@
+//+build !windows
+
+package wgctrl
+
+import (
+	"os"
+	"syscall"
+)
+
+// defaultLockDir returns the default directory for lock files.
+func defaultLockDir() string { return "/run/wgctrl" }
+
+// tryLock attempts to acquire an exclusive lock on f without blocking.
+func tryLock(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	switch err {
+	case nil:
+		return true, nil
+	case syscall.EWOULDBLOCK:
+		return false, nil
+	default:
+		return false, err
+	}
+}
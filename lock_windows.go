@@ -0,0 +1,32 @@
+//+build windows
+
+package wgctrl
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// defaultLockDir returns the default directory for lock files.
+func defaultLockDir() string {
+	return filepath.Join(os.Getenv("ProgramData"), "wgctrl")
+}
+
+// tryLock attempts to acquire an exclusive lock on f without blocking.
+func tryLock(f *os.File) (bool, error) {
+	err := windows.LockFileEx(
+		windows.Handle(f.Fd()),
+		windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY,
+		0, 1, 0, new(windows.Overlapped),
+	)
+	switch err {
+	case nil:
+		return true, nil
+	case windows.ERROR_LOCK_VIOLATION:
+		return false, nil
+	default:
+		return false, err
+	}
+}
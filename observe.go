@@ -0,0 +1,54 @@
+package wgctrl
+
+import "time"
+
+// An Observer is notified as each operation performed by a Client against a
+// device starts and ends, and can be used to produce tracing spans or
+// metrics. A single Client call may perform several operations, such as a
+// dial and a get for each device returned by Devices.
+//
+// The same *Operation is passed to OperationStart and OperationEnd, so it may
+// be used as a key to correlate the two calls. Its result fields are only set
+// when OperationEnd is called. An Observer must be safe for concurrent use and
+// should return quickly, as it is called synchronously.
+//
+// Currently, Linux kernel and userspace devices report operations, including
+// embedded devices.
+type Observer interface {
+	OperationStart(op *Operation)
+	OperationEnd(op *Operation)
+}
+
+// An Operation describes a single operation performed against a device.
+type Operation struct {
+	// Backend identifies the device backend: "wglinux" for Linux kernel
+	// devices, or "wguser" for userspace and embedded devices.
+	Backend string
+
+	// Operation is "get" when retrieving a device, "set" when configuring
+	// one, or "dial" when connecting to a userspace device.
+	Operation string
+
+	// Device is the name of the device.
+	Device string
+
+	// Start is the time at which the operation started, and Duration is how
+	// long it took.
+	Start    time.Time
+	Duration time.Duration
+
+	// Messages is the number of request messages sent to the device. Batches
+	// is the number of batches a configuration was split into; large
+	// configurations for Linux kernel devices require several netlink
+	// messages.
+	Messages int
+	Batches  int
+
+	// BytesSent and BytesReceived are the sizes of the messages exchanged
+	// with the device.
+	BytesSent     int
+	BytesReceived int
+
+	// Err is the error returned by the operation, if any.
+	Err error
+}
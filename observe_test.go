@@ -0,0 +1,108 @@
+package wgctrl_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestClientObserver(t *testing.T) {
+	var o testObserver
+	c, err := wgctrl.NewWithOptions(&wgctrl.Options{
+		EmbeddedOnly: true,
+		Observer:     &o,
+	})
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer c.Close()
+
+	const name = "wgobservetest0"
+	ed, err := c.CreateEmbeddedDevice(name, nil)
+	if err != nil {
+		t.Fatalf("failed to create embedded device: %v", err)
+	}
+	defer ed.Close()
+
+	var (
+		priv = wgtest.MustPrivateKey()
+		port = 0
+	)
+
+	if err := c.ConfigureDevice(name, wgtypes.Config{
+		PrivateKey: &priv,
+		ListenPort: &port,
+	}); err != nil {
+		t.Fatalf("failed to configure device: %v", err)
+	}
+
+	if _, err := c.Device(name); err != nil {
+		t.Fatalf("failed to get device: %v", err)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	type result struct {
+		Backend, Operation, Device string
+		Batches                    int
+	}
+
+	var got []result
+	for i, op := range o.ended {
+		if op != o.started[i] {
+			t.Fatalf("operation %d ended out of order", i)
+		}
+		if op.Err != nil {
+			t.Fatalf("operation %d returned an error: %v", i, op.Err)
+		}
+
+		if op.Operation != "dial" && (op.Messages != 1 || op.BytesSent == 0 || op.BytesReceived == 0) {
+			t.Fatalf("unexpected messages for operation %d: %+v", i, op)
+		}
+
+		got = append(got, result{
+			Backend:   op.Backend,
+			Operation: op.Operation,
+			Device:    op.Device,
+			Batches:   op.Batches,
+		})
+	}
+
+	want := []result{
+		{Backend: "wguser", Operation: "dial", Device: name},
+		{Backend: "wguser", Operation: "set", Device: name, Batches: 1},
+		{Backend: "wguser", Operation: "dial", Device: name},
+		{Backend: "wguser", Operation: "get", Device: name},
+	}
+
+	if diff := cmp.Diff(len(o.started), len(o.ended)); diff != "" {
+		t.Fatalf("unexpected number of ended operations (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected operations (-want +got):\n%s", diff)
+	}
+}
+
+// A testObserver records operations in the order they start and end.
+type testObserver struct {
+	mu             sync.Mutex
+	started, ended []*wgctrl.Operation
+}
+
+func (o *testObserver) OperationStart(op *wgctrl.Operation) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.started = append(o.started, op)
+}
+
+func (o *testObserver) OperationEnd(op *wgctrl.Operation) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.ended = append(o.ended, op)
+}
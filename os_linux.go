@@ -8,13 +8,22 @@ import (
 	"golang.zx2c4.com/wireguard/wgctrl/internal/wguser"
 )
 
+// linuxConfig produces the configuration for the Linux kernel backend.
+func (o *Options) linuxConfig() *wglinux.Config {
+	return &wglinux.Config{
+		Trace:       o.tracer(),
+		Observer:    o.observer(),
+		Concurrency: o.concurrency(),
+	}
+}
+
 // newClients configures wginternal.Clients for Linux systems.
-func newClients() ([]wginternal.Client, error) {
+func newClients(opts *Options) ([]wginternal.Client, error) {
 	var clients []wginternal.Client
 
 	// Linux has an in-kernel WireGuard implementation. Determine if it is
 	// available and make use of it if so.
-	kc, ok, err := wglinux.New()
+	kc, ok, err := wglinux.New(opts.linuxConfig())
 	if err != nil {
 		return nil, err
 	}
@@ -24,7 +33,7 @@ func newClients() ([]wginternal.Client, error) {
 
 	// Although it isn't recommended to use userspace implementations on Linux,
 	// it can be used. We make use of it in integration tests as well.
-	uc, err := wguser.New()
+	uc, err := wguser.New(opts.userConfig())
 	if err != nil {
 		return nil, err
 	}
@@ -33,3 +42,12 @@ func newClients() ([]wginternal.Client, error) {
 	clients = append(clients, uc)
 	return clients, nil
 }
+
+// newReplayClients configures wginternal.Clients which replay exs on Linux
+// systems.
+func newReplayClients(exs []wginternal.Exchange) ([]wginternal.Client, error) {
+	return []wginternal.Client{
+		wglinux.NewReplay(exs),
+		wguser.NewReplay(exs),
+	}, nil
+}
@@ -9,7 +9,7 @@ import (
 )
 
 // newClients configures wginternal.Clients for OpenBSD systems.
-func newClients() ([]wginternal.Client, error) {
+func newClients(opts *Options) ([]wginternal.Client, error) {
 	var clients []wginternal.Client
 
 	// OpenBSD has an experimental in-kernel WireGuard implementation:
@@ -23,7 +23,7 @@ func newClients() ([]wginternal.Client, error) {
 		clients = append(clients, kc)
 	}
 
-	uc, err := wguser.New()
+	uc, err := wguser.New(opts.userConfig())
 	if err != nil {
 		return nil, err
 	}
@@ -31,3 +31,9 @@ func newClients() ([]wginternal.Client, error) {
 	clients = append(clients, uc)
 	return clients, nil
 }
+
+// newReplayClients configures wginternal.Clients which replay exs. Only
+// userspace exchanges can be replayed on this system.
+func newReplayClients(exs []wginternal.Exchange) ([]wginternal.Client, error) {
+	return []wginternal.Client{wguser.NewReplay(exs)}, nil
+}
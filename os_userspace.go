@@ -9,11 +9,17 @@ import (
 
 // newClients configures wginternal.Clients for systems which only support
 // userspace WireGuard implementations.
-func newClients() ([]wginternal.Client, error) {
-	c, err := wguser.New()
+func newClients(opts *Options) ([]wginternal.Client, error) {
+	c, err := wguser.New(opts.userConfig())
 	if err != nil {
 		return nil, err
 	}
 
 	return []wginternal.Client{c}, nil
 }
+
+// newReplayClients configures wginternal.Clients which replay exs. Only
+// userspace exchanges can be replayed on this system.
+func newReplayClients(exs []wginternal.Exchange) ([]wginternal.Client, error) {
+	return []wginternal.Client{wguser.NewReplay(exs)}, nil
+}
@@ -0,0 +1,46 @@
+package wgctrl
+
+import (
+	"os"
+
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+)
+
+// ErrUntrustedSocket indicates that a userspace device socket was refused
+// because it does not satisfy a Client's SocketPolicy. Use errors.Is to check
+// for this error.
+var ErrUntrustedSocket = wginternal.ErrUntrustedSocket
+
+// A SocketPolicy specifies which userspace WireGuard device sockets a Client
+// trusts. Because configuring a device sends its private key to the device,
+// any process which can create a socket in the userspace device directory
+// could otherwise harvest keys.
+//
+// The owner and mode of a device socket are checked before it is dialed.
+// Because the socket is dialed separately, a process which can write to the
+// socket directory could replace the socket between the check and the dial.
+// On Linux, the credentials of the listening process are therefore always
+// verified as well, using SO_PEERCRED, which closes this race. On other
+// UNIX-like systems, the owner and mode checks alone are subject to it. On
+// Windows, device named pipes are already restricted to Administrators and
+// the policy is not checked.
+type SocketPolicy struct {
+	// UIDs are the user IDs permitted to own a device socket. If empty, only
+	// root and the effective user ID of this process are permitted.
+	UIDs []int
+
+	// GIDs are the group IDs permitted to own a device socket. If empty, the
+	// owning group is not checked.
+	GIDs []int
+
+	// ForbiddenMode specifies permission bits which must not be set on a
+	// device socket. If zero, sockets writable by group or others are refused.
+	ForbiddenMode os.FileMode
+
+	// VerifyPeer specifies that the process listening on a device socket must
+	// also run as a permitted user and group, as reported by SO_PEERCRED.
+	// Peer credentials are always verified on Linux, where VerifyPeer has no
+	// effect. VerifyPeer is not supported on other UNIX-like systems, where
+	// all sockets are refused when it is set.
+	VerifyPeer bool
+}
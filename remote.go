@@ -0,0 +1,56 @@
+package wgctrl
+
+import (
+	"net/http"
+
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgremote"
+)
+
+// RemoteOptions specify a remote host whose devices are controlled by a
+// Client, using the HTTP API served by package wgserver.
+//
+// The devices of a remote host are named by its Name, a slash, and the name
+// of the device on the remote host, such as "host/wg0". Devices on the remote
+// host are listed by Devices, and can be retrieved and configured like any
+// local device.
+type RemoteOptions struct {
+	// Name is the name of the remote host, which must not be empty or
+	// contain a slash.
+	Name string
+
+	// URL is the base URL of the remote host's API, such as
+	// "https://host:8080", or the path of a UNIX socket prefixed by "unix:",
+	// such as "unix:/run/wgctrl.sock".
+	URL string
+
+	// Token, if not empty, is sent as a bearer token with each request.
+	Token string
+
+	// HTTPClient, if not nil, performs requests to the remote host, and can
+	// be used to configure TLS or timeouts. It cannot be set when URL refers
+	// to a UNIX socket.
+	HTTPClient *http.Client
+}
+
+// remoteClients produces a backend for each remote host in opts.
+func remoteClients(opts *Options) ([]wginternal.Client, error) {
+	var cs []wginternal.Client
+	for _, r := range opts.Remotes {
+		c, err := wgremote.New(&wgremote.Config{
+			Name:       r.Name,
+			URL:        r.URL,
+			Token:      r.Token,
+			HTTPClient: r.HTTPClient,
+			Observer:   opts.observer(),
+		})
+		if err != nil {
+			closeClients(cs)
+			return nil, err
+		}
+
+		cs = append(cs, c)
+	}
+
+	return cs, nil
+}
@@ -0,0 +1,171 @@
+package wgctrl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgstate"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// ErrPrivateKeyMismatch indicates that Restore refused to configure a device
+// whose private key differs from the saved private key. Use errors.Is to check
+// for this error.
+var ErrPrivateKeyMismatch = errors.New("wgctrl: device private key differs from saved private key")
+
+// ErrKeysRedacted indicates that an operation which needs a device's private
+// or preshared keys was refused because the backend withheld them, as
+// reported by wgtypes.Device.KeysRedacted. Use errors.Is to check for this
+// error.
+var ErrKeysRedacted = errors.New("wgctrl: device keys are redacted")
+
+// stateVersion is the current version of the saved state file format.
+const stateVersion = 1
+
+// A savedState is the on-disk format of the devices written by Save.
+type savedState struct {
+	Version int                  `json:"version"`
+	Devices []wgstate.DeviceFile `json:"devices"`
+}
+
+// Save writes the configuration of the devices specified by names, or of all
+// devices if names is empty, to the file at path, so that it can be restored
+// using Restore, such as after a reboot. Statistics and handshakes are not
+// saved.
+//
+// The file contains private and preshared keys, so it is created with
+// permissions 0600. It is written atomically: the file at path is replaced
+// only once all devices have been written, so a crash does not leave a
+// partially written file in its place. Devices whose keys are redacted by
+// their backend cannot be saved, and ErrKeysRedacted is returned.
+func (c *Client) Save(path string, names ...string) error {
+	var devices []*wgtypes.Device
+	if len(names) == 0 {
+		var err error
+		devices, err = c.Devices()
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, name := range names {
+			d, err := c.Device(name)
+			if err != nil {
+				return err
+			}
+
+			devices = append(devices, d)
+		}
+	}
+
+	s := savedState{
+		Version: stateVersion,
+		Devices: make([]wgstate.DeviceFile, 0, len(devices)),
+	}
+	for _, d := range devices {
+		if d.KeysRedacted {
+			return fmt.Errorf("wgctrl: device %q: %w", d.Name, ErrKeysRedacted)
+		}
+
+		s.Devices = append(s.Devices, wgstate.EncodeDevice(d, true))
+	}
+
+	b, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return wgstate.WriteFileAtomic(path, append(b, '\n'))
+}
+
+// RestoreOptions specify optional configuration for Restore.
+type RestoreOptions struct {
+	// Devices, if not empty, specifies the names of the saved devices to
+	// restore. Otherwise, all saved devices are restored.
+	Devices []string
+
+	// Force specifies that a device is restored even if its private key
+	// differs from its saved private key.
+	Force bool
+}
+
+// Restore reads devices saved by Save from the file at path, and replaces the
+// configuration of each existing device with the same name with its saved
+// configuration using ConfigureDevice. Devices are not created by Restore, so
+// they must exist beforehand. If opts is nil, a default configuration is
+// used.
+//
+// A device which already has a private key that differs from its saved
+// private key is likely to be a different device which reuses the name, so
+// Restore returns an error which can be checked using errors.Is and
+// ErrPrivateKeyMismatch, unless opts.Force is set. Every device is checked
+// before any is configured, so no device is restored if this check fails.
+//
+// If a device does not exist, an error is returned which can be checked
+// using os.IsNotExist.
+func (c *Client) Restore(path string, opts *RestoreOptions) error {
+	if opts == nil {
+		opts = &RestoreOptions{}
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var s savedState
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("wgctrl: failed to decode saved state: %v", err)
+	}
+
+	if s.Version != stateVersion {
+		return fmt.Errorf("wgctrl: unsupported saved state version: %d", s.Version)
+	}
+
+	saved := make(map[string]*wgtypes.Device, len(s.Devices))
+	var order []string
+	for _, df := range s.Devices {
+		d, err := df.Decode()
+		if err != nil {
+			return fmt.Errorf("wgctrl: invalid saved device %q: %v", df.Name, err)
+		}
+
+		saved[d.Name] = d
+		order = append(order, d.Name)
+	}
+
+	if len(opts.Devices) > 0 {
+		order = opts.Devices
+		for _, name := range order {
+			if _, ok := saved[name]; !ok {
+				return fmt.Errorf("wgctrl: device %q was not saved", name)
+			}
+		}
+	}
+
+	// Check every device before configuring any.
+	for _, name := range order {
+		d, err := c.Device(name)
+		if err != nil {
+			return err
+		}
+
+		// A redacted private key is identified by its public key.
+		k, want := d.PrivateKey, saved[name].PrivateKey
+		if d.KeysRedacted {
+			k, want = d.PublicKey, saved[name].PublicKey
+		}
+		if !opts.Force && k != (wgtypes.Key{}) && k != want {
+			return fmt.Errorf("wgctrl: device %q: %w", name, ErrPrivateKeyMismatch)
+		}
+	}
+
+	for _, name := range order {
+		if err := c.ConfigureDevice(name, wgstate.Restore(saved[name])); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package wgctrl
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgstate"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestClientSaveRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wgctrl-save")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	priv := wgtest.MustPrivateKey()
+	saved := &wgtypes.Device{
+		Name:         "wg0",
+		PrivateKey:   priv,
+		PublicKey:    priv.PublicKey(),
+		ListenPort:   51820,
+		FirewallMark: 1,
+		Peers: []wgtypes.Peer{
+			{
+				PublicKey:                   wgtest.MustPublicKey(),
+				PresharedKey:                wgtest.MustPresharedKey(),
+				Endpoint:                    wgtest.MustUDPAddr("[2001:db8::1]:51820"),
+				PersistentKeepaliveInterval: 25 * time.Second,
+				AllowedIPs: []net.IPNet{
+					wgtest.MustCIDR("10.0.0.0/24"),
+					wgtest.MustCIDR("2001:db8::/64"),
+				},
+			},
+			{PublicKey: wgtest.MustPublicKey()},
+		},
+	}
+
+	m := wgtest.NewMemClient(saved)
+	c := &Client{cs: []wginternal.Client{m}}
+
+	path := filepath.Join(dir, "state.json")
+	if err := c.Save(path); err != nil {
+		t.Fatalf("failed to save devices: %v", err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat saved state: %v", err)
+	}
+	if runtime.GOOS != "windows" {
+		if diff := cmp.Diff(os.FileMode(0600), fi.Mode().Perm()); diff != "" {
+			t.Fatalf("unexpected permissions (-want +got):\n%s", diff)
+		}
+	}
+
+	// Only the saved state remains in the directory.
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read directory: %v", err)
+	}
+	if diff := cmp.Diff(1, len(files)); diff != "" {
+		t.Fatalf("unexpected number of files (-want +got):\n%s", diff)
+	}
+
+	t.Run("empty device", func(t *testing.T) {
+		// As after a reboot, the device exists with no configuration.
+		m.SetState(&wgtypes.Device{Name: "wg0"})
+		if err := c.Restore(path, nil); err != nil {
+			t.Fatalf("failed to restore devices: %v", err)
+		}
+
+		if !wgstate.Equal(saved, m.State("wg0")) {
+			t.Fatalf("unexpected device after restore:\n%+v", m.State("wg0"))
+		}
+	})
+
+	t.Run("private key mismatch", func(t *testing.T) {
+		other := wgtest.MustPrivateKey()
+		m.SetState(&wgtypes.Device{Name: "wg0", PrivateKey: other})
+
+		if err := c.Restore(path, nil); !errors.Is(err, ErrPrivateKeyMismatch) {
+			t.Fatalf("expected private key mismatch, but got: %v", err)
+		}
+		if d := m.State("wg0"); d.PrivateKey != other || len(d.Peers) != 0 {
+			t.Fatalf("device was modified after a mismatch:\n%+v", d)
+		}
+
+		if err := c.Restore(path, &RestoreOptions{Force: true}); err != nil {
+			t.Fatalf("failed to force restore: %v", err)
+		}
+		if !wgstate.Equal(saved, m.State("wg0")) {
+			t.Fatalf("unexpected device after restore:\n%+v", m.State("wg0"))
+		}
+	})
+
+	t.Run("redacted", func(t *testing.T) {
+		m.SetState(saved)
+		m.Redact(true)
+		defer m.Redact(false)
+
+		// Keys which the backend withholds cannot be saved.
+		if err := c.Save(filepath.Join(dir, "redacted.json")); !errors.Is(err, ErrKeysRedacted) {
+			t.Fatalf("expected redacted keys, but got: %v", err)
+		}
+
+		// A redacted private key is compared with the saved key by its
+		// public key.
+		other := wgtest.MustPrivateKey()
+		m.SetState(&wgtypes.Device{Name: "wg0", PrivateKey: other, PublicKey: other.PublicKey()})
+		if err := c.Restore(path, nil); !errors.Is(err, ErrPrivateKeyMismatch) {
+			t.Fatalf("expected private key mismatch, but got: %v", err)
+		}
+
+		m.SetState(&wgtypes.Device{Name: "wg0", PrivateKey: priv, PublicKey: priv.PublicKey()})
+		if err := c.Restore(path, nil); err != nil {
+			t.Fatalf("failed to restore devices: %v", err)
+		}
+		if !wgstate.Equal(saved, m.State("wg0")) {
+			t.Fatalf("unexpected device after restore:\n%+v", m.State("wg0"))
+		}
+	})
+
+	t.Run("not saved", func(t *testing.T) {
+		if err := c.Restore(path, &RestoreOptions{Devices: []string{"wg1"}}); err == nil {
+			t.Fatal("expected an error for a device which was not saved")
+		}
+	})
+
+	t.Run("bad version", func(t *testing.T) {
+		bad := filepath.Join(dir, "bad.json")
+		if err := ioutil.WriteFile(bad, []byte(`{"version":2}`), 0600); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+
+		if err := c.Restore(bad, nil); err == nil {
+			t.Fatal("expected an error for an unsupported version")
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package wgctrl_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestReplay(t *testing.T) {
+	const res = `listen_port=51820
+public_key=b85996fecc9c7f1fc6d2572a76eda11d59bcd20be8e543b15ce4bd85a8e75a33
+allowed_ip=192.168.4.4/32
+errno=0
+
+`
+
+	var r wgctrl.Recorder
+	r.Record(wgctrl.WireExchange{
+		Backend:   "wguser",
+		Operation: "get",
+		Device:    "wg0",
+		Request:   [][]byte{[]byte("get=1\n\n")},
+		Response:  [][]byte{[]byte(res)},
+	})
+	r.Record(wgctrl.WireExchange{
+		Backend:   "wguser",
+		Operation: "set",
+		Device:    "wg0",
+		Error:     "wguser: errno=22",
+	})
+
+	// Round-trip the capture through its serialized form.
+	var buf bytes.Buffer
+	if err := wgctrl.WriteCapture(&buf, r.Exchanges()); err != nil {
+		t.Fatalf("failed to write capture: %v", err)
+	}
+
+	exs, err := wgctrl.ReadCapture(&buf)
+	if err != nil {
+		t.Fatalf("failed to read capture: %v", err)
+	}
+
+	if diff := cmp.Diff(r.Exchanges(), exs); diff != "" {
+		t.Fatalf("unexpected exchanges (-want +got):\n%s", diff)
+	}
+
+	c, err := wgctrl.NewReplay(exs)
+	if err != nil {
+		t.Fatalf("failed to create replay client: %v", err)
+	}
+	defer c.Close()
+
+	devices, err := c.Devices()
+	if err != nil {
+		t.Fatalf("failed to get devices: %v", err)
+	}
+
+	if diff := cmp.Diff(1, len(devices)); diff != "" {
+		t.Fatalf("unexpected number of devices (-want +got):\n%s", diff)
+	}
+
+	d := devices[0]
+	if d.Name != "wg0" || d.Type != wgtypes.Userspace || d.ListenPort != 51820 || len(d.Peers) != 1 {
+		t.Fatalf("unexpected replayed device: %+v", d)
+	}
+
+	if err := c.ConfigureDevice("wg0", wgtypes.Config{}); err == nil || err.Error() != "wguser: errno=22" {
+		t.Fatalf("expected recorded error, but got: %v", err)
+	}
+
+	if _, err := c.Device("wg1"); !os.IsNotExist(err) {
+		t.Fatalf("expected is not exist error, but got: %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package wgctrl
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgstate"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// ErrVerify indicates that a device did not reach the state expected after a
+// configuration was applied to it, such as when another process configured
+// the device at the same time. Use errors.Is to check for this error.
+var ErrVerify = errors.New("wgctrl: device does not match the expected configuration")
+
+// A TransactionResult reports the outcome of ConfigureDeviceTransaction.
+type TransactionResult struct {
+	// Before is the device before the configuration was applied.
+	Before *wgtypes.Device
+
+	// After is the device once the transaction completed, including any
+	// rollback. After is nil if the device could not be retrieved.
+	After *wgtypes.Device
+
+	// Applied reports whether the configuration was applied and the device
+	// was verified to be in the expected state.
+	Applied bool
+
+	// RolledBack reports whether a rollback was necessary, in which case
+	// Rollback is the configuration applied to restore the device to its
+	// state in Before.
+	RolledBack bool
+	Rollback   wgtypes.Config
+
+	// RollbackErr reports why a rollback failed. If RolledBack is true and
+	// RollbackErr is nil, the device was verified to be restored.
+	RollbackErr error
+}
+
+// ConfigureDeviceTransaction configures a WireGuard device by its interface
+// name, as with ConfigureDevice, but restores the device to its previous
+// state if the configuration cannot be completely applied.
+//
+// The device is retrieved before and after cfg is applied. If applying cfg
+// fails, such as when only some of the messages needed to configure a large
+// number of peers succeed, or if the device is not in the state predicted by
+// cfg afterward, a configuration which reverses any changes is computed and
+// applied, and the device is verified once more. Peers which were unchanged
+// are left untouched by the rollback, so their sessions are not interrupted.
+//
+// If a rollback occurs, the error which caused it is returned along with a
+// TransactionResult describing the rollback. An error returned by the
+// verification of a device can be checked using errors.Is and ErrVerify.
+//
+// Endpoints may be updated by the device itself as peers roam, so they are
+// only verified for peers whose endpoints are set by cfg. A peer's endpoint
+// cannot be removed, so a rollback cannot restore a peer which previously had
+// no endpoint to that state.
+//
+// The transaction does not prevent other processes from configuring the
+// device at the same time; their changes may be reversed by a rollback. If
+// locking is enabled by Options.Lock, the device is locked for the duration of
+// the transaction, which excludes other Clients which lock devices.
+//
+// If the backend redacts the device's keys, a rollback cannot restore them,
+// so a configuration which replaces the private key, or replaces or removes a
+// redacted preshared key, is refused with ErrKeysRedacted before it is
+// applied.
+func (c *Client) ConfigureDeviceTransaction(name string, cfg wgtypes.Config) (*TransactionResult, error) {
+	var res *TransactionResult
+	err := c.withLock(name, func() error {
+		var err error
+		res, err = c.transaction(name, cfg)
+		return err
+	})
+
+	return res, err
+}
+
+// transaction implements ConfigureDeviceTransaction without locking the
+// device.
+func (c *Client) transaction(name string, cfg wgtypes.Config) (*TransactionResult, error) {
+	before, err := c.Device(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if losesRedactedKeys(before, cfg) {
+		return nil, fmt.Errorf("wgctrl: device %q: %w", name, ErrKeysRedacted)
+	}
+
+	res := &TransactionResult{Before: before}
+
+	err = c.configureDevice(name, cfg)
+	if err == nil {
+		res.After, err = c.verify(name, before, cfg)
+		if err == nil {
+			res.Applied = true
+			return res, nil
+		}
+	}
+
+	res.RolledBack = true
+	res.After, res.RollbackErr = c.rollback(name, before, &res.Rollback)
+
+	return res, err
+}
+
+// rollback restores device name to its state in before, storing the
+// configuration it applies in cfg, and returns the restored device.
+func (c *Client) rollback(name string, before *wgtypes.Device, cfg *wgtypes.Config) (*wgtypes.Device, error) {
+	current, err := c.Device(name)
+	if err != nil {
+		// The current state is unknown, so replace the entire configuration.
+		*cfg = wgstate.Restore(before)
+		current = before
+	} else {
+		*cfg = wgstate.Diff(current, before)
+	}
+
+	if !wgstate.Empty(*cfg) {
+		if err := c.configureDevice(name, *cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.verify(name, current, *cfg)
+}
+
+// verify retrieves device name and checks that it is in the state expected
+// after applying cfg to base.
+func (c *Client) verify(name string, base *wgtypes.Device, cfg wgtypes.Config) (*wgtypes.Device, error) {
+	d, err := c.Device(name)
+	if err != nil {
+		return nil, err
+	}
+
+	want := wgstate.Simulate(base, cfg)
+
+	// A listen port of zero chooses a random port.
+	if cfg.ListenPort != nil && *cfg.ListenPort == 0 {
+		want.ListenPort = d.ListenPort
+	}
+
+	// Endpoints which aren't set by cfg may change as peers roam.
+	set := make(map[wgtypes.Key]bool)
+	for _, pc := range cfg.Peers {
+		if pc.Endpoint != nil {
+			set[pc.PublicKey] = true
+		}
+	}
+
+	actual := make(map[wgtypes.Key]*wgtypes.Peer, len(d.Peers))
+	for i := range d.Peers {
+		actual[d.Peers[i].PublicKey] = &d.Peers[i]
+	}
+
+	for i, p := range want.Peers {
+		if ap, ok := actual[p.PublicKey]; ok && !set[p.PublicKey] {
+			want.Peers[i].Endpoint = ap.Endpoint
+		}
+	}
+
+	if !wgstate.Equal(want, d) {
+		return d, ErrVerify
+	}
+
+	return d, nil
+}
+
+// losesRedactedKeys reports whether applying cfg to d would replace or remove
+// keys which are redacted, and therefore could not be restored by a rollback.
+func losesRedactedKeys(d *wgtypes.Device, cfg wgtypes.Config) bool {
+	if !d.KeysRedacted {
+		return false
+	}
+
+	if cfg.PrivateKey != nil && d.PublicKey != (wgtypes.Key{}) {
+		return true
+	}
+
+	redacted := make(map[wgtypes.Key]bool)
+	for _, p := range d.Peers {
+		if p.PresharedKeyRedacted {
+			redacted[p.PublicKey] = true
+		}
+	}
+
+	if cfg.ReplacePeers && len(redacted) > 0 {
+		return true
+	}
+
+	for _, pc := range cfg.Peers {
+		if redacted[pc.PublicKey] && (pc.Remove || pc.PresharedKey != nil) {
+			return true
+		}
+	}
+
+	return false
+}
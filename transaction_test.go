@@ -0,0 +1,207 @@
+package wgctrl
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgstate"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestClientConfigureDeviceTransaction(t *testing.T) {
+	var (
+		keyA = wgtest.MustPublicKey()
+		keyB = wgtest.MustPublicKey()
+		keyC = wgtest.MustPublicKey()
+		ipA  = wgtest.MustCIDR("10.0.0.1/32")
+		ipB  = wgtest.MustCIDR("10.0.0.2/32")
+		ipC  = wgtest.MustCIDR("10.0.0.3/32")
+	)
+
+	cfg := wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{
+			// Move A's allowed IP to B, and add C.
+			{
+				PublicKey:  keyB,
+				AllowedIPs: []net.IPNet{ipA},
+			},
+			{
+				PublicKey:  keyC,
+				AllowedIPs: []net.IPNet{ipC},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		fail     func(m *wgtest.MemClient, cfg wgtypes.Config) error
+		applied  bool
+		rollback bool
+		err      error
+	}{
+		{
+			name:    "OK",
+			applied: true,
+		},
+		{
+			name: "partial",
+			fail: func(m *wgtest.MemClient, cfg wgtypes.Config) error {
+				// Apply only the first peer, as if a later batch failed.
+				cfg.Peers = cfg.Peers[:1]
+				_ = m.Apply("wg0", cfg)
+				return errFoo
+			},
+			rollback: true,
+			err:      errFoo,
+		},
+		{
+			name: "verify",
+			fail: func(m *wgtest.MemClient, cfg wgtypes.Config) error {
+				// Another process removes peer C immediately.
+				_ = m.Apply("wg0", cfg)
+				_ = m.Apply("wg0", wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: keyC, Remove: true}}})
+				return nil
+			},
+			rollback: true,
+			err:      ErrVerify,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := &wgtypes.Device{
+				Name: "wg0",
+				Peers: []wgtypes.Peer{
+					{PublicKey: keyA, AllowedIPs: []net.IPNet{ipA}},
+					{PublicKey: keyB, AllowedIPs: []net.IPNet{ipB}},
+				},
+			}
+
+			m := wgtest.NewMemClient(before)
+			if tt.fail != nil {
+				m.FailNext("wg0", tt.fail)
+			}
+			c := &Client{cs: []wginternal.Client{m}}
+
+			res, err := c.ConfigureDeviceTransaction("wg0", cfg)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.applied, res.Applied); diff != "" {
+				t.Fatalf("unexpected applied (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.rollback, res.RolledBack); diff != "" {
+				t.Fatalf("unexpected rolled back (-want +got):\n%s", diff)
+			}
+			if res.RollbackErr != nil {
+				t.Fatalf("failed to roll back: %v", res.RollbackErr)
+			}
+
+			want := wgstate.Simulate(before, cfg)
+			if tt.rollback {
+				want = before
+
+				// Only the peers which changed are part of the rollback.
+				if len(res.Rollback.Peers) == 0 || res.Rollback.ReplacePeers {
+					t.Fatalf("unexpected rollback configuration: %+v", res.Rollback)
+				}
+			}
+
+			if !wgstate.Equal(want, res.After) || !wgstate.Equal(want, m.State("wg0")) {
+				t.Fatalf("unexpected device after transaction:\n%+v", m.State("wg0"))
+			}
+		})
+	}
+}
+
+func TestClientConfigureDeviceTransactionRedacted(t *testing.T) {
+	var (
+		priv = wgtest.MustPrivateKey()
+		psk  = wgtest.MustPresharedKey()
+		keyA = wgtest.MustPublicKey()
+		keyB = wgtest.MustPublicKey()
+	)
+
+	tests := []struct {
+		name string
+		cfg  wgtypes.Config
+		err  error
+	}{
+		{
+			name: "add preshared key",
+			cfg: wgtypes.Config{Peers: []wgtypes.PeerConfig{{
+				PublicKey:    keyB,
+				UpdateOnly:   true,
+				PresharedKey: &psk,
+			}}},
+		},
+		{
+			name: "replace preshared key",
+			cfg: wgtypes.Config{Peers: []wgtypes.PeerConfig{{
+				PublicKey:    keyA,
+				UpdateOnly:   true,
+				PresharedKey: &psk,
+			}}},
+			err: ErrKeysRedacted,
+		},
+		{
+			name: "remove peer",
+			cfg:  wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: keyA, Remove: true}}},
+			err:  ErrKeysRedacted,
+		},
+		{
+			name: "replace peers",
+			cfg:  wgtypes.Config{ReplacePeers: true},
+			err:  ErrKeysRedacted,
+		},
+		{
+			name: "private key",
+			cfg:  wgtypes.Config{PrivateKey: &priv},
+			err:  ErrKeysRedacted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := wgtest.MustPrivateKey()
+			before := &wgtypes.Device{
+				Name:       "wg0",
+				PrivateKey: k,
+				PublicKey:  k.PublicKey(),
+				Peers: []wgtypes.Peer{
+					{PublicKey: keyA, PresharedKey: wgtest.MustPresharedKey()},
+					{PublicKey: keyB},
+				},
+			}
+
+			m := wgtest.NewMemClient(before)
+			m.Redact(true)
+			c := &Client{cs: []wginternal.Client{m}}
+
+			res, err := c.ConfigureDeviceTransaction("wg0", tt.cfg)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			want := before
+			if tt.err == nil {
+				if !res.Applied || res.RolledBack {
+					t.Fatalf("unexpected transaction result: %+v", res)
+				}
+
+				want = wgstate.Simulate(before, tt.cfg)
+			}
+
+			// The actual keys of the device are checked, not only what the
+			// backend reveals.
+			if !wgstate.Equal(want, m.State("wg0")) {
+				t.Fatalf("unexpected device after transaction:\n%+v", m.State("wg0"))
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+// Package wgharness provides a test harness of virtual WireGuard nodes which
+// run within the current process and require no privileges.
+//
+// Each Node is an embedded wireguard-go device with a virtual TUN backed by a
+// userspace network stack, controlled by its own wgctrl.Client, which
+// communicates with other Nodes using UDP on the loopback interface. Tests
+// send UDP datagrams through the tunnels with Node.Send and Node.Receive, and
+// can then assert on handshakes, transfer counters, and allowed IP routing
+// using the Client.
+package wgharness
@@ -0,0 +1,328 @@
+package wgharness
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Config specifies optional configuration for a Network.
+type Config struct {
+	// Prefix is the IPv4 or IPv6 network from which each Node is assigned an
+	// address within the tunnels. If nil, 10.0.0.0/24 is used.
+	Prefix *net.IPNet
+
+	// Logf, if not nil, receives log messages from each Node's device.
+	Logf func(format string, v ...interface{})
+}
+
+// A Network is a set of virtual WireGuard nodes.
+type Network struct {
+	// Nodes are the nodes in the Network, in order of creation.
+	Nodes []*Node
+}
+
+// A Node is a virtual WireGuard node.
+type Node struct {
+	// Client controls the Node's device, and only that device.
+	Client *wgctrl.Client
+
+	// Name is the name of the Node's device.
+	Name string
+
+	// Addr is the Node's address within the tunnels.
+	Addr net.IP
+
+	// PrivateKey and PublicKey are the Node's keys.
+	PrivateKey, PublicKey wgtypes.Key
+
+	// Port is the UDP port on which the Node listens for WireGuard traffic.
+	Port int
+
+	d  *wgctrl.EmbeddedDevice
+	pc net.PacketConn
+}
+
+// A Packet is a UDP payload exchanged through a tunnel.
+type Packet struct {
+	Source      net.IP
+	Destination net.IP
+	Payload     []byte
+}
+
+// packetPort is the UDP port within the tunnels on which each Node sends and
+// receives Packets.
+const packetPort = 4000
+
+// maxPayload is the largest payload which Receive can return.
+const maxPayload = 65535
+
+// New creates a Network of n Nodes, each with a fresh private key and no
+// peers. If cfg is nil, a default configuration is used.
+func New(n int, cfg *Config) (*Network, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	prefix := cfg.Prefix
+	if prefix == nil {
+		_, prefix, _ = net.ParseCIDR("10.0.0.0/24")
+	}
+
+	nw := &Network{}
+	for i := 0; i < n; i++ {
+		addr, err := nthAddr(prefix, i+1)
+		if err != nil {
+			_ = nw.Close()
+			return nil, err
+		}
+
+		node, err := newNode(fmt.Sprintf("wgharness%d", i), addr, cfg.Logf)
+		if err != nil {
+			_ = nw.Close()
+			return nil, err
+		}
+
+		nw.Nodes = append(nw.Nodes, node)
+	}
+
+	return nw, nil
+}
+
+// newNode creates a Node with a single embedded device.
+func newNode(name string, addr net.IP, logf func(format string, v ...interface{})) (*Node, error) {
+	c, err := wgctrl.NewWithOptions(&wgctrl.Options{EmbeddedOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := c.CreateEmbeddedDevice(name, &wgctrl.EmbeddedDeviceOptions{
+		Addresses: []net.IP{addr},
+		Loopback:  true,
+		Logf:      logf,
+	})
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	// The socket is closed along with the device's network stack.
+	pc, err := d.ListenPacket("udp", net.JoinHostPort(addr.String(), strconv.Itoa(packetPort)))
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	priv, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	// Let the system choose a port.
+	port := 0
+	err = c.ConfigureDevice(name, wgtypes.Config{
+		PrivateKey: &priv,
+		ListenPort: &port,
+	})
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	dev, err := c.Device(name)
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	return &Node{
+		Client:     c,
+		Name:       name,
+		Addr:       addr,
+		PrivateKey: priv,
+		PublicKey:  dev.PublicKey,
+		Port:       dev.ListenPort,
+
+		d:  d,
+		pc: pc,
+	}, nil
+}
+
+// Close closes all of the Nodes in the Network.
+func (nw *Network) Close() error {
+	var err error
+	for _, n := range nw.Nodes {
+		if cerr := n.Client.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// Connect configures a and b as peers of each other. Each peer is reachable
+// using UDP on the loopback interface, and is allowed to use its own address
+// within the tunnel.
+func (nw *Network) Connect(a, b *Node) error {
+	if err := a.AddPeer(b); err != nil {
+		return err
+	}
+
+	return b.AddPeer(a)
+}
+
+// Mesh connects every pair of Nodes in the Network.
+func (nw *Network) Mesh() error {
+	for i, a := range nw.Nodes {
+		for _, b := range nw.Nodes[i+1:] {
+			if err := nw.Connect(a, b); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// AddPeer configures peer as a peer of n, so that packets sent by n to the
+// address of peer are routed through a tunnel to peer.
+func (n *Node) AddPeer(peer *Node) error {
+	return n.Client.ConfigureDevice(n.Name, wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey: peer.PublicKey,
+			Endpoint: &net.UDPAddr{
+				IP:   net.IPv4(127, 0, 0, 1),
+				Port: peer.Port,
+			},
+			AllowedIPs: []net.IPNet{hostNet(peer.Addr)},
+		}},
+	})
+}
+
+// Device retrieves the current state of the Node's device.
+func (n *Node) Device() (*wgtypes.Device, error) {
+	return n.Client.Device(n.Name)
+}
+
+// Peer retrieves the current state of the Node's peer with the specified
+// public key.
+func (n *Node) Peer(key wgtypes.Key) (*wgtypes.Peer, error) {
+	d, err := n.Device()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range d.Peers {
+		if p.PublicKey == key {
+			return &p, nil
+		}
+	}
+
+	return nil, fmt.Errorf("wgharness: %s: no peer with public key %s", n.Name, key)
+}
+
+// Send sends a UDP datagram carrying payload from the Node's address to dst.
+// The datagram is routed to the peer whose allowed IPs contain dst, or
+// dropped if there is no such peer.
+func (n *Node) Send(ctx context.Context, dst net.IP, payload []byte) error {
+	if d, ok := ctx.Deadline(); ok {
+		if err := n.pc.SetWriteDeadline(d); err != nil {
+			return err
+		}
+	}
+
+	_, err := n.pc.WriteTo(payload, &net.UDPAddr{IP: dst, Port: packetPort})
+	return err
+}
+
+// Receive waits for the next UDP datagram received by the Node from a peer.
+// Receive must not be called concurrently.
+func (n *Node) Receive(ctx context.Context) (*Packet, error) {
+	// Interrupt the read when ctx is canceled.
+	if err := n.pc.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = n.pc.SetReadDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	b := make([]byte, maxPayload)
+	nb, addr, err := n.pc.ReadFrom(b)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		return nil, err
+	}
+
+	return &Packet{
+		Source:      addr.(*net.UDPAddr).IP,
+		Destination: n.Addr,
+		Payload:     b[:nb],
+	}, nil
+}
+
+// WaitHandshake waits until the Node has completed a handshake with peer,
+// returning the current state of the peer.
+func (n *Node) WaitHandshake(ctx context.Context, peer *Node) (*wgtypes.Peer, error) {
+	t := time.NewTicker(10 * time.Millisecond)
+	defer t.Stop()
+
+	for {
+		p, err := n.Peer(peer.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if !p.LastHandshakeTime.IsZero() {
+			return p, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// hostNet returns a single address network for ip.
+func hostNet(ip net.IP) net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+
+	return net.IPNet{IP: ip.To16(), Mask: net.CIDRMask(128, 128)}
+}
+
+// nthAddr returns the address at offset n within prefix.
+func nthAddr(prefix *net.IPNet, n int) (net.IP, error) {
+	ip := prefix.IP.To4()
+	if ip == nil {
+		ip = prefix.IP.To16()
+	}
+
+	out := make(net.IP, len(ip))
+	copy(out, ip)
+
+	// Add n to the address, carrying into more significant bytes.
+	carry := n
+	for i := len(out) - 1; i >= 0 && carry > 0; i-- {
+		sum := int(out[i]) + carry
+		out[i] = byte(sum)
+		carry = sum >> 8
+	}
+
+	if carry > 0 || !prefix.Contains(out) {
+		return nil, fmt.Errorf("wgharness: prefix %s is too small for %d nodes", prefix, n)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,163 @@
+package wgharness_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl/wgharness"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestNetworkMesh(t *testing.T) {
+	nw, err := wgharness.New(3, nil)
+	if err != nil {
+		t.Fatalf("failed to create network: %v", err)
+	}
+	defer nw.Close()
+
+	if err := nw.Mesh(); err != nil {
+		t.Fatalf("failed to mesh network: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	a, b, c := nw.Nodes[0], nw.Nodes[1], nw.Nodes[2]
+
+	// Every node can reach every other node.
+	for _, src := range nw.Nodes {
+		for _, dst := range nw.Nodes {
+			if src == dst {
+				continue
+			}
+
+			want := &wgharness.Packet{
+				Source:      src.Addr,
+				Destination: dst.Addr,
+				Payload:     []byte("hello, " + dst.Name),
+			}
+
+			if diff := cmp.Diff(want, exchange(ctx, t, src, dst, want.Payload)); diff != "" {
+				t.Fatalf("unexpected packet from %s to %s (-want +got):\n%s", src.Name, dst.Name, diff)
+			}
+		}
+	}
+
+	p, err := a.WaitHandshake(ctx, b)
+	if err != nil {
+		t.Fatalf("failed to wait for handshake: %v", err)
+	}
+
+	if p.ReceiveBytes == 0 || p.TransmitBytes == 0 {
+		t.Fatalf("expected non-zero transfer counters, but got rx: %d, tx: %d",
+			p.ReceiveBytes, p.TransmitBytes)
+	}
+
+	// Route c's address through b instead; b now receives the datagrams sent
+	// by a to c, and discards them as they are not addressed to b.
+	err = a.Client.ConfigureDevice(a.Name, wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{
+			{
+				PublicKey:         b.PublicKey,
+				ReplaceAllowedIPs: true,
+				AllowedIPs:        []net.IPNet{host(b.Addr), host(c.Addr)},
+			},
+			{
+				PublicKey:         c.PublicKey,
+				UpdateOnly:        true,
+				ReplaceAllowedIPs: true,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to configure device: %v", err)
+	}
+
+	before, err := b.Peer(a.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to get peer: %v", err)
+	}
+
+	if err := a.Send(ctx, c.Addr, []byte("rerouted")); err != nil {
+		t.Fatalf("failed to send packet: %v", err)
+	}
+
+	for {
+		p, err := b.Peer(a.PublicKey)
+		if err != nil {
+			t.Fatalf("failed to get peer: %v", err)
+		}
+		if p.ReceiveBytes > before.ReceiveBytes {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatal("rerouted packet was not received by b")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	rctx, rcancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer rcancel()
+
+	if p, err := c.Receive(rctx); err == nil {
+		t.Fatalf("expected c to receive no packets, but got: %+v", p)
+	}
+}
+
+func TestNewPrefix(t *testing.T) {
+	_, prefix, err := net.ParseCIDR("2001:db8::/126")
+	if err != nil {
+		t.Fatalf("failed to parse prefix: %v", err)
+	}
+
+	nw, err := wgharness.New(2, &wgharness.Config{Prefix: prefix})
+	if err != nil {
+		t.Fatalf("failed to create network: %v", err)
+	}
+	defer nw.Close()
+
+	var addrs []string
+	for _, n := range nw.Nodes {
+		addrs = append(addrs, n.Addr.String())
+	}
+
+	if diff := cmp.Diff([]string{"2001:db8::1", "2001:db8::2"}, addrs); diff != "" {
+		t.Fatalf("unexpected addresses (-want +got):\n%s", diff)
+	}
+
+	if _, err := wgharness.New(4, &wgharness.Config{Prefix: prefix}); err == nil {
+		t.Fatal("expected an error for a prefix which is too small, but none occurred")
+	}
+}
+
+// exchange sends payload from src and waits for it to be received by dst. By
+// default the packet is addressed to dst, but an optional alternate
+// destination address may be specified.
+func exchange(ctx context.Context, t *testing.T, src, dst *wgharness.Node, payload []byte, to ...net.IP) *wgharness.Packet {
+	t.Helper()
+
+	addr := dst.Addr
+	if len(to) > 0 {
+		addr = to[0]
+	}
+
+	if err := src.Send(ctx, addr, payload); err != nil {
+		t.Fatalf("failed to send packet: %v", err)
+	}
+
+	p, err := dst.Receive(ctx)
+	if err != nil {
+		t.Fatalf("failed to receive packet: %v", err)
+	}
+
+	return p
+}
+
+func host(ip net.IP) net.IPNet {
+	return net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}
+}
@@ -0,0 +1,9 @@
+// Package wghistory records the configuration history of WireGuard devices,
+// so that changes can be reviewed and undone.
+//
+// A Store wraps a wgctrl.Client. Before each configuration applied through
+// the Store, a snapshot of the device's configuration is written to disk as a
+// numbered revision, along with a summary of the change which followed. Any
+// revision can later be restored by applying the minimal configuration which
+// changes the device back to its snapshot.
+package wghistory
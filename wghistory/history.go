@@ -0,0 +1,345 @@
+package wghistory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgstate"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// revisionVersion is the current version of the revision file format.
+const revisionVersion = 1
+
+// revisionExt is the extension of revision files.
+const revisionExt = ".json"
+
+// A revisionFile is the on-disk format of a Revision.
+type revisionFile struct {
+	Version  int                `json:"version"`
+	ID       int                `json:"id"`
+	Time     time.Time          `json:"time"`
+	Summary  []string           `json:"summary"`
+	HasKeys  bool               `json:"has_keys"`
+	Snapshot wgstate.DeviceFile `json:"snapshot"`
+}
+
+// Config specifies optional configuration for a Store.
+type Config struct {
+	// Revisions is the number of revisions kept for each device. Older
+	// revisions are removed. If zero, 10 revisions are kept.
+	Revisions int
+
+	// IncludeKeys specifies that private and preshared keys are stored in
+	// snapshots. Otherwise, a rollback leaves the device's private key and
+	// its existing peers' preshared keys as they are, and peers restored by
+	// a rollback have no preshared key.
+	IncludeKeys bool
+}
+
+// A Revision is a snapshot of the configuration of a device, taken before a
+// change was applied to it.
+type Revision struct {
+	// Device is the name of the device, and ID is the number of the
+	// revision, which increases with each revision of the device.
+	Device string
+	ID     int
+
+	// Time is when the snapshot was taken.
+	Time time.Time
+
+	// Summary describes the change which was applied after the snapshot was
+	// taken, as produced by wgctrl.Changes.Lines.
+	Summary []string
+
+	// Snapshot is the configuration of the device. Its private and preshared
+	// keys are zero unless HasKeys is set, which is the case if
+	// Config.IncludeKeys was set when it was taken and the device's keys
+	// were not redacted by its backend.
+	Snapshot *wgtypes.Device
+	HasKeys  bool
+}
+
+// A Store records the configuration history of devices controlled by a
+// wgctrl.Client. A Store is safe for concurrent use by multiple goroutines,
+// but only one Store should use a directory at a time.
+type Store struct {
+	c   *wgctrl.Client
+	dir string
+	cfg Config
+
+	mu sync.Mutex
+}
+
+// New creates a Store which configures devices using c and stores revisions
+// in a subdirectory of dir for each device. dir is created with permissions
+// 0700 if it does not exist. If cfg is nil, a default configuration is used.
+func New(c *wgctrl.Client, dir string, cfg *Config) (*Store, error) {
+	s := &Store{c: c, dir: dir}
+	if cfg != nil {
+		s.cfg = *cfg
+	}
+	if s.cfg.Revisions == 0 {
+		s.cfg.Revisions = 10
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// ConfigureDevice records a revision containing the current configuration of
+// the device specified by name, and then configures the device with cfg, as
+// with wgctrl.Client.ConfigureDevice. If the revision cannot be recorded, the
+// device is not configured.
+func (s *Store) ConfigureDevice(name string, cfg wgtypes.Config) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.configure(name, cfg)
+}
+
+// configure implements ConfigureDevice with s.mu held.
+func (s *Store) configure(name string, cfg wgtypes.Config) error {
+	// The summary is predicted, so that the revision is recorded before the
+	// change is applied.
+	res, err := s.c.DryRun(name, cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := s.record(res.Before, res.Changes.Lines()); err != nil {
+		return err
+	}
+
+	return s.c.ConfigureDevice(name, cfg)
+}
+
+// Revisions returns the revisions recorded for the device specified by name,
+// from oldest to newest.
+func (s *Store) Revisions(name string) ([]Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids, err := s.ids(name)
+	if err != nil {
+		return nil, err
+	}
+
+	revs := make([]Revision, 0, len(ids))
+	for _, id := range ids {
+		rev, err := s.read(name, id)
+		if err != nil {
+			return nil, err
+		}
+
+		revs = append(revs, *rev)
+	}
+
+	return revs, nil
+}
+
+// Rollback restores the device specified by name to the snapshot in revision
+// id. Only the differences between the device and the snapshot are applied,
+// so peers which are unchanged keep their sessions. The rollback is itself
+// recorded as a new revision, so it can be undone.
+//
+// A peer's endpoint cannot be removed, so peers which had no endpoint in the
+// snapshot keep their current endpoints.
+func (s *Store) Rollback(name string, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rev, err := s.read(name, id)
+	if err != nil {
+		return err
+	}
+
+	current, err := s.c.Device(name)
+	if err != nil {
+		return err
+	}
+
+	cfg := wgstate.Diff(current, s.target(current, rev))
+	if wgstate.Empty(cfg) {
+		return nil
+	}
+
+	return s.configure(name, cfg)
+}
+
+// target produces the state to which Rollback restores current, keeping its
+// keys if they were not stored in rev.
+func (s *Store) target(current *wgtypes.Device, rev *Revision) *wgtypes.Device {
+	d := wgstate.Clone(rev.Snapshot)
+	if rev.HasKeys {
+		return d
+	}
+
+	// Keys which current's backend redacts are kept as they are.
+	d.PrivateKey = current.PrivateKey
+	d.PublicKey = current.PublicKey
+	d.KeysRedacted = current.KeysRedacted
+
+	peers := make(map[wgtypes.Key]*wgtypes.Peer, len(current.Peers))
+	for i := range current.Peers {
+		peers[current.Peers[i].PublicKey] = &current.Peers[i]
+	}
+
+	for i := range d.Peers {
+		if p, ok := peers[d.Peers[i].PublicKey]; ok {
+			d.Peers[i].PresharedKey = p.PresharedKey
+			d.Peers[i].PresharedKeyRedacted = p.PresharedKeyRedacted
+		}
+	}
+
+	return d
+}
+
+// record writes a new revision containing d, and removes the oldest
+// revisions beyond the configured limit.
+func (s *Store) record(d *wgtypes.Device, summary []string) error {
+	dir, err := s.deviceDir(d.Name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	ids, err := s.ids(d.Name)
+	if err != nil {
+		return err
+	}
+
+	id := 1
+	if len(ids) > 0 {
+		id = ids[len(ids)-1] + 1
+	}
+
+	// Keys redacted by the backend are unknown, so they cannot be stored.
+	keys := s.cfg.IncludeKeys && !d.KeysRedacted
+
+	b, err := json.MarshalIndent(revisionFile{
+		Version:  revisionVersion,
+		ID:       id,
+		Time:     time.Now().UTC(),
+		Summary:  summary,
+		HasKeys:  keys,
+		Snapshot: wgstate.EncodeDevice(d, keys),
+	}, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	if err := wgstate.WriteFileAtomic(s.path(dir, id), append(b, '\n')); err != nil {
+		return err
+	}
+
+	ids = append(ids, id)
+	for len(ids) > s.cfg.Revisions {
+		if err := os.Remove(s.path(dir, ids[0])); err != nil {
+			return err
+		}
+		ids = ids[1:]
+	}
+
+	return nil
+}
+
+// read reads revision id of the device specified by name.
+func (s *Store) read(name string, id int) (*Revision, error) {
+	dir, err := s.deviceDir(name)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(s.path(dir, id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("wghistory: device %q has no revision %d", name, id)
+		}
+
+		return nil, err
+	}
+
+	var rf revisionFile
+	if err := json.Unmarshal(b, &rf); err != nil {
+		return nil, fmt.Errorf("wghistory: failed to decode revision %d of device %q: %v", id, name, err)
+	}
+	if rf.Version != revisionVersion {
+		return nil, fmt.Errorf("wghistory: unsupported revision version: %d", rf.Version)
+	}
+
+	d, err := rf.Snapshot.Decode()
+	if err != nil {
+		return nil, fmt.Errorf("wghistory: invalid revision %d of device %q: %v", id, name, err)
+	}
+
+	return &Revision{
+		Device:   name,
+		ID:       rf.ID,
+		Time:     rf.Time,
+		Summary:  rf.Summary,
+		Snapshot: d,
+		HasKeys:  rf.HasKeys,
+	}, nil
+}
+
+// ids returns the IDs of the revisions of the device specified by name, in
+// ascending order.
+func (s *Store) ids(name string) ([]int, error) {
+	dir, err := s.deviceDir(name)
+	if err != nil {
+		return nil, err
+	}
+
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var ids []int
+	for _, fi := range fis {
+		id, err := strconv.Atoi(strings.TrimSuffix(fi.Name(), revisionExt))
+		if err != nil || !strings.HasSuffix(fi.Name(), revisionExt) {
+			// Ignore temporary and unrelated files.
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// deviceDir returns the directory containing the revisions of the device
+// specified by name.
+func (s *Store) deviceDir(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", fmt.Errorf("wghistory: invalid device name: %q", name)
+	}
+
+	return filepath.Join(s.dir, name), nil
+}
+
+// path returns the path of revision id within a device directory.
+func (s *Store) path(dir string, id int) string {
+	return filepath.Join(dir, strconv.Itoa(id)+revisionExt)
+}
@@ -0,0 +1,139 @@
+package wghistory_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgstate"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wghistory"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wghistory")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := wgctrl.NewWithOptions(&wgctrl.Options{EmbeddedOnly: true})
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer c.Close()
+
+	const name = "wghistorytest0"
+	ed, err := c.CreateEmbeddedDevice(name, nil)
+	if err != nil {
+		t.Fatalf("failed to create embedded device: %v", err)
+	}
+	defer ed.Close()
+
+	s, err := wghistory.New(c, dir, &wghistory.Config{Revisions: 2})
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	var (
+		priv = wgtest.MustPrivateKey()
+		psk  = wgtest.MustPresharedKey()
+		keyA = wgtest.MustPublicKey()
+		keyB = wgtest.MustPublicKey()
+		ipA  = wgtest.MustCIDR("10.0.0.1/32")
+		ipB  = wgtest.MustCIDR("10.0.0.2/32")
+	)
+
+	cfgs := []wgtypes.Config{
+		{PrivateKey: &priv},
+		{Peers: []wgtypes.PeerConfig{{PublicKey: keyA, PresharedKey: &psk, AllowedIPs: []net.IPNet{ipA}}}},
+		{Peers: []wgtypes.PeerConfig{{PublicKey: keyB, AllowedIPs: []net.IPNet{ipB}}}},
+	}
+
+	var states []*wgtypes.Device
+	for _, cfg := range cfgs {
+		if err := s.ConfigureDevice(name, cfg); err != nil {
+			t.Fatalf("failed to configure device: %v", err)
+		}
+
+		d, err := c.Device(name)
+		if err != nil {
+			t.Fatalf("failed to get device: %v", err)
+		}
+		states = append(states, d)
+	}
+
+	revs, err := s.Revisions(name)
+	if err != nil {
+		t.Fatalf("failed to list revisions: %v", err)
+	}
+
+	type summary struct {
+		ID      int
+		Summary []string
+	}
+
+	var got []summary
+	for _, rev := range revs {
+		if rev.Time.IsZero() || rev.HasKeys || rev.Snapshot.PrivateKey != (wgtypes.Key{}) {
+			t.Fatalf("unexpected revision: %+v", rev)
+		}
+
+		got = append(got, summary{ID: rev.ID, Summary: rev.Summary})
+	}
+
+	// Only the two newest revisions are kept.
+	want := []summary{
+		{
+			ID: 2,
+			Summary: []string{
+				fmt.Sprintf("peer %s: added", keyA),
+				fmt.Sprintf("peer %s: preshared-key: (none) -> (hidden)", keyA),
+				fmt.Sprintf("peer %s: allowed-ips: (none) -> 10.0.0.1/32", keyA),
+			},
+		},
+		{
+			ID: 3,
+			Summary: []string{
+				fmt.Sprintf("peer %s: added", keyB),
+				fmt.Sprintf("peer %s: allowed-ips: (none) -> 10.0.0.2/32", keyB),
+			},
+		},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected revisions (-want +got):\n%s", diff)
+	}
+
+	// Revision 3 was taken after the second configuration, so rolling back to
+	// it removes peer B, and keeps the private key and A's preshared key.
+	if err := s.Rollback(name, 3); err != nil {
+		t.Fatalf("failed to roll back: %v", err)
+	}
+
+	d, err := c.Device(name)
+	if err != nil {
+		t.Fatalf("failed to get device: %v", err)
+	}
+	if !wgstate.Equal(states[1], d) {
+		t.Fatalf("unexpected device after rollback:\n%+v", d)
+	}
+
+	// The rollback is recorded so that it can be undone.
+	revs, err = s.Revisions(name)
+	if err != nil {
+		t.Fatalf("failed to list revisions: %v", err)
+	}
+	if diff := cmp.Diff(4, revs[len(revs)-1].ID); diff != "" {
+		t.Fatalf("unexpected newest revision (-want +got):\n%s", diff)
+	}
+
+	if err := s.Rollback(name, 1); err == nil {
+		t.Fatal("expected an error rolling back to a removed revision")
+	}
+}
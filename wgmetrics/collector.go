@@ -0,0 +1,330 @@
+package wgmetrics
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// A Source produces WireGuard devices. *wgctrl.Client is a Source.
+type Source interface {
+	Devices() ([]*wgtypes.Device, error)
+}
+
+// A PeerLabel determines how the "peer" label of per-peer metrics is
+// produced, and therefore the number of time series per device.
+type PeerLabel int
+
+// Possible PeerLabel values.
+const (
+	// PeerLabelPublicKey labels each peer with its public key, producing one
+	// time series per peer.
+	PeerLabelPublicKey PeerLabel = iota
+
+	// PeerLabelName labels each peer with its name in Config.Names. Peers
+	// without a name are combined under the name "other", as are peers
+	// which share a name.
+	PeerLabelName
+
+	// PeerLabelNone omits the peer label, combining all of the peers of a
+	// device into a single time series.
+	PeerLabelNone
+)
+
+// Config configures a Collector.
+type Config struct {
+	// PeerLabel determines how peers are labeled. If not set, peers are
+	// labeled by public key.
+	PeerLabel PeerLabel
+
+	// Names maps peer public keys to names, for use with PeerLabelName.
+	Names map[wgtypes.Key]string
+}
+
+// A Collector collects metrics from the devices produced by a Source.
+//
+// When peers are combined by PeerLabelName or PeerLabelNone, the byte counters
+// of each combined time series include the final counts of peers which have
+// since been removed or whose counters were reset, so that the series do not
+// decrease while their device exists.
+type Collector struct {
+	src Source
+	cfg Config
+
+	// mu serializes collections when peers are combined. seen holds the
+	// byte counters of each peer when last collected, and removed the counts
+	// which combined time series retain from peers which were removed or
+	// reset.
+	mu      sync.Mutex
+	seen    map[peerKey]peerBytes
+	removed map[seriesKey]peerBytes
+}
+
+// A peerKey identifies a peer of a device.
+type peerKey struct {
+	device string
+	key    wgtypes.Key
+}
+
+// A seriesKey identifies a combined time series of a device by the value of
+// its peer label, if any.
+type seriesKey struct {
+	device, peer string
+}
+
+// peerBytes are the byte counters of a peer.
+type peerBytes struct {
+	series   seriesKey
+	receive  int64
+	transmit int64
+}
+
+// New creates a Collector which collects metrics from src. If cfg is nil, a
+// default configuration is used.
+func New(src Source, cfg *Config) *Collector {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	return &Collector{
+		src: src,
+		cfg: *cfg,
+	}
+}
+
+// Collect fetches all devices from the Source and produces metric Families.
+func (c *Collector) Collect() ([]*Family, error) {
+	// Combined counters depend on the previous collection, so collections are
+	// serialized to observe devices in order.
+	combine := c.cfg.PeerLabel != PeerLabelPublicKey
+	if combine {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+	}
+
+	devices, err := c.src.Devices()
+	if err != nil {
+		return nil, err
+	}
+
+	fs := newFamilies()
+	seen := make(map[peerKey]peerBytes)
+
+	for _, d := range devices {
+		device := Label{Name: "device", Value: d.Name}
+
+		fs.deviceInfo.add(1, device,
+			Label{Name: "type", Value: d.Type.String()},
+			Label{Name: "public_key", Value: d.PublicKey.String()},
+		)
+		fs.listenPort.add(float64(d.ListenPort), device)
+		fs.peers.add(float64(len(d.Peers)), device)
+
+		for _, p := range d.Peers {
+			labels := []Label{device}
+			l, ok := c.peerLabel(p.PublicKey)
+			if ok {
+				labels = append(labels, l)
+			}
+
+			if combine {
+				seen[peerKey{device: d.Name, key: p.PublicKey}] = peerBytes{
+					series:   seriesKey{device: d.Name, peer: l.Value},
+					receive:  p.ReceiveBytes,
+					transmit: p.TransmitBytes,
+				}
+			}
+
+			var handshake float64
+			if !p.LastHandshakeTime.IsZero() {
+				handshake = float64(p.LastHandshakeTime.Unix())
+			}
+
+			fs.receiveBytes.add(float64(p.ReceiveBytes), labels...)
+			fs.transmitBytes.add(float64(p.TransmitBytes), labels...)
+			fs.lastHandshake.add(handshake, labels...)
+			fs.allowedIPs.add(float64(len(p.AllowedIPs)), labels...)
+			fs.keepalive.add(p.PersistentKeepaliveInterval.Seconds(), labels...)
+		}
+	}
+
+	if combine {
+		c.retain(fs, devices, seen)
+	}
+
+	return fs.list(), nil
+}
+
+// retain adds the counts retained from removed and reset peers to the byte
+// counters of each combined time series in fs, given the peers of devices
+// which are currently seen. The caller must hold c.mu.
+func (c *Collector) retain(fs *families, devices []*wgtypes.Device, seen map[peerKey]peerBytes) {
+	if c.removed == nil {
+		c.removed = make(map[seriesKey]peerBytes)
+	}
+
+	for k, last := range c.seen {
+		cur, ok := seen[k]
+		r := c.removed[last.series]
+		if !ok || cur.receive < last.receive {
+			r.receive += last.receive
+		}
+		if !ok || cur.transmit < last.transmit {
+			r.transmit += last.transmit
+		}
+		c.removed[last.series] = r
+	}
+	c.seen = seen
+
+	// Series of devices which no longer exist are discarded, as are their
+	// per-peer series.
+	present := make(map[string]bool, len(devices))
+	for _, d := range devices {
+		present[d.Name] = true
+	}
+
+	keys := make([]seriesKey, 0, len(c.removed))
+	for k := range c.removed {
+		if !present[k.device] {
+			delete(c.removed, k)
+			continue
+		}
+
+		keys = append(keys, k)
+	}
+
+	// Add series in a stable order, for those which have no current peers.
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].device != keys[j].device {
+			return keys[i].device < keys[j].device
+		}
+
+		return keys[i].peer < keys[j].peer
+	})
+
+	for _, k := range keys {
+		r := c.removed[k]
+		labels := []Label{{Name: "device", Value: k.device}}
+		if c.cfg.PeerLabel == PeerLabelName {
+			labels = append(labels, Label{Name: "peer", Value: k.peer})
+		}
+
+		fs.receiveBytes.add(float64(r.receive), labels...)
+		fs.transmitBytes.add(float64(r.transmit), labels...)
+	}
+}
+
+// peerLabel produces the peer label for key, if one is configured.
+func (c *Collector) peerLabel(key wgtypes.Key) (Label, bool) {
+	switch c.cfg.PeerLabel {
+	case PeerLabelName:
+		name, ok := c.cfg.Names[key]
+		if !ok {
+			name = "other"
+		}
+
+		return Label{Name: "peer", Value: name}, true
+	case PeerLabelNone:
+		return Label{}, false
+	default:
+		return Label{Name: "peer", Value: key.String()}, true
+	}
+}
+
+// ServeHTTP implements http.Handler, serving metrics in the Prometheus text
+// exposition format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fs, err := c.Collect()
+	if err != nil {
+		http.Error(w, "failed to collect metrics: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Buffer the output so that a failure can still be reported.
+	var b bytes.Buffer
+	if err := WriteText(&b, fs); err != nil {
+		http.Error(w, "failed to write metrics: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(b.Len()))
+	_, _ = b.WriteTo(w)
+}
+
+// families are the metric Families produced by a Collector.
+type families struct {
+	deviceInfo    *Family
+	listenPort    *Family
+	peers         *Family
+	receiveBytes  *Family
+	transmitBytes *Family
+	lastHandshake *Family
+	allowedIPs    *Family
+	keepalive     *Family
+}
+
+func newFamilies() *families {
+	return &families{
+		deviceInfo: &Family{
+			Name: "wireguard_device_info",
+			Help: "Metadata about a device.",
+			Type: Gauge,
+		},
+		listenPort: &Family{
+			Name: "wireguard_device_listen_port",
+			Help: "The UDP port on which a device listens.",
+			Type: Gauge,
+		},
+		peers: &Family{
+			Name: "wireguard_device_peers",
+			Help: "The number of peers configured on a device.",
+			Type: Gauge,
+		},
+		receiveBytes: &Family{
+			Name: "wireguard_peer_receive_bytes_total",
+			Help: "The number of bytes received from a peer.",
+			Type: Counter,
+		},
+		transmitBytes: &Family{
+			Name: "wireguard_peer_transmit_bytes_total",
+			Help: "The number of bytes transmitted to a peer.",
+			Type: Counter,
+		},
+		lastHandshake: &Family{
+			Name: "wireguard_peer_last_handshake_seconds",
+			Help: "The UNIX timestamp of the latest handshake with a peer, or 0 if none has occurred.",
+			Type: Gauge,
+			max:  true,
+		},
+		allowedIPs: &Family{
+			Name: "wireguard_peer_allowed_ips",
+			Help: "The number of allowed IP ranges configured for a peer.",
+			Type: Gauge,
+		},
+		keepalive: &Family{
+			Name: "wireguard_peer_persistent_keepalive_seconds",
+			Help: "The persistent keepalive interval of a peer, or 0 if disabled.",
+			Type: Gauge,
+			max:  true,
+		},
+	}
+}
+
+// list returns the Families in a stable order.
+func (fs *families) list() []*Family {
+	return []*Family{
+		fs.deviceInfo,
+		fs.listenPort,
+		fs.peers,
+		fs.receiveBytes,
+		fs.transmitBytes,
+		fs.lastHandshake,
+		fs.allowedIPs,
+		fs.keepalive,
+	}
+}
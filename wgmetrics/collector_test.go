@@ -0,0 +1,316 @@
+package wgmetrics_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgmetrics"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestCollectorWriteText(t *testing.T) {
+	var (
+		priv = wgtest.MustHexKey("e84b5a6d2717c1003a13b431570353dbaca9146cf150c5f8575680feba52027a")
+		a    = wgtest.MustHexKey("b85996fecc9c7f1fc6d2572a76eda11d59bcd20be8e543b15ce4bd85a8e75a33")
+		b    = wgtest.MustHexKey("58402e695ba1772b1cc9309755f043251ea77fdcf10fbe63989ceb7e19321376")
+		c    = wgtest.MustHexKey("662e14fd594556f522604703340351258903b64f35553763f19426ab2a515c58")
+	)
+
+	src := devices{{
+		Name:       "wg0",
+		Type:       wgtypes.LinuxKernel,
+		PublicKey:  priv.PublicKey(),
+		ListenPort: 51820,
+		Peers: []wgtypes.Peer{
+			{
+				PublicKey:         a,
+				LastHandshakeTime: time.Unix(1600000000, 0),
+				ReceiveBytes:      1,
+				TransmitBytes:     2,
+				AllowedIPs: []net.IPNet{
+					wgtest.MustCIDR("192.0.2.0/24"),
+					wgtest.MustCIDR("2001:db8::/32"),
+				},
+				PersistentKeepaliveInterval: 25 * time.Second,
+			},
+			{
+				PublicKey:         b,
+				LastHandshakeTime: time.Unix(1600000100, 0),
+				ReceiveBytes:      10,
+				TransmitBytes:     20,
+			},
+			{
+				PublicKey:     c,
+				ReceiveBytes:  100,
+				TransmitBytes: 200,
+			},
+		},
+	}}
+
+	header := func(name, help, typ string) string {
+		return "# HELP " + name + " " + help + "\n# TYPE " + name + " " + typ + "\n"
+	}
+
+	device := header("wireguard_device_info", "Metadata about a device.", "gauge") +
+		`wireguard_device_info{device="wg0",type="Linux kernel",public_key="` + priv.PublicKey().String() + `"} 1` + "\n" +
+		header("wireguard_device_listen_port", "The UDP port on which a device listens.", "gauge") +
+		`wireguard_device_listen_port{device="wg0"} 51820` + "\n" +
+		header("wireguard_device_peers", "The number of peers configured on a device.", "gauge") +
+		`wireguard_device_peers{device="wg0"} 3` + "\n"
+
+	var (
+		rx        = header("wireguard_peer_receive_bytes_total", "The number of bytes received from a peer.", "counter")
+		tx        = header("wireguard_peer_transmit_bytes_total", "The number of bytes transmitted to a peer.", "counter")
+		handshake = header("wireguard_peer_last_handshake_seconds", "The UNIX timestamp of the latest handshake with a peer, or 0 if none has occurred.", "gauge")
+		ips       = header("wireguard_peer_allowed_ips", "The number of allowed IP ranges configured for a peer.", "gauge")
+		keepalive = header("wireguard_peer_persistent_keepalive_seconds", "The persistent keepalive interval of a peer, or 0 if disabled.", "gauge")
+	)
+
+	tests := []struct {
+		name string
+		cfg  *wgmetrics.Config
+		out  string
+	}{
+		{
+			name: "public key",
+			out: device +
+				rx +
+				`wireguard_peer_receive_bytes_total{device="wg0",peer="` + a.String() + `"} 1` + "\n" +
+				`wireguard_peer_receive_bytes_total{device="wg0",peer="` + b.String() + `"} 10` + "\n" +
+				`wireguard_peer_receive_bytes_total{device="wg0",peer="` + c.String() + `"} 100` + "\n" +
+				tx +
+				`wireguard_peer_transmit_bytes_total{device="wg0",peer="` + a.String() + `"} 2` + "\n" +
+				`wireguard_peer_transmit_bytes_total{device="wg0",peer="` + b.String() + `"} 20` + "\n" +
+				`wireguard_peer_transmit_bytes_total{device="wg0",peer="` + c.String() + `"} 200` + "\n" +
+				handshake +
+				`wireguard_peer_last_handshake_seconds{device="wg0",peer="` + a.String() + `"} 1600000000` + "\n" +
+				`wireguard_peer_last_handshake_seconds{device="wg0",peer="` + b.String() + `"} 1600000100` + "\n" +
+				`wireguard_peer_last_handshake_seconds{device="wg0",peer="` + c.String() + `"} 0` + "\n" +
+				ips +
+				`wireguard_peer_allowed_ips{device="wg0",peer="` + a.String() + `"} 2` + "\n" +
+				`wireguard_peer_allowed_ips{device="wg0",peer="` + b.String() + `"} 0` + "\n" +
+				`wireguard_peer_allowed_ips{device="wg0",peer="` + c.String() + `"} 0` + "\n" +
+				keepalive +
+				`wireguard_peer_persistent_keepalive_seconds{device="wg0",peer="` + a.String() + `"} 25` + "\n" +
+				`wireguard_peer_persistent_keepalive_seconds{device="wg0",peer="` + b.String() + `"} 0` + "\n" +
+				`wireguard_peer_persistent_keepalive_seconds{device="wg0",peer="` + c.String() + `"} 0` + "\n",
+		},
+		{
+			name: "names",
+			cfg: &wgmetrics.Config{
+				PeerLabel: wgmetrics.PeerLabelName,
+				Names: map[wgtypes.Key]string{
+					a: `laptop "a"`,
+				},
+			},
+			out: device +
+				rx +
+				`wireguard_peer_receive_bytes_total{device="wg0",peer="laptop \"a\""} 1` + "\n" +
+				`wireguard_peer_receive_bytes_total{device="wg0",peer="other"} 110` + "\n" +
+				tx +
+				`wireguard_peer_transmit_bytes_total{device="wg0",peer="laptop \"a\""} 2` + "\n" +
+				`wireguard_peer_transmit_bytes_total{device="wg0",peer="other"} 220` + "\n" +
+				handshake +
+				`wireguard_peer_last_handshake_seconds{device="wg0",peer="laptop \"a\""} 1600000000` + "\n" +
+				`wireguard_peer_last_handshake_seconds{device="wg0",peer="other"} 1600000100` + "\n" +
+				ips +
+				`wireguard_peer_allowed_ips{device="wg0",peer="laptop \"a\""} 2` + "\n" +
+				`wireguard_peer_allowed_ips{device="wg0",peer="other"} 0` + "\n" +
+				keepalive +
+				`wireguard_peer_persistent_keepalive_seconds{device="wg0",peer="laptop \"a\""} 25` + "\n" +
+				`wireguard_peer_persistent_keepalive_seconds{device="wg0",peer="other"} 0` + "\n",
+		},
+		{
+			name: "none",
+			cfg:  &wgmetrics.Config{PeerLabel: wgmetrics.PeerLabelNone},
+			out: device +
+				rx + `wireguard_peer_receive_bytes_total{device="wg0"} 111` + "\n" +
+				tx + `wireguard_peer_transmit_bytes_total{device="wg0"} 222` + "\n" +
+				handshake + `wireguard_peer_last_handshake_seconds{device="wg0"} 1600000100` + "\n" +
+				ips + `wireguard_peer_allowed_ips{device="wg0"} 2` + "\n" +
+				keepalive + `wireguard_peer_persistent_keepalive_seconds{device="wg0"} 25` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, err := wgmetrics.New(src, tt.cfg).Collect()
+			if err != nil {
+				t.Fatalf("failed to collect: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := wgmetrics.WriteText(&buf, fs); err != nil {
+				t.Fatalf("failed to write text: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.out, buf.String()); diff != "" {
+				t.Fatalf("unexpected output (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCollectorCombinedCountersRetained(t *testing.T) {
+	var (
+		a = wgtest.MustPublicKey()
+		b = wgtest.MustPublicKey()
+		c = wgtest.MustPublicKey()
+	)
+
+	wg0 := &wgtypes.Device{
+		Name: "wg0",
+		Peers: []wgtypes.Peer{
+			{PublicKey: a, ReceiveBytes: 1, TransmitBytes: 2},
+			{PublicKey: b, ReceiveBytes: 10, TransmitBytes: 20},
+			{PublicKey: c, ReceiveBytes: 100, TransmitBytes: 200},
+		},
+	}
+
+	src := devices{wg0}
+	col := wgmetrics.New(&src, &wgmetrics.Config{PeerLabel: wgmetrics.PeerLabelNone})
+
+	// collect returns the receive and transmit byte counters of wg0, or -1 if
+	// they are not present.
+	collect := func() [2]float64 {
+		t.Helper()
+
+		fs, err := col.Collect()
+		if err != nil {
+			t.Fatalf("failed to collect: %v", err)
+		}
+
+		out := [2]float64{-1, -1}
+		for _, f := range fs {
+			var i int
+			switch f.Name {
+			case "wireguard_peer_receive_bytes_total":
+				i = 0
+			case "wireguard_peer_transmit_bytes_total":
+				i = 1
+			default:
+				continue
+			}
+
+			for _, s := range f.Samples {
+				out[i] = s.Value
+			}
+		}
+
+		return out
+	}
+
+	steps := []struct {
+		name string
+		fn   func()
+		want [2]float64
+	}{
+		{
+			name: "initial",
+			fn:   func() {},
+			want: [2]float64{111, 222},
+		},
+		{
+			name: "peer removed",
+			fn:   func() { wg0.Peers = wg0.Peers[:2] },
+			want: [2]float64{111, 222},
+		},
+		{
+			name: "peer reset",
+			fn: func() {
+				wg0.Peers[0].ReceiveBytes = 5
+				wg0.Peers[1].ReceiveBytes = 0
+				wg0.Peers[1].TransmitBytes = 0
+			},
+			want: [2]float64{115, 222},
+		},
+		{
+			name: "device removed",
+			fn:   func() { src = nil },
+			want: [2]float64{-1, -1},
+		},
+		{
+			name: "device added",
+			fn:   func() { src = devices{wg0} },
+			want: [2]float64{5, 2},
+		},
+	}
+
+	for _, st := range steps {
+		st.fn()
+		if diff := cmp.Diff(st.want, collect()); diff != "" {
+			t.Fatalf("unexpected counters after %s (-want +got):\n%s", st.name, diff)
+		}
+	}
+}
+
+func TestCollectorServeHTTP(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    wgmetrics.Source
+		status int
+		body   string
+	}{
+		{
+			name:   "OK",
+			src:    devices{{Name: "wg0"}},
+			status: http.StatusOK,
+			body:   `wireguard_device_peers{device="wg0"} 0`,
+		},
+		{
+			name:   "error",
+			src:    errSource{},
+			status: http.StatusInternalServerError,
+			body:   "failed to collect metrics: permission denied",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(wgmetrics.New(tt.src, nil))
+			defer srv.Close()
+
+			res, err := http.Get(srv.URL + "/metrics")
+			if err != nil {
+				t.Fatalf("failed to get metrics: %v", err)
+			}
+			defer res.Body.Close()
+
+			b, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("failed to read body: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.status, res.StatusCode); diff != "" {
+				t.Fatalf("unexpected status (-want +got):\n%s", diff)
+			}
+
+			if !strings.Contains(string(b), tt.body) {
+				t.Fatalf("body does not contain %q:\n%s", tt.body, b)
+			}
+
+			if tt.status == http.StatusOK {
+				if diff := cmp.Diff(wgmetrics.ContentType, res.Header.Get("Content-Type")); diff != "" {
+					t.Fatalf("unexpected Content-Type (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+type devices []*wgtypes.Device
+
+func (ds devices) Devices() ([]*wgtypes.Device, error) { return ds, nil }
+
+type errSource struct{}
+
+func (errSource) Devices() ([]*wgtypes.Device, error) { return nil, errors.New("permission denied") }
@@ -0,0 +1,7 @@
+// Package wgmetrics collects metrics about WireGuard devices, and exposes them
+// in the Prometheus text exposition format.
+//
+// The package has no dependencies beyond wgctrl. Applications which use the
+// Prometheus client library can adapt the Families produced by
+// Collector.Collect to their own collector types.
+package wgmetrics // import "golang.zx2c4.com/wireguard/wgctrl/wgmetrics"
@@ -0,0 +1,155 @@
+package wgmetrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the HTTP Content-Type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// A Type is the type of a metric Family.
+type Type int
+
+// Possible Type values.
+const (
+	Gauge Type = iota
+	Counter
+)
+
+// String returns the name of t in the text exposition format.
+func (t Type) String() string {
+	switch t {
+	case Gauge:
+		return "gauge"
+	case Counter:
+		return "counter"
+	default:
+		return "untyped"
+	}
+}
+
+// A Family is a set of Samples which share a metric name.
+type Family struct {
+	Name    string
+	Help    string
+	Type    Type
+	Samples []Sample
+
+	// Samples with identical labels are combined by summing their values,
+	// or by taking the maximum value if max is set.
+	max bool
+
+	// index maps the labels of each Sample added by add to its position in
+	// Samples.
+	index map[string]int
+}
+
+// A Sample is a single value within a Family.
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// A Label is a metric label name and value pair.
+type Label struct {
+	Name, Value string
+}
+
+// add adds a Sample with value v and labels to f, combining it with an
+// existing Sample with the same labels.
+func (f *Family) add(v float64, labels ...Label) {
+	key := labelKey(labels)
+	if i, ok := f.index[key]; ok {
+		if f.max {
+			f.Samples[i].Value = math.Max(f.Samples[i].Value, v)
+		} else {
+			f.Samples[i].Value += v
+		}
+
+		return
+	}
+
+	if f.index == nil {
+		f.index = make(map[string]int)
+	}
+	f.index[key] = len(f.Samples)
+
+	f.Samples = append(f.Samples, Sample{
+		Labels: labels,
+		Value:  v,
+	})
+}
+
+// labelKey produces a unique key for a set of labels. Values are quoted so
+// that no two sets of labels produce the same key.
+func labelKey(labels []Label) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString(l.Name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(l.Value))
+		b.WriteByte(',')
+	}
+
+	return b.String()
+}
+
+// WriteText writes fs to w in the Prometheus text exposition format.
+func WriteText(w io.Writer, fs []*Family) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range fs {
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.Name, escape(f.Help, false))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.Name, f.Type)
+
+		for _, s := range f.Samples {
+			bw.WriteString(f.Name)
+			if len(s.Labels) > 0 {
+				bw.WriteByte('{')
+				for i, l := range s.Labels {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+
+					fmt.Fprintf(bw, "%s=\"%s\"", l.Name, escape(l.Value, true))
+				}
+				bw.WriteByte('}')
+			}
+
+			fmt.Fprintf(bw, " %s\n", formatValue(s.Value))
+		}
+	}
+
+	return bw.Flush()
+}
+
+// escape escapes s for use in HELP text or, if quoted is set, a label value.
+func escape(s string, quoted bool) string {
+	r := strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	if quoted {
+		r = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	}
+
+	return r.Replace(s)
+}
+
+// formatValue formats v as a sample value. Byte counters and timestamps are
+// large whole numbers, so avoid exponents for those.
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, +1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case v == math.Trunc(v) && math.Abs(v) < 1e15:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,9 @@
+// Package wgreconcile keeps WireGuard devices at a desired configuration.
+//
+// A Reconciler periodically, or when triggered by an event, reads each device
+// named by a Provider, compares it with the device's desired configuration,
+// and applies the minimal wgtypes.Config which corrects any drift, such as
+// changes made by hand using wg(8). Peers which are already in their desired
+// state are left untouched, so their sessions are not interrupted. Devices
+// which fail to reconcile are retried with exponential backoff.
+package wgreconcile
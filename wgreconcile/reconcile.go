@@ -0,0 +1,465 @@
+package wgreconcile
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgstate"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// A Client retrieves and configures devices. *wgctrl.Client implements
+// Client.
+type Client interface {
+	Device(name string) (*wgtypes.Device, error)
+	ConfigureDevice(name string, cfg wgtypes.Config) error
+}
+
+var _ Client = &wgctrl.Client{}
+
+// A Provider supplies the desired configuration of each device, keyed by
+// device name. Devices which are not present are not managed.
+//
+// Each wgtypes.Config describes the complete desired state of its device, in
+// the same way as wg(8) syncconf:
+//   - a nil PrivateKey, ListenPort, or FirewallMark is not managed, and a
+//     ListenPort of 0 accepts whichever port the device chose;
+//   - Peers is the complete set of peers, so any other peers are removed, and
+//     ReplacePeers and the Remove, UpdateOnly, and ReplaceAllowedIPs fields of
+//     each peer are ignored;
+//   - a nil PresharedKey or PersistentKeepaliveInterval is cleared, and a nil
+//     Endpoint is not managed, as endpoints cannot be removed and are updated
+//     as peers roam.
+//
+// If a device's keys are redacted by its backend, its private key is
+// reconciled by comparing public keys, and an existing redacted preshared key
+// is left alone, as only its presence can be compared.
+type Provider interface {
+	Desired(ctx context.Context) (map[string]wgtypes.Config, error)
+}
+
+// ProviderFunc adapts a function to a Provider.
+type ProviderFunc func(ctx context.Context) (map[string]wgtypes.Config, error)
+
+// Desired implements Provider.
+func (fn ProviderFunc) Desired(ctx context.Context) (map[string]wgtypes.Config, error) {
+	return fn(ctx)
+}
+
+// Config specifies optional configuration for a Reconciler.
+type Config struct {
+	// Interval is the time between periodic reconciliations of all devices.
+	// If zero, 30 seconds is used. If negative, devices are only reconciled
+	// when Trigger fires and when failures are retried.
+	Interval time.Duration
+
+	// Trigger, if not nil, causes all devices to be reconciled immediately
+	// each time it receives a value, such as when a desired configuration
+	// changes or a device appears.
+	Trigger <-chan struct{}
+
+	// MinBackoff and MaxBackoff bound the delay before a device, or the
+	// Provider, is retried after a failure. The delay doubles after each
+	// consecutive failure. If zero, 1 second and 5 minutes are used.
+	MinBackoff, MaxBackoff time.Duration
+
+	// OnDrift, if not nil, is called when a device is found not to match its
+	// desired configuration, before the correction is applied.
+	OnDrift func(ev DriftEvent)
+
+	// OnStatus, if not nil, is called with the result of each attempt to
+	// reconcile a device, and with an empty Device if the Provider fails.
+	OnStatus func(st Status)
+}
+
+// A DriftEvent describes a device which does not match its desired
+// configuration.
+type DriftEvent struct {
+	// Device is the name of the device.
+	Device string
+
+	// Time is when the drift was detected.
+	Time time.Time
+
+	// Changes describes the changes which Correction makes to the device.
+	Changes *wgctrl.Changes
+
+	// Correction is the minimal configuration which restores the device to
+	// its desired configuration.
+	Correction wgtypes.Config
+}
+
+// A Status reports the result of an attempt to reconcile a device.
+type Status struct {
+	// Device is the name of the device, or empty if the Provider failed.
+	Device string
+
+	// Time is when the attempt completed.
+	Time time.Time
+
+	// Drifted reports whether the device did not match its desired
+	// configuration, and Corrected reports whether the correction was applied.
+	Drifted, Corrected bool
+
+	// Err is the error which caused the attempt to fail, if any.
+	Err error
+
+	// Failures is the number of consecutive failed attempts, and NextRetry
+	// is when the next attempt is made, if Err is not nil.
+	Failures  int
+	NextRetry time.Time
+}
+
+// A Reconciler keeps devices at the desired configurations supplied by a
+// Provider.
+type Reconciler struct {
+	c   Client
+	p   Provider
+	cfg Config
+
+	mu sync.Mutex
+	// backoff tracks consecutive failures of each device, and of the Provider
+	// under the empty name.
+	backoff map[string]*backoff
+	// desired is the result of the last successful call to the Provider,
+	// which is used to retry failed devices.
+	desired map[string]wgtypes.Config
+}
+
+// backoff tracks the consecutive failures of a device.
+type backoff struct {
+	failures int
+	retry    time.Time
+}
+
+// New creates a Reconciler which uses c to reconcile the devices supplied by
+// p. If cfg is nil, a default configuration is used.
+func New(c Client, p Provider, cfg *Config) *Reconciler {
+	r := &Reconciler{
+		c:       c,
+		p:       p,
+		backoff: make(map[string]*backoff),
+	}
+	if cfg != nil {
+		r.cfg = *cfg
+	}
+
+	if r.cfg.Interval == 0 {
+		r.cfg.Interval = 30 * time.Second
+	}
+	if r.cfg.MinBackoff == 0 {
+		r.cfg.MinBackoff = time.Second
+	}
+	if r.cfg.MaxBackoff == 0 {
+		r.cfg.MaxBackoff = 5 * time.Minute
+	}
+
+	return r
+}
+
+// A pass selects the devices which are reconciled by reconcile.
+type pass int
+
+const (
+	// passAll reconciles all devices, including those which are backing off.
+	passAll pass = iota
+
+	// passPeriodic reconciles all devices, skipping those which are backing
+	// off until they are due.
+	passPeriodic
+
+	// passRetry only reconciles devices which are backing off and due, using
+	// their desired configurations from the last pass which called the
+	// Provider.
+	passRetry
+)
+
+// Run reconciles devices until ctx is canceled, and then returns ctx.Err().
+// Devices are reconciled immediately, and then each Interval and each time the
+// Trigger fires. Devices which are backing off after a failure are skipped
+// until they are due, and are then retried on their own, without calling the
+// Provider or reconciling other devices.
+func (r *Reconciler) Run(ctx context.Context) error {
+	var (
+		trigger = r.cfg.Trigger
+		p       = passPeriodic
+		next    time.Time
+	)
+
+	for {
+		r.reconcile(ctx, p)
+		if p == passPeriodic && r.cfg.Interval > 0 {
+			next = time.Now().Add(r.cfg.Interval)
+		}
+
+		var (
+			t    *time.Timer
+			wait <-chan time.Time
+		)
+		if d, ok := r.nextWake(next); ok {
+			t = time.NewTimer(d)
+			wait = t.C
+		}
+
+		p = passRetry
+		select {
+		case <-ctx.Done():
+		case _, ok := <-trigger:
+			if ok {
+				p = passPeriodic
+			} else {
+				// A closed Trigger never fires again.
+				trigger = nil
+			}
+		case <-wait:
+		}
+
+		if t != nil {
+			t.Stop()
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if !next.IsZero() && !time.Now().Before(next) {
+			p = passPeriodic
+		}
+	}
+}
+
+// Reconcile reconciles all devices once, including devices which are backing
+// off after a failure, and returns the Status of each device in order of name.
+// An error is returned if the Provider fails.
+func (r *Reconciler) Reconcile(ctx context.Context) ([]Status, error) {
+	return r.reconcile(ctx, passAll)
+}
+
+// reconcile reconciles the devices selected by p.
+func (r *Reconciler) reconcile(ctx context.Context, p pass) ([]Status, error) {
+	// Without a successful call to the Provider, there is nothing to retry
+	// but the Provider itself.
+	if p == passRetry && r.retrying("") {
+		p = passPeriodic
+	}
+	if p != passAll && !r.due("") {
+		return nil, nil
+	}
+
+	var desired map[string]wgtypes.Config
+	if p == passRetry {
+		r.mu.Lock()
+		desired = r.desired
+		r.mu.Unlock()
+	} else {
+		var err error
+		desired, err = r.p.Desired(ctx)
+		if err != nil {
+			r.report(r.fail("", false, err))
+			return nil, err
+		}
+		r.succeed("")
+
+		r.mu.Lock()
+		r.desired = desired
+		r.mu.Unlock()
+	}
+
+	names := make([]string, 0, len(desired))
+	for name := range desired {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sts []Status
+	for _, name := range names {
+		if ctx.Err() != nil {
+			break
+		}
+
+		switch {
+		case p == passPeriodic && !r.due(name):
+			continue
+		case p == passRetry && !r.retrying(name):
+			continue
+		}
+
+		st := r.device(name, desired[name])
+		r.report(st)
+		sts = append(sts, st)
+	}
+
+	if p != passRetry {
+		r.forget(desired)
+	}
+
+	return sts, nil
+}
+
+// device reconciles a single device with its desired configuration.
+func (r *Reconciler) device(name string, cfg wgtypes.Config) Status {
+	d, err := r.c.Device(name)
+	if err != nil {
+		return r.fail(name, false, err)
+	}
+
+	fix := wgstate.Diff(d, target(d, cfg))
+	if wgstate.Empty(fix) {
+		r.succeed(name)
+		return Status{Device: name, Time: time.Now()}
+	}
+
+	if r.cfg.OnDrift != nil {
+		r.cfg.OnDrift(DriftEvent{
+			Device:     name,
+			Time:       time.Now(),
+			Changes:    wgctrl.CompareDevices(d, wgstate.Simulate(d, fix)),
+			Correction: fix,
+		})
+	}
+
+	if err := r.c.ConfigureDevice(name, fix); err != nil {
+		return r.fail(name, true, err)
+	}
+
+	r.succeed(name)
+	return Status{
+		Device:    name,
+		Time:      time.Now(),
+		Drifted:   true,
+		Corrected: true,
+	}
+}
+
+// target computes the desired state of device d from cfg, as documented on
+// Provider.
+func target(d *wgtypes.Device, cfg wgtypes.Config) *wgtypes.Device {
+	full := wgtypes.Config{
+		PrivateKey:   cfg.PrivateKey,
+		ListenPort:   cfg.ListenPort,
+		FirewallMark: cfg.FirewallMark,
+		ReplacePeers: true,
+		Peers:        make([]wgtypes.PeerConfig, 0, len(cfg.Peers)),
+	}
+
+	// A listen port of zero chooses a random port, which is then kept.
+	if cfg.ListenPort != nil && *cfg.ListenPort == 0 {
+		full.ListenPort = nil
+	}
+
+	for _, pc := range cfg.Peers {
+		pc.Remove = false
+		pc.UpdateOnly = false
+		pc.ReplaceAllowedIPs = true
+		full.Peers = append(full.Peers, pc)
+	}
+
+	return wgstate.Simulate(d, full)
+}
+
+// fail records a failure of the device specified by name and produces its
+// Status.
+func (r *Reconciler) fail(name string, drifted bool, err error) Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.backoff[name]
+	if !ok {
+		b = &backoff{}
+		r.backoff[name] = b
+	}
+
+	delay := r.cfg.MinBackoff
+	for i := 0; i < b.failures && delay < r.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > r.cfg.MaxBackoff {
+		delay = r.cfg.MaxBackoff
+	}
+
+	now := time.Now()
+	b.failures++
+	b.retry = now.Add(delay)
+
+	return Status{
+		Device:    name,
+		Time:      now,
+		Drifted:   drifted,
+		Err:       err,
+		Failures:  b.failures,
+		NextRetry: b.retry,
+	}
+}
+
+// succeed resets the backoff of the device specified by name.
+func (r *Reconciler) succeed(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.backoff, name)
+}
+
+// due reports whether the device specified by name is not backing off.
+func (r *Reconciler) due(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.backoff[name]
+	return !ok || !time.Now().Before(b.retry)
+}
+
+// retrying reports whether the device specified by name is backing off and
+// is due to be retried.
+func (r *Reconciler) retrying(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.backoff[name]
+	return ok && !time.Now().Before(b.retry)
+}
+
+// forget discards the backoff of devices which are no longer managed.
+func (r *Reconciler) forget(desired map[string]wgtypes.Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for name := range r.backoff {
+		if _, ok := desired[name]; !ok && name != "" {
+			delete(r.backoff, name)
+		}
+	}
+}
+
+// nextWake returns how long Run waits before reconciling once more, given
+// the time of the next periodic pass, or false if it only waits for the
+// Trigger.
+func (r *Reconciler) nextWake(periodic time.Time) (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	wake := periodic
+	for _, b := range r.backoff {
+		if wake.IsZero() || b.retry.Before(wake) {
+			wake = b.retry
+		}
+	}
+
+	if wake.IsZero() {
+		return 0, false
+	}
+
+	d := time.Until(wake)
+	if d < 0 {
+		d = 0
+	}
+
+	return d, true
+}
+
+// report calls the OnStatus callback, if set.
+func (r *Reconciler) report(st Status) {
+	if r.cfg.OnStatus != nil {
+		r.cfg.OnStatus(st)
+	}
+}
@@ -0,0 +1,323 @@
+package wgreconcile_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgstate"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgreconcile"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+var (
+	keyA = wgtest.MustPublicKey()
+	keyB = wgtest.MustPublicKey()
+	keyX = wgtest.MustPublicKey()
+	ipA  = wgtest.MustCIDR("10.0.0.1/32")
+	ipB  = wgtest.MustCIDR("10.0.0.2/32")
+	epA  = wgtest.MustUDPAddr("192.0.2.1:51820")
+	ka   = 25 * time.Second
+)
+
+// desired is the desired configuration of wg0 in each test.
+func desired() map[string]wgtypes.Config {
+	return map[string]wgtypes.Config{
+		"wg0": {
+			Peers: []wgtypes.PeerConfig{
+				{
+					PublicKey:  keyA,
+					AllowedIPs: []net.IPNet{ipA},
+				},
+				{
+					PublicKey:                   keyB,
+					PersistentKeepaliveInterval: &ka,
+					AllowedIPs:                  []net.IPNet{ipB},
+				},
+			},
+		},
+	}
+}
+
+// drifted is wg0 after someone has changed it by hand.
+func drifted() *wgtypes.Device {
+	return &wgtypes.Device{
+		Name:       "wg0",
+		ListenPort: 51820,
+		Peers: []wgtypes.Peer{
+			// A has roamed, and has an extra allowed IP.
+			{PublicKey: keyA, Endpoint: epA, AllowedIPs: []net.IPNet{ipA, ipB}},
+			{PublicKey: keyX},
+		},
+	}
+}
+
+func TestReconcilerReconcile(t *testing.T) {
+	c := wgtest.NewMemClient(drifted())
+
+	var drift []wgreconcile.DriftEvent
+	r := wgreconcile.New(c, provider(), &wgreconcile.Config{
+		OnDrift: func(ev wgreconcile.DriftEvent) { drift = append(drift, ev) },
+	})
+
+	sts, err := r.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("failed to reconcile: %v", err)
+	}
+
+	if diff := cmp.Diff(1, len(drift)); diff != "" {
+		t.Fatalf("unexpected number of drift events (-want +got):\n%s", diff)
+	}
+	ev := drift[0]
+	if ev.Device != "wg0" || len(ev.Changes.Added) != 1 || len(ev.Changes.Removed) != 1 || len(ev.Changes.Moved) != 1 {
+		t.Fatalf("unexpected drift event: %+v", ev.Changes)
+	}
+
+	want := []wgreconcile.Status{{Device: "wg0", Drifted: true, Corrected: true}}
+	if diff := cmp.Diff(want, sts, ignoreTime()); diff != "" {
+		t.Fatalf("unexpected statuses (-want +got):\n%s", diff)
+	}
+
+	// Unmanaged fields such as the listen port and roamed endpoint are kept.
+	d := &wgtypes.Device{
+		Name:       "wg0",
+		ListenPort: 51820,
+		Peers: []wgtypes.Peer{
+			{PublicKey: keyA, Endpoint: epA, AllowedIPs: []net.IPNet{ipA}},
+			{PublicKey: keyB, PersistentKeepaliveInterval: ka, AllowedIPs: []net.IPNet{ipB}},
+		},
+	}
+	if got := c.State("wg0"); !wgstate.Equal(d, got) {
+		t.Fatalf("unexpected device after reconcile:\n%+v", got)
+	}
+
+	// The device now matches, so nothing is applied.
+	sts, err = r.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("failed to reconcile: %v", err)
+	}
+
+	want = []wgreconcile.Status{{Device: "wg0"}}
+	if diff := cmp.Diff(want, sts, ignoreTime()); diff != "" {
+		t.Fatalf("unexpected statuses (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(1, c.Configured()); diff != "" {
+		t.Fatalf("unexpected number of configurations (-want +got):\n%s", diff)
+	}
+}
+
+func TestReconcilerRedacted(t *testing.T) {
+	var (
+		priv = wgtest.MustPrivateKey()
+		pskA = wgtest.MustPresharedKey()
+		pskB = wgtest.MustPresharedKey()
+	)
+
+	d := &wgtypes.Device{
+		Name:       "wg0",
+		PrivateKey: priv,
+		PublicKey:  priv.PublicKey(),
+		Peers: []wgtypes.Peer{
+			{PublicKey: keyA, PresharedKey: pskA, AllowedIPs: []net.IPNet{ipA}},
+			{PublicKey: keyB, AllowedIPs: []net.IPNet{ipB}},
+		},
+	}
+
+	c := wgtest.NewMemClient(d)
+	c.Redact(true)
+
+	p := wgreconcile.ProviderFunc(func(_ context.Context) (map[string]wgtypes.Config, error) {
+		return map[string]wgtypes.Config{
+			"wg0": {
+				PrivateKey: &priv,
+				Peers: []wgtypes.PeerConfig{
+					{PublicKey: keyA, PresharedKey: &pskA, AllowedIPs: []net.IPNet{ipA}},
+					{PublicKey: keyB, PresharedKey: &pskB, AllowedIPs: []net.IPNet{ipB}},
+				},
+			},
+		}, nil
+	})
+
+	r := wgreconcile.New(c, p, nil)
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(context.Background()); err != nil {
+			t.Fatalf("failed to reconcile: %v", err)
+		}
+	}
+
+	// Only B's missing preshared key is added, and the redacted keys are
+	// left alone.
+	d.Peers[1].PresharedKey = pskB
+	if got := c.State("wg0"); !wgstate.Equal(d, got) {
+		t.Fatalf("unexpected device after reconcile:\n%+v", got)
+	}
+	if diff := cmp.Diff(1, c.Configured()); diff != "" {
+		t.Fatalf("unexpected number of configurations (-want +got):\n%s", diff)
+	}
+}
+
+func TestReconcilerRunBackoff(t *testing.T) {
+	errFoo := errors.New("foo")
+	c := wgtest.NewMemClient(drifted())
+	failNext(c, "wg0", 2, errFoo)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var sts []wgreconcile.Status
+	r := wgreconcile.New(c, provider(), &wgreconcile.Config{
+		// Only retries cause devices to be reconciled once more.
+		Interval:   -1,
+		MinBackoff: 5 * time.Millisecond,
+		OnStatus: func(st wgreconcile.Status) {
+			sts = append(sts, st)
+			if st.Corrected {
+				cancel()
+			}
+		},
+	})
+
+	if err := r.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected Run error: %v", err)
+	}
+
+	if diff := cmp.Diff(3, len(sts)); diff != "" {
+		t.Fatalf("unexpected number of statuses (-want +got):\n%s", diff)
+	}
+
+	for i, st := range sts[:2] {
+		if !errors.Is(st.Err, errFoo) || st.Failures != i+1 || !st.Drifted || st.Corrected {
+			t.Fatalf("unexpected status %d: %+v", i, st)
+		}
+	}
+
+	// The delay doubles after each failure.
+	if d0, d1 := sts[0].NextRetry.Sub(sts[0].Time), sts[1].NextRetry.Sub(sts[1].Time); d0 != 5*time.Millisecond || d1 != 10*time.Millisecond {
+		t.Fatalf("unexpected backoff delays: %v, %v", d0, d1)
+	}
+}
+
+func TestReconcilerRunRetryOnly(t *testing.T) {
+	errFoo := errors.New("foo")
+
+	// wg0 fails twice, while wg1 is healthy.
+	wg1 := drifted()
+	wg1.Name = "wg1"
+	c := wgtest.NewMemClient(drifted(), wg1)
+	failNext(c, "wg0", 2, errFoo)
+
+	var calls int
+	p := wgreconcile.ProviderFunc(func(_ context.Context) (map[string]wgtypes.Config, error) {
+		calls++
+		want := desired()
+		want["wg1"] = want["wg0"]
+		return want, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var sts []wgreconcile.Status
+	r := wgreconcile.New(c, p, &wgreconcile.Config{
+		Interval:   time.Hour,
+		MinBackoff: 5 * time.Millisecond,
+		OnStatus: func(st wgreconcile.Status) {
+			sts = append(sts, st)
+			if st.Device == "wg0" && st.Corrected {
+				cancel()
+			}
+		},
+	})
+
+	if err := r.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected Run error: %v", err)
+	}
+
+	// Retries neither call the Provider nor reconcile the healthy device.
+	var got []string
+	for _, st := range sts {
+		got = append(got, st.Device)
+	}
+
+	if diff := cmp.Diff([]string{"wg0", "wg1", "wg0", "wg0"}, got); diff != "" {
+		t.Fatalf("unexpected reconciled devices (-want +got):\n%s", diff)
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 call to the Provider, but got %d", calls)
+	}
+}
+
+func TestReconcilerRunTriggerClosed(t *testing.T) {
+	trigger := make(chan struct{})
+	close(trigger)
+
+	var calls int
+	p := wgreconcile.ProviderFunc(func(_ context.Context) (map[string]wgtypes.Config, error) {
+		calls++
+		return desired(), nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	r := wgreconcile.New(wgtest.NewMemClient(drifted()), p, &wgreconcile.Config{
+		Interval: -1,
+		Trigger:  trigger,
+	})
+
+	if err := r.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected Run error: %v", err)
+	}
+
+	// A closed Trigger must not cause further reconciliation.
+	if calls != 1 {
+		t.Fatalf("expected 1 call to the Provider, but got %d", calls)
+	}
+}
+
+func TestReconcilerProviderError(t *testing.T) {
+	errFoo := errors.New("foo")
+
+	var sts []wgreconcile.Status
+	r := wgreconcile.New(wgtest.NewMemClient(drifted()), wgreconcile.ProviderFunc(
+		func(_ context.Context) (map[string]wgtypes.Config, error) {
+			return nil, errFoo
+		},
+	), &wgreconcile.Config{
+		OnStatus: func(st wgreconcile.Status) { sts = append(sts, st) },
+	})
+
+	if _, err := r.Reconcile(context.Background()); !errors.Is(err, errFoo) {
+		t.Fatalf("expected provider error, but got: %v", err)
+	}
+
+	if len(sts) != 1 || sts[0].Device != "" || sts[0].Failures != 1 {
+		t.Fatalf("unexpected statuses: %+v", sts)
+	}
+}
+
+func provider() wgreconcile.Provider {
+	return wgreconcile.ProviderFunc(func(_ context.Context) (map[string]wgtypes.Config, error) {
+		return desired(), nil
+	})
+}
+
+func ignoreTime() cmp.Option {
+	return cmp.FilterPath(func(p cmp.Path) bool {
+		return p.Last().String() == ".Time"
+	}, cmp.Ignore())
+}
+
+// failNext arranges for the next n configurations of the device specified by
+// name to return err.
+func failNext(m *wgtest.MemClient, name string, n int, err error) {
+	for i := 0; i < n; i++ {
+		m.FailNext(name, func(_ *wgtest.MemClient, _ wgtypes.Config) error {
+			return err
+		})
+	}
+}
@@ -0,0 +1,20 @@
+// Package wgserver serves a JSON HTTP API which exposes the devices of a
+// wgctrl.Client, so that they can be managed from another process, container,
+// or host.
+//
+// The API is described by an OpenAPI document served at /v1/openapi.json:
+//
+//	GET   /v1/devices         lists all devices the caller may access
+//	GET   /v1/devices/{name}  retrieves a device
+//	PATCH /v1/devices/{name}  configures a device with a JSON wgtypes.Config
+//
+// Each caller is authorized by a bearer token, or on Linux by the user ID of
+// the process connected to a UNIX socket, and is limited to the devices in
+// its allowlist. Private and preshared keys are redacted unless the caller is
+// explicitly allowed to view them.
+//
+// A wgctrl.Client controls the devices of a Server on another host when the
+// host is listed in wgctrl.Options.Remotes. Server.Transport serves the API
+// within a single process, so a remote Client can be tested without any
+// network connections.
+package wgserver
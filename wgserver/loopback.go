@@ -0,0 +1,82 @@
+package wgserver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// Transport returns an http.RoundTripper which serves each request using s
+// within the calling process, without any network connections. Combined with
+// wgctrl.RemoteOptions.HTTPClient, it lets a wgctrl.Client control the
+// devices of s as a remote host, such as in tests.
+//
+// Requests served by Transport carry no peer credentials, so callers are
+// authorized only by bearer tokens or Config.Anonymous.
+func (s *Server) Transport() http.RoundTripper {
+	return loopback{s: s}
+}
+
+// loopback is the http.RoundTripper returned by Server.Transport.
+type loopback struct {
+	s *Server
+}
+
+// RoundTrip implements http.RoundTripper.
+func (l loopback) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Present the request as a server would receive it.
+	r := req.Clone(req.Context())
+	r.RequestURI = req.URL.RequestURI()
+	r.RemoteAddr = "127.0.0.1:0"
+	if r.Body == nil {
+		r.Body = http.NoBody
+	}
+
+	w := &responseBuffer{header: make(http.Header)}
+	l.s.ServeHTTP(w, r)
+
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	res := &http.Response{
+		Status:        strconv.Itoa(w.status) + " " + http.StatusText(w.status),
+		StatusCode:    w.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.header,
+		Body:          ioutil.NopCloser(&w.body),
+		ContentLength: int64(w.body.Len()),
+		Request:       req,
+	}
+
+	return res, nil
+}
+
+var _ http.ResponseWriter = &responseBuffer{}
+
+// A responseBuffer is an http.ResponseWriter which stores a response in
+// memory for loopback.
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// Header implements http.ResponseWriter.
+func (w *responseBuffer) Header() http.Header { return w.header }
+
+// WriteHeader implements http.ResponseWriter.
+func (w *responseBuffer) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// Write implements http.ResponseWriter.
+func (w *responseBuffer) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
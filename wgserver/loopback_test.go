@@ -0,0 +1,180 @@
+package wgserver
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestTransportRemoteClient(t *testing.T) {
+	var (
+		priv = wgtest.MustPrivateKey()
+		pub  = wgtest.MustPublicKey()
+		ipA  = wgtest.MustCIDR("10.0.0.1/32")
+	)
+
+	m := wgtest.NewMemClient(
+		&wgtypes.Device{
+			Name:       "wg0",
+			Type:       wgtypes.LinuxKernel,
+			PrivateKey: priv,
+			PublicKey:  priv.PublicKey(),
+			ListenPort: 51820,
+		},
+		&wgtypes.Device{Name: "wg1", Type: wgtypes.Userspace},
+	)
+
+	s := New(m, &Config{
+		Tokens: map[string]*Access{
+			"admin":    {Name: "admin", Devices: []string{"wg0"}, Keys: true},
+			"reader":   {Name: "reader", ReadOnly: true},
+			"operator": {Name: "operator", Devices: []string{"wg0"}},
+		},
+	})
+
+	newClient := func(t *testing.T, token string) *wgctrl.Client {
+		t.Helper()
+
+		c, err := wgctrl.NewWithOptions(&wgctrl.Options{
+			EmbeddedOnly: true,
+			Remotes: []wgctrl.RemoteOptions{{
+				Name:       "host",
+				URL:        "http://wgctrl.test",
+				Token:      token,
+				HTTPClient: &http.Client{Transport: s.Transport()},
+			}},
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		t.Cleanup(func() { _ = c.Close() })
+
+		return c
+	}
+
+	t.Run("devices", func(t *testing.T) {
+		ds, err := newClient(t, "admin").Devices()
+		if err != nil {
+			t.Fatalf("failed to get devices: %v", err)
+		}
+
+		// Only wg0 is visible with this token.
+		if len(ds) != 1 {
+			t.Fatalf("expected one device, but got: %d", len(ds))
+		}
+
+		want := &wgtypes.Device{
+			Name:       "host/wg0",
+			Type:       wgtypes.LinuxKernel,
+			PrivateKey: priv,
+			PublicKey:  priv.PublicKey(),
+			ListenPort: 51820,
+			Peers:      []wgtypes.Peer{},
+		}
+		if diff := cmp.Diff(want, ds[0]); diff != "" {
+			t.Fatalf("unexpected device (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("configure", func(t *testing.T) {
+		c := newClient(t, "admin")
+
+		err := c.ConfigureDevice("host/wg0", wgtypes.Config{
+			Peers: []wgtypes.PeerConfig{{
+				PublicKey:  pub,
+				AllowedIPs: []net.IPNet{ipA},
+			}},
+		})
+		if err != nil {
+			t.Fatalf("failed to configure device: %v", err)
+		}
+
+		d, err := c.Device("host/wg0")
+		if err != nil {
+			t.Fatalf("failed to get device: %v", err)
+		}
+
+		if len(d.Peers) != 1 || d.Peers[0].PublicKey != pub {
+			t.Fatalf("unexpected peers: %+v", d.Peers)
+		}
+		if diff := cmp.Diff("admin", m.Actor()); diff != "" {
+			t.Fatalf("unexpected actor (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("redacted", func(t *testing.T) {
+		c := newClient(t, "operator")
+		psk := wgtest.MustPresharedKey()
+		peer := wgtest.MustPublicKey()
+
+		// Keys which the server withholds cannot be saved.
+		dir, err := ioutil.TempDir("", "wgserver-redacted")
+		if err != nil {
+			t.Fatalf("failed to create temporary directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "state.json")
+		if err := c.Save(path, "host/wg0"); !errors.Is(err, wgctrl.ErrKeysRedacted) {
+			t.Fatalf("expected redacted keys, but got: %v", err)
+		}
+
+		// A transaction which adds a preshared key is verified by its
+		// presence alone.
+		res, err := c.ConfigureDeviceTransaction("host/wg0", wgtypes.Config{
+			Peers: []wgtypes.PeerConfig{{
+				PublicKey:    peer,
+				PresharedKey: &psk,
+				AllowedIPs:   []net.IPNet{wgtest.MustCIDR("10.0.0.2/32")},
+			}},
+		})
+		if err != nil {
+			t.Fatalf("failed to configure device: %v", err)
+		}
+		if !res.After.KeysRedacted || res.After.PrivateKey != (wgtypes.Key{}) {
+			t.Fatalf("expected redacted device, but got: %+v", res.After)
+		}
+
+		d, err := m.Device("wg0")
+		if err != nil {
+			t.Fatalf("failed to get device: %v", err)
+		}
+		if d.PrivateKey != priv {
+			t.Fatal("private key was changed")
+		}
+		for _, p := range d.Peers {
+			if p.PublicKey == peer && p.PresharedKey != psk {
+				t.Fatal("preshared key was not set")
+			}
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		admin, reader := newClient(t, "admin"), newClient(t, "reader")
+
+		if _, err := admin.Device("wg0"); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected not exist for unqualified name, but got: %v", err)
+		}
+		if _, err := reader.Device("host/wg2"); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected not exist for missing device, but got: %v", err)
+		}
+		if _, err := admin.Device("host/wg1"); !errors.Is(err, os.ErrPermission) {
+			t.Fatalf("expected permission denied for forbidden device, but got: %v", err)
+		}
+		if err := reader.ConfigureDevice("host/wg1", wgtypes.Config{}); !errors.Is(err, os.ErrPermission) {
+			t.Fatalf("expected permission denied for read-only access, but got: %v", err)
+		}
+		if _, err := newClient(t, "bad").Devices(); !errors.Is(err, os.ErrPermission) {
+			t.Fatalf("expected permission denied for bad token, but got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package wgserver
+
+// schema is the OpenAPI document describing the API. Its schemas mirror the
+// structures of package wgtypes; durations are in seconds and keys are
+// base64-encoded.
+const schema = `{
+	"openapi": "3.0.3",
+	"info": {
+		"title": "wgctrl",
+		"description": "Retrieve and configure WireGuard devices.",
+		"version": "1"
+	},
+	"components": {
+		"securitySchemes": {
+			"bearer": {"type": "http", "scheme": "bearer"}
+		},
+		"schemas": {
+			"Devices": {
+				"type": "object",
+				"required": ["devices"],
+				"properties": {
+					"devices": {"type": "array", "items": {"$ref": "#/components/schemas/Device"}}
+				}
+			},
+			"Device": {
+				"type": "object",
+				"required": ["name", "type", "public_key", "listen_port", "firewall_mark", "peers"],
+				"properties": {
+					"name": {"type": "string"},
+					"type": {"type": "string", "enum": ["unknown", "linux_kernel", "openbsd_kernel", "userspace"]},
+					"private_key": {"type": "string", "description": "Omitted unless the caller may view keys."},
+					"public_key": {"type": "string"},
+					"listen_port": {"type": "integer"},
+					"firewall_mark": {"type": "integer"},
+					"peers": {"type": "array", "items": {"$ref": "#/components/schemas/Peer"}},
+					"keys_redacted": {"type": "boolean", "description": "Set if private and preshared keys were withheld from the caller."}
+				}
+			},
+			"Peer": {
+				"type": "object",
+				"required": ["public_key", "has_preshared_key", "persistent_keepalive_interval", "receive_bytes", "transmit_bytes", "allowed_ips", "protocol_version"],
+				"properties": {
+					"public_key": {"type": "string"},
+					"has_preshared_key": {"type": "boolean"},
+					"preshared_key": {"type": "string", "description": "Omitted unless the caller may view keys."},
+					"endpoint": {"type": "string", "example": "192.0.2.1:51820"},
+					"persistent_keepalive_interval": {"type": "integer", "description": "Seconds, or 0 if disabled."},
+					"last_handshake_time": {"type": "string", "format": "date-time", "description": "Omitted if no handshake has occurred."},
+					"receive_bytes": {"type": "integer", "format": "int64"},
+					"transmit_bytes": {"type": "integer", "format": "int64"},
+					"allowed_ips": {"type": "array", "items": {"type": "string", "example": "10.0.0.0/24"}},
+					"protocol_version": {"type": "integer"}
+				}
+			},
+			"Config": {
+				"type": "object",
+				"description": "Only fields which are present are applied.",
+				"properties": {
+					"private_key": {"type": "string"},
+					"listen_port": {"type": "integer"},
+					"firewall_mark": {"type": "integer"},
+					"replace_peers": {"type": "boolean"},
+					"peers": {"type": "array", "items": {"$ref": "#/components/schemas/PeerConfig"}}
+				}
+			},
+			"PeerConfig": {
+				"type": "object",
+				"required": ["public_key"],
+				"properties": {
+					"public_key": {"type": "string"},
+					"remove": {"type": "boolean"},
+					"update_only": {"type": "boolean"},
+					"preshared_key": {"type": "string"},
+					"endpoint": {"type": "string", "description": "A numeric IP address and port."},
+					"persistent_keepalive_interval": {"type": "integer", "description": "Seconds, or 0 to disable."},
+					"replace_allowed_ips": {"type": "boolean"},
+					"allowed_ips": {"type": "array", "items": {"type": "string"}}
+				}
+			},
+			"Error": {
+				"type": "object",
+				"required": ["code", "message"],
+				"properties": {
+					"code": {"type": "string", "enum": ["bad_request", "unauthorized", "forbidden", "not_exist", "read_only", "not_supported", "internal"]},
+					"message": {"type": "string"}
+				}
+			}
+		},
+		"responses": {
+			"Error": {
+				"description": "The request failed.",
+				"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}
+			}
+		}
+	},
+	"security": [{"bearer": []}],
+	"paths": {
+		"/v1/devices": {
+			"get": {
+				"summary": "List the devices the caller may access.",
+				"responses": {
+					"200": {"description": "The devices.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Devices"}}}},
+					"default": {"$ref": "#/components/responses/Error"}
+				}
+			}
+		},
+		"/v1/devices/{name}": {
+			"parameters": [{"name": "name", "in": "path", "required": true, "schema": {"type": "string"}}],
+			"get": {
+				"summary": "Retrieve a device.",
+				"responses": {
+					"200": {"description": "The device.", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Device"}}}},
+					"default": {"$ref": "#/components/responses/Error"}
+				}
+			},
+			"patch": {
+				"summary": "Configure a device.",
+				"requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Config"}}}},
+				"responses": {
+					"204": {"description": "The device was configured."},
+					"default": {"$ref": "#/components/responses/Error"}
+				}
+			}
+		}
+	}
+}
+`
@@ -0,0 +1,343 @@
+package wgserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgapi"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wginternal"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// maxBodySize bounds the size of a configuration request.
+const maxBodySize = 16 << 20
+
+// A Client retrieves and configures devices. *wgctrl.Client implements
+// Client.
+type Client interface {
+	Devices() ([]*wgtypes.Device, error)
+	Device(name string) (*wgtypes.Device, error)
+	ConfigureDevice(name string, cfg wgtypes.Config) error
+}
+
+var _ Client = &wgctrl.Client{}
+
+// An actorClient can record the caller which configured a device, such as a
+// *wgctrl.Client with an audit sink.
+type actorClient interface {
+	ConfigureDeviceAs(actor, name string, cfg wgtypes.Config) error
+}
+
+// Access specifies what a caller may do.
+type Access struct {
+	// Name identifies the caller. If the Client is a *wgctrl.Client, Name is
+	// recorded as the actor of each configuration by its audit sink.
+	Name string
+
+	// Devices, if not empty, lists the names of the only devices the caller
+	// may access. Other devices are omitted from the list of devices and
+	// refused with a "forbidden" error.
+	Devices []string
+
+	// ReadOnly specifies that the caller may not configure devices.
+	ReadOnly bool
+
+	// Keys specifies that the caller may view private and preshared keys,
+	// which are otherwise redacted.
+	Keys bool
+}
+
+// allowed reports whether a may access the device specified by name.
+func (a *Access) allowed(name string) bool {
+	if len(a.Devices) == 0 {
+		return true
+	}
+
+	for _, d := range a.Devices {
+		if d == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Config specifies the callers which a Server authorizes. A request without
+// credentials which match Tokens or UIDs is refused, unless Anonymous is set.
+type Config struct {
+	// Tokens maps bearer tokens, sent in the Authorization header of each
+	// request, to the access they grant.
+	Tokens map[string]*Access
+
+	// UIDs maps user IDs to the access they grant to processes connected to
+	// a UNIX socket served by Serve. Peer credentials are only available on
+	// Linux.
+	UIDs map[int]*Access
+
+	// Anonymous, if not nil, is the access granted to requests without
+	// credentials. Anonymous access should only be used with a listener
+	// which is otherwise protected, such as a UNIX socket with restrictive
+	// permissions.
+	Anonymous *Access
+
+	// Logf, if not nil, receives the errors returned by the Client. Callers
+	// only receive an error code and a generic message, so that details of
+	// the host are not revealed to them.
+	Logf func(format string, v ...interface{})
+}
+
+// A Server serves the API for the devices of a Client.
+type Server struct {
+	c   Client
+	cfg Config
+}
+
+var _ http.Handler = &Server{}
+
+// New creates a Server which serves the devices of c to the callers
+// authorized by cfg. If cfg is nil, every request is refused.
+func New(c Client, cfg *Config) *Server {
+	s := &Server{c: c}
+	if cfg != nil {
+		s.cfg = *cfg
+	}
+
+	return s
+}
+
+// uidKey is the context key for the user ID of the process on the other end
+// of a UNIX socket.
+type uidKey struct{}
+
+// Serve accepts connections on l and serves the API until ctx is canceled,
+// at which point the server is shut down and ctx.Err() is returned. If l is a
+// UNIX socket, callers may be authorized by their user IDs on Linux.
+//
+// Serve uses TLS only if l does, such as a listener created by tls.Listen.
+// Bearer tokens and private keys are sent in cleartext over other TCP
+// listeners, which should therefore only listen on loopback addresses.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	srv := &http.Server{
+		Handler: s,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			if _, ok := c.(*net.UnixConn); !ok {
+				return ctx
+			}
+
+			uid, _, err := wginternal.PeerCredentials(c)
+			if err != nil {
+				return ctx
+			}
+
+			return context.WithValue(ctx, uidKey{}, uid)
+		},
+	}
+
+	errC := make(chan error, 1)
+	go func() { errC <- srv.Serve(l) }()
+
+	select {
+	case <-ctx.Done():
+		_ = srv.Shutdown(context.Background())
+		<-errC
+		return ctx.Err()
+	case err := <-errC:
+		return err
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == wgapi.PathSchema {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(schema))
+		return
+	}
+
+	a, ok := s.authorize(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="wgctrl"`)
+		writeError(w, http.StatusUnauthorized, wgapi.CodeUnauthorized, "missing or invalid credentials")
+		return
+	}
+
+	if r.URL.Path == wgapi.PathDevices {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+
+		s.devices(w, a)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, wgapi.PathDevices+"/")
+	if name == r.URL.Path || name == "" || strings.Contains(name, "/") {
+		writeError(w, http.StatusNotFound, wgapi.CodeNotExist, "not found")
+		return
+	}
+
+	if !a.allowed(name) {
+		writeError(w, http.StatusForbidden, wgapi.CodeForbidden, fmt.Sprintf("access to device %q is not allowed", name))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.device(w, a, name)
+	case http.MethodPatch:
+		s.configure(w, r, a, name)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPatch)
+	}
+}
+
+// authorize determines the access granted to the caller of r.
+func (s *Server) authorize(r *http.Request) (*Access, bool) {
+	if h := r.Header.Get("Authorization"); h != "" {
+		const prefix = "Bearer "
+		if !strings.HasPrefix(h, prefix) {
+			return nil, false
+		}
+
+		return s.token(strings.TrimPrefix(h, prefix))
+	}
+
+	if uid, ok := r.Context().Value(uidKey{}).(int); ok {
+		if a, ok := s.cfg.UIDs[uid]; ok {
+			return a, true
+		}
+	}
+
+	if s.cfg.Anonymous != nil {
+		return s.cfg.Anonymous, true
+	}
+
+	return nil, false
+}
+
+// token finds the access granted by a bearer token. Every token is compared
+// in constant time, so that the time taken does not reveal valid tokens.
+func (s *Server) token(tok string) (*Access, bool) {
+	var found *Access
+	for t, a := range s.cfg.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(tok)) == 1 {
+			found = a
+		}
+	}
+
+	return found, found != nil
+}
+
+// devices serves the devices which a may access.
+func (s *Server) devices(w http.ResponseWriter, a *Access) {
+	ds, err := s.c.Devices()
+	if err != nil {
+		s.writeClientError(w, err)
+		return
+	}
+
+	out := wgapi.Devices{Devices: make([]wgapi.Device, 0, len(ds))}
+	for _, d := range ds {
+		if a.allowed(d.Name) {
+			out.Devices = append(out.Devices, wgapi.EncodeDevice(d, a.Keys))
+		}
+	}
+
+	writeJSON(w, http.StatusOK, out)
+}
+
+// device serves the device specified by name.
+func (s *Server) device(w http.ResponseWriter, a *Access, name string) {
+	d, err := s.c.Device(name)
+	if err != nil {
+		s.writeClientError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, wgapi.EncodeDevice(d, a.Keys))
+}
+
+// configure configures the device specified by name.
+func (s *Server) configure(w http.ResponseWriter, r *http.Request, a *Access, name string) {
+	if a.ReadOnly {
+		writeError(w, http.StatusForbidden, wgapi.CodeForbidden, "configuring devices is not allowed")
+		return
+	}
+
+	var in wgapi.Config
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, wgapi.CodeBadRequest, fmt.Sprintf("invalid configuration: %v", err))
+		return
+	}
+
+	cfg, err := in.Decode()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, wgapi.CodeBadRequest, fmt.Sprintf("invalid configuration: %v", err))
+		return
+	}
+
+	if ac, ok := s.c.(actorClient); ok {
+		err = ac.ConfigureDeviceAs(a.Name, name, cfg)
+	} else {
+		err = s.c.ConfigureDevice(name, cfg)
+	}
+	if err != nil {
+		s.writeClientError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeClientError writes an error returned by the Client. The text of the
+// error is only logged.
+func (s *Server) writeClientError(w http.ResponseWriter, err error) {
+	if s.cfg.Logf != nil {
+		s.cfg.Logf("wgserver: %v", err)
+	}
+
+	switch {
+	case os.IsNotExist(err):
+		writeError(w, http.StatusNotFound, wgapi.CodeNotExist, "device does not exist")
+	case errors.Is(err, wgctrl.ErrReadOnly):
+		writeError(w, http.StatusConflict, wgapi.CodeReadOnly, "device is read-only")
+	case errors.Is(err, wgctrl.ErrNotSupported):
+		writeError(w, http.StatusNotImplemented, wgapi.CodeNotSupported, "operation is not supported")
+	default:
+		writeError(w, http.StatusInternalServerError, wgapi.CodeInternal, "internal error")
+	}
+}
+
+// methodNotAllowed writes an error for a request with an unsupported method.
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, wgapi.CodeBadRequest, "method not allowed")
+}
+
+// writeError writes an error response.
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	writeJSON(w, status, wgapi.Error{Code: code, Message: msg})
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
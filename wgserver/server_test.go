@@ -0,0 +1,381 @@
+package wgserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgapi"
+	"golang.zx2c4.com/wireguard/wgctrl/internal/wgtest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestServer(t *testing.T) {
+	var (
+		priv = wgtest.MustPrivateKey()
+		psk  = wgtest.MustPresharedKey()
+		pub  = wgtest.MustPublicKey()
+	)
+
+	c := wgtest.NewMemClient(
+		&wgtypes.Device{
+			Name:       "wg0",
+			Type:       wgtypes.LinuxKernel,
+			PrivateKey: priv,
+			PublicKey:  priv.PublicKey(),
+			Peers:      []wgtypes.Peer{{PublicKey: pub, PresharedKey: psk}},
+		},
+		&wgtypes.Device{Name: "wg1", Type: wgtypes.Userspace},
+	)
+
+	srv := httptest.NewServer(New(c, &Config{
+		Tokens: map[string]*Access{
+			"admin":  {Name: "admin", Keys: true},
+			"wg1":    {Name: "wg1-agent", Devices: []string{"wg1"}},
+			"reader": {Name: "reader", ReadOnly: true},
+		},
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name, token, method, path, body string
+		status                          int
+		check                           func(t *testing.T, b []byte)
+	}{
+		{
+			name:   "schema",
+			method: http.MethodGet,
+			path:   wgapi.PathSchema,
+			status: http.StatusOK,
+		},
+		{
+			name:   "no credentials",
+			method: http.MethodGet,
+			path:   "/v1/devices",
+			status: http.StatusUnauthorized,
+			check:  checkCode(wgapi.CodeUnauthorized),
+		},
+		{
+			name:   "bad token",
+			token:  "nope",
+			method: http.MethodGet,
+			path:   "/v1/devices",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "list redacted",
+			token:  "reader",
+			method: http.MethodGet,
+			path:   "/v1/devices",
+			status: http.StatusOK,
+			check: func(t *testing.T, b []byte) {
+				var ds wgapi.Devices
+				mustUnmarshal(t, b, &ds)
+
+				if diff := cmp.Diff(2, len(ds.Devices)); diff != "" {
+					t.Fatalf("unexpected number of devices (-want +got):\n%s", diff)
+				}
+
+				d := ds.Devices[0]
+				p := d.Peers[0]
+				if d.PrivateKey != "" || p.PresharedKey != "" || !p.HasPresharedKey || d.Type != "linux_kernel" {
+					t.Fatalf("unexpected device: %+v", d)
+				}
+			},
+		},
+		{
+			name:   "list allowlist",
+			token:  "wg1",
+			method: http.MethodGet,
+			path:   "/v1/devices",
+			status: http.StatusOK,
+			check: func(t *testing.T, b []byte) {
+				var ds wgapi.Devices
+				mustUnmarshal(t, b, &ds)
+
+				if len(ds.Devices) != 1 || ds.Devices[0].Name != "wg1" {
+					t.Fatalf("unexpected devices: %+v", ds.Devices)
+				}
+			},
+		},
+		{
+			name:   "get forbidden",
+			token:  "wg1",
+			method: http.MethodGet,
+			path:   "/v1/devices/wg0",
+			status: http.StatusForbidden,
+			check:  checkCode(wgapi.CodeForbidden),
+		},
+		{
+			name:   "get keys",
+			token:  "admin",
+			method: http.MethodGet,
+			path:   "/v1/devices/wg0",
+			status: http.StatusOK,
+			check: func(t *testing.T, b []byte) {
+				var d wgapi.Device
+				mustUnmarshal(t, b, &d)
+
+				if d.PrivateKey != priv.String() || d.Peers[0].PresharedKey != psk.String() {
+					t.Fatalf("expected keys in device: %+v", d)
+				}
+			},
+		},
+		{
+			name:   "get not exist",
+			token:  "admin",
+			method: http.MethodGet,
+			path:   "/v1/devices/wg2",
+			status: http.StatusNotFound,
+			check:  checkCode(wgapi.CodeNotExist),
+		},
+		{
+			name:   "configure read-only",
+			token:  "reader",
+			method: http.MethodPatch,
+			path:   "/v1/devices/wg1",
+			body:   `{"listen_port":51820}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "configure bad request",
+			token:  "wg1",
+			method: http.MethodPatch,
+			path:   "/v1/devices/wg1",
+			body:   `{"peers":[{"public_key":"nope"}]}`,
+			status: http.StatusBadRequest,
+			check:  checkCode(wgapi.CodeBadRequest),
+		},
+		{
+			name:   "configure unknown field",
+			token:  "wg1",
+			method: http.MethodPatch,
+			path:   "/v1/devices/wg1",
+			body:   `{"listen_prot":51820}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "configure OK",
+			token:  "wg1",
+			method: http.MethodPatch,
+			path:   "/v1/devices/wg1",
+			body:   `{"listen_port":51820,"peers":[{"public_key":"` + pub.String() + `","allowed_ips":["10.0.0.1/32"]}]}`,
+			status: http.StatusNoContent,
+			check: func(t *testing.T, _ []byte) {
+				d, err := c.Device("wg1")
+				if err != nil {
+					t.Fatalf("failed to get device: %v", err)
+				}
+
+				if d.ListenPort != 51820 || len(d.Peers) != 1 || c.Actor() != "wg1-agent" {
+					t.Fatalf("unexpected device after configuration: %+v", d)
+				}
+			},
+		},
+		{
+			name:   "method not allowed",
+			token:  "admin",
+			method: http.MethodDelete,
+			path:   "/v1/devices/wg0",
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			b, status := do(t, srv.Client(), req)
+			if diff := cmp.Diff(tt.status, status); diff != "" {
+				t.Fatalf("unexpected status (-want +got):\n%s\n%s", diff, b)
+			}
+
+			if tt.check != nil {
+				tt.check(t, b)
+			}
+		})
+	}
+}
+
+func TestServerInternalError(t *testing.T) {
+	var logged []string
+	s := New(errClient{}, &Config{
+		Anonymous: &Access{},
+		Logf: func(format string, v ...interface{}) {
+			logged = append(logged, fmt.Sprintf(format, v...))
+		},
+	})
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, wgapi.PathDevices, nil))
+
+	if diff := cmp.Diff(http.StatusInternalServerError, w.Code); diff != "" {
+		t.Fatalf("unexpected status (-want +got):\n%s", diff)
+	}
+
+	// The details of the error are logged, but not returned to the caller.
+	var e wgapi.Error
+	mustUnmarshal(t, w.Body.Bytes(), &e)
+	if diff := cmp.Diff(wgapi.Error{Code: wgapi.CodeInternal, Message: "internal error"}, e); diff != "" {
+		t.Fatalf("unexpected error (-want +got):\n%s", diff)
+	}
+
+	if len(logged) != 1 || !strings.Contains(logged[0], errSecret.Error()) {
+		t.Fatalf("unexpected logged errors: %v", logged)
+	}
+}
+
+func TestServerPeerCredentials(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("skipping, peer credentials are only available on Linux")
+	}
+
+	dir, err := ioutil.TempDir("", "wgserver")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "wgctrl.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	c := wgtest.NewMemClient(&wgtypes.Device{Name: "wg0"})
+	s := New(c, &Config{
+		UIDs: map[int]*Access{os.Getuid(): {Name: "local"}},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error, 1)
+	go func() { errC <- s.Serve(ctx, l) }()
+
+	hc := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", sock)
+			},
+		},
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "http://wgctrl/v1/devices/wg0", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	b, status := do(t, hc, req)
+	if diff := cmp.Diff(http.StatusOK, status); diff != "" {
+		t.Fatalf("unexpected status (-want +got):\n%s\n%s", diff, b)
+	}
+
+	cancel()
+	if err := <-errC; err != context.Canceled {
+		t.Fatalf("unexpected Serve error: %v", err)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	var doc struct {
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	mustUnmarshal(t, []byte(schema), &doc)
+
+	// Each schema must have exactly the fields of its message.
+	for name, v := range map[string]interface{}{
+		"Devices":    wgapi.Devices{},
+		"Device":     wgapi.Device{},
+		"Peer":       wgapi.Peer{},
+		"Config":     wgapi.Config{},
+		"PeerConfig": wgapi.PeerConfig{},
+		"Error":      wgapi.Error{},
+	} {
+		var want []string
+		typ := reflect.TypeOf(v)
+		for i := 0; i < typ.NumField(); i++ {
+			want = append(want, strings.Split(typ.Field(i).Tag.Get("json"), ",")[0])
+		}
+		sort.Strings(want)
+
+		var got []string
+		for p := range doc.Components.Schemas[name].Properties {
+			got = append(got, p)
+		}
+		sort.Strings(got)
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("unexpected properties for schema %s (-want +got):\n%s", name, diff)
+		}
+	}
+}
+
+func do(t *testing.T, c *http.Client, req *http.Request) ([]byte, int) {
+	t.Helper()
+
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+
+	return b, res.StatusCode
+}
+
+func checkCode(code string) func(t *testing.T, b []byte) {
+	return func(t *testing.T, b []byte) {
+		var e wgapi.Error
+		mustUnmarshal(t, b, &e)
+
+		if diff := cmp.Diff(code, e.Code); diff != "" {
+			t.Fatalf("unexpected error code (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func mustUnmarshal(t *testing.T, b []byte, v interface{}) {
+	t.Helper()
+
+	if err := json.NewDecoder(bytes.NewReader(b)).Decode(v); err != nil {
+		t.Fatalf("failed to decode JSON: %v\n%s", err, b)
+	}
+}
+
+// errSecret is an error which reveals details of the host.
+var errSecret = errors.New("open /etc/wireguard/secret: input/output error")
+
+// An errClient is a Client which always fails with errSecret.
+type errClient struct{}
+
+func (errClient) Devices() ([]*wgtypes.Device, error)              { return nil, errSecret }
+func (errClient) Device(_ string) (*wgtypes.Device, error)         { return nil, errSecret }
+func (errClient) ConfigureDevice(_ string, _ wgtypes.Config) error { return errSecret }
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/curve25519"
@@ -60,6 +61,85 @@ type Device struct {
 
 	// Peers is the list of network peers associated with this device.
 	Peers []Peer
+
+	// KeysRedacted indicates that the backend withheld the device's private
+	// key and the preshared keys of its peers, such as a remote API which
+	// does not permit the caller to view keys. PrivateKey and each
+	// PresharedKey are then zero, but PublicKey is accurate and
+	// Peer.PresharedKeyRedacted reports which peers have a preshared key.
+	KeysRedacted bool
+}
+
+// A Capability is an optional operation which a device may support.
+// Capability values are bit flags which may be combined.
+type Capability uint
+
+// Possible Capability values.
+const (
+	// CapabilityConfigure indicates that a device can be configured.
+	CapabilityConfigure Capability = 1 << iota
+
+	// CapabilityCreate indicates that devices of the same kind can be
+	// created, such as by wgctrl.Client.CreateEmbeddedDevice.
+	CapabilityCreate
+
+	// CapabilityWatch indicates that the appearance and disappearance of a
+	// device can be watched.
+	CapabilityWatch
+
+	// CapabilityStatsOnly indicates that a device's statistics can be queried
+	// without the privileges needed to retrieve its keys, which are then
+	// omitted.
+	CapabilityStatsOnly
+)
+
+// capabilityNames are the names of each Capability, in bit order.
+var capabilityNames = []string{
+	"configure",
+	"create",
+	"watch",
+	"stats-only",
+}
+
+// String returns the names of the capabilities in c, separated by "|", or
+// "none" if c is empty.
+func (c Capability) String() string {
+	if c == 0 {
+		return "none"
+	}
+
+	var ss []string
+	for i, name := range capabilityNames {
+		if c&(1<<uint(i)) != 0 {
+			ss = append(ss, name)
+			c &^= 1 << uint(i)
+		}
+	}
+
+	if c != 0 {
+		ss = append(ss, fmt.Sprintf("0x%x", uint(c)))
+	}
+
+	return strings.Join(ss, "|")
+}
+
+// Capabilities describes the optional operations supported by a device.
+type Capabilities struct {
+	// Backend identifies the implementation which controls the device, such
+	// as "wglinux" for Linux kernel devices, or "wguser" for userspace and
+	// embedded devices.
+	Backend string
+
+	// Type specifies the underlying implementation of the device.
+	Type DeviceType
+
+	// Supported is the set of capabilities supported by the device.
+	Supported Capability
+}
+
+// Has reports whether all of the capabilities in c are supported.
+func (cs *Capabilities) Has(c Capability) bool {
+	return cs.Supported&c == c
 }
 
 // KeyLen is the expected key length for a WireGuard key.
@@ -158,9 +238,14 @@ type Peer struct {
 	// PresharedKey is an optional preshared key which may be used as an
 	// additional layer of security for peer communications.
 	//
-	// A zero-value Key means no preshared key is configured.
+	// A zero-value Key means no preshared key is configured, unless
+	// PresharedKeyRedacted is set.
 	PresharedKey Key
 
+	// PresharedKeyRedacted indicates that the peer has a preshared key which
+	// was withheld by the backend. See Device.KeysRedacted.
+	PresharedKeyRedacted bool
+
 	// Endpoint is the most recent source address used for communication by
 	// this Peer.
 	Endpoint *net.UDPAddr
@@ -119,3 +119,39 @@ func keyPtr(k wgtypes.Key) *[32]byte {
 func panicf(format string, a ...interface{}) {
 	panic(fmt.Sprintf(format, a...))
 }
+
+func TestCapabilityString(t *testing.T) {
+	tests := []struct {
+		name string
+		c    wgtypes.Capability
+		s    string
+	}{
+		{
+			name: "none",
+			s:    "none",
+		},
+		{
+			name: "one",
+			c:    wgtypes.CapabilityConfigure,
+			s:    "configure",
+		},
+		{
+			name: "several",
+			c:    wgtypes.CapabilityConfigure | wgtypes.CapabilityWatch | wgtypes.CapabilityStatsOnly,
+			s:    "configure|watch|stats-only",
+		},
+		{
+			name: "unknown",
+			c:    wgtypes.CapabilityCreate | 1<<10,
+			s:    "create|0x400",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.s, tt.c.String()); diff != "" {
+				t.Fatalf("unexpected string (-want +got):\n%s", diff)
+			}
+		})
+	}
+}